@@ -1,22 +1,38 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
+	gitlabapi "gitlab.com/gitlab-org/api/client-go"
 
 	"github.com/ylchen07/gitlab-mcp-server/internal/app"
+	"github.com/ylchen07/gitlab-mcp-server/internal/audit"
+	"github.com/ylchen07/gitlab-mcp-server/internal/auth"
 	gitlabsvc "github.com/ylchen07/gitlab-mcp-server/internal/gitlab"
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab/gitlabtest"
+	"github.com/ylchen07/gitlab-mcp-server/internal/logging"
 )
 
+// defaultGitLabTimeout bounds each GitLab request unless --gitlab-timeout says otherwise.
+const defaultGitLabTimeout = 30 * time.Second
+
 type serverStarter func(*app.Server, bool, string) error
 
-func run(args []string, getenv func(string) string, logger *log.Logger, start serverStarter) error {
-	cmd := newRootCommand(getenv, logger, start)
+// run executes the root command. Logs are written to stderr (or the configured log file) so
+// they never interleave with the stdio MCP transport on stdout; only informational subcommands
+// such as tools write to stdout.
+func run(args []string, getenv func(string) string, stdout, stderr io.Writer, start serverStarter) error {
+	cmd := newRootCommand(getenv, stdout, stderr, start)
 	if len(args) > 1 {
 		cmd.SetArgs(normalizeLegacyFlags(args[1:]))
 	}
@@ -26,44 +42,172 @@ func run(args []string, getenv func(string) string, logger *log.Logger, start se
 	return cmd.Execute()
 }
 
-func newRootCommand(getenv func(string) string, logger *log.Logger, start serverStarter) *cobra.Command {
+func newRootCommand(getenv func(string) string, stdout, stderr io.Writer, start serverStarter) *cobra.Command {
 	var useHTTP bool
 	var httpAddr string
+	var subgroupConcurrency int
+	var projectConcurrency int
+	var deleteConcurrency int
+	var deleteRate float64
+	var deleteRetries int
+	var demo bool
+	var planTTL time.Duration
+	var requireElicitation bool
+	var toolFilter app.ToolFilter
+	var auditLogPath string
+	var authTokenFile string
+	var perCallerTokens bool
+	var callerCacheSize int
+	var transport gitlabsvc.TransportConfig
+	var tlsCertFile, tlsKeyFile string
+	var logConfig logging.Config
+
+	readOnlyDefault, readOnlyErr := envBool(getenv, "GITLAB_MCP_READ_ONLY")
+	perCallerDefault, perCallerErr := envBool(getenv, "GITLAB_MCP_PER_CALLER_TOKENS")
+	insecureDefault, insecureErr := envBool(getenv, "GITLAB_INSECURE_SKIP_VERIFY")
+	timeoutDefault, timeoutErr := envDuration(getenv, "GITLAB_TIMEOUT", defaultGitLabTimeout)
 
 	root := &cobra.Command{
 		Use:           "gitlab-mcp-server",
 		Short:         "GitLab MCP Server",
 		SilenceUsage:  true,
 		SilenceErrors: true,
+		PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+			if err := errors.Join(readOnlyErr, perCallerErr, insecureErr, timeoutErr); err != nil {
+				return err
+			}
+
+			toolFilter.Toolsets = cleanList(toolFilter.Toolsets)
+			toolFilter.EnableTools = cleanList(toolFilter.EnableTools)
+			toolFilter.DisableTools = cleanList(toolFilter.DisableTools)
+
+			return toolFilter.Validate()
+		},
 		RunE: func(_ *cobra.Command, _ []string) error {
-			logger.Println("Starting GitLab MCP Server...")
+			logger, closeLog, err := logging.New(logConfig, stderr)
+			if err != nil {
+				return fmt.Errorf("configure logging: %w", err)
+			}
+			defer closeLog.Close()
+
+			logger.Info("starting GitLab MCP Server")
 
-			token := strings.TrimSpace(getenv("GITLAB_ACCESS_TOKEN"))
-			if token == "" {
-				return fmt.Errorf("GITLAB_ACCESS_TOKEN environment variable not set")
+			serviceOpts := []gitlabsvc.ServiceOption{
+				gitlabsvc.WithSubgroupConcurrency(subgroupConcurrency),
+				gitlabsvc.WithProjectConcurrency(projectConcurrency),
+				gitlabsvc.WithDeletionConcurrency(deleteConcurrency),
+				// One limiter for every Service keeps --delete-rate server-wide with per-caller tokens.
+				gitlabsvc.WithDeletionLimiter(gitlabsvc.NewDeletionLimiter(deleteRate, deleteConcurrency)),
+				gitlabsvc.WithDeletionRetries(deleteRetries, gitlabsvc.DefaultDeletionBackoff),
 			}
-			logger.Println("GitLab access token detected")
 
-			serverURL := strings.TrimSpace(getenv("GITLAB_SERVER_URL"))
-			if serverURL == "" {
-				serverURL = "https://gitlab.com"
-				logger.Printf("GITLAB_SERVER_URL not set, defaulting to %s", serverURL)
-			} else {
-				logger.Printf("Using GitLab server: %s", serverURL)
+			serverOpts := []app.ServerOption{
+				app.WithPlanTTL(planTTL),
+				app.WithRequireElicitation(requireElicitation),
+				app.WithToolFilter(toolFilter),
 			}
 
-			client, err := gitlabsvc.NewClient(token, serverURL)
+			httpClient, err := gitlabsvc.NewHTTPClient(transport)
 			if err != nil {
-				return fmt.Errorf("failed to create GitLab client: %w", err)
+				return fmt.Errorf("configure GitLab transport: %w", err)
+			}
+			if transport.InsecureSkipVerify {
+				logger.Warn("TLS certificate verification of GitLab is disabled")
 			}
-			logger.Println("GitLab client initialized")
 
-			gitlabService := gitlabsvc.NewService(client, logger)
+			var gitlabService *gitlabsvc.Service
+			if perCallerTokens {
+				switch {
+				case !useHTTP:
+					return fmt.Errorf("--per-caller-tokens requires --http")
+				case demo:
+					return fmt.Errorf("--per-caller-tokens cannot be combined with --demo")
+				}
+
+				serverURL := gitlabServerURL(getenv, logger)
+				newService := func(token string) (*gitlabsvc.Service, error) {
+					client, err := gitlabsvc.NewClient(token, serverURL, gitlabsvc.WithHTTPClient(httpClient))
+					if err != nil {
+						return nil, err
+					}
+					return gitlabsvc.NewService(gitlabsvc.BackendFromClient(client), logger, serviceOpts...), nil
+				}
+
+				logger.Info("per-caller GitLab tokens: each HTTP request must send its own token",
+					"header", app.CallerTokenHeader, "cache_size", callerCacheSize)
+				serverOpts = append(serverOpts, app.WithPerCallerTokens(newService, callerCacheSize))
+
+				// A server-wide token is optional here and only used by /readyz.
+				if token := strings.TrimSpace(getenv("GITLAB_ACCESS_TOKEN")); token != "" {
+					if gitlabService, err = newService(token); err != nil {
+						return fmt.Errorf("failed to create GitLab client: %w", err)
+					}
+				}
+			} else {
+				client, err := newGitLabClient(getenv, logger, demo, httpClient)
+				if err != nil {
+					return err
+				}
+				logger.Info("GitLab client initialized")
+
+				gitlabService = gitlabsvc.NewService(gitlabsvc.BackendFromClient(client), logger, serviceOpts...)
+			}
+
+			if path := strings.TrimSpace(auditLogPath); path != "" {
+				auditLog, err := audit.Open(path)
+				if err != nil {
+					return err
+				}
+				defer auditLog.Close()
+
+				logger.Info("recording mutating tool calls in audit log", "path", path)
+				serverOpts = append(serverOpts, app.WithAuditLog(auditLog))
+			}
+
+			if tlsCertFile != "" || tlsKeyFile != "" {
+				switch {
+				case !useHTTP:
+					return fmt.Errorf("--tls-cert and --tls-key require --http")
+				case tlsCertFile == "" || tlsKeyFile == "":
+					return fmt.Errorf("--tls-cert and --tls-key must be set together")
+				}
+			}
 
-			srv := app.NewServer(gitlabService, logger)
+			if useHTTP {
+				if tlsCertFile != "" {
+					logger.Info("serving HTTPS", "cert_file", tlsCertFile)
+					serverOpts = append(serverOpts, app.WithTLS(tlsCertFile, tlsKeyFile))
+				}
+
+				bearer, err := newBearerAuth(getenv, authTokenFile)
+				if err != nil {
+					return err
+				}
+				if bearer != nil {
+					logger.Info("HTTP clients must authenticate with a bearer token")
+					serverOpts = append(serverOpts, app.WithBearerAuth(bearer))
+				} else {
+					logger.Warn("HTTP transport has no authentication: anyone who can reach it acts with the GitLab token; set GITLAB_MCP_AUTH_TOKENS or --auth-token-file",
+						"addr", httpAddr)
+				}
+			}
+
+			srv := app.NewServer(gitlabService, logger, serverOpts...)
+
+			if toolFilter.ReadOnly {
+				logger.Info("read-only mode: mutating tools are not registered")
+			}
 
 			for _, tool := range srv.AvailableTools() {
-				logger.Printf("Registered MCP tool %s - %s", tool.Name, tool.Description)
+				logger.Info("registered MCP tool", "name", tool.Name, "title", tool.Title,
+					"read_only", tool.ReadOnly, "destructive", tool.Destructive,
+					"idempotent", tool.Idempotent, "open_world", tool.OpenWorld)
+			}
+
+			if useHTTP {
+				logger.Info("serving MCP over HTTP", "addr", httpAddr, "tls", tlsCertFile != "")
+			} else {
+				logger.Info("serving MCP over stdio")
 			}
 
 			return start(srv, useHTTP, httpAddr)
@@ -72,10 +216,203 @@ func newRootCommand(getenv func(string) string, logger *log.Logger, start server
 
 	root.Flags().BoolVar(&useHTTP, "http", false, "Expose the MCP server over HTTP instead of stdio")
 	root.Flags().StringVar(&httpAddr, "addr", ":8000", "HTTP listen address when using --http")
+	root.Flags().IntVar(&subgroupConcurrency, "subgroup-concurrency", gitlabsvc.DefaultSubgroupConcurrency,
+		"Maximum number of subgroups queried in parallel when listing group projects recursively")
+	root.Flags().IntVar(&projectConcurrency, "project-concurrency", gitlabsvc.DefaultProjectConcurrency,
+		"Maximum number of projects cleaned up in parallel by the group-wide pipeline tools")
+	root.Flags().IntVar(&deleteConcurrency, "delete-concurrency", gitlabsvc.DefaultDeletionConcurrency,
+		"Maximum number of pipeline deletions sent in parallel for each project")
+	root.Flags().Float64Var(&deleteRate, "delete-rate", gitlabsvc.DefaultDeletionRate,
+		"Maximum pipeline deletions per second across the whole server, shared by all callers; 0 disables the limit")
+	root.Flags().IntVar(&deleteRetries, "delete-retries", gitlabsvc.DefaultDeletionRetries,
+		"How many times a pipeline deletion answered with 429 or 5xx is retried")
+	root.Flags().DurationVar(&planTTL, "plan-ttl", gitlabsvc.DefaultPlanTTL,
+		"How long a pipeline deletion plan from list_old_pipelines or list_old_group_pipelines can be applied")
+	root.Flags().BoolVar(&requireElicitation, "require-elicitation", false,
+		"Refuse destructive tool calls unless the client can confirm them with the user via MCP elicitation")
+	root.Flags().StringVar(&auditLogPath, "audit-log", envOrDefault(getenv, "GITLAB_MCP_AUDIT_LOG", ""),
+		"Append a JSONL audit record for every call that changes GitLab to this file (env GITLAB_MCP_AUDIT_LOG)")
+	root.Flags().StringVar(&authTokenFile, "auth-token-file", envOrDefault(getenv, "GITLAB_MCP_AUTH_TOKEN_FILE", ""),
+		"Require HTTP clients to send one of the bearer tokens listed in this file, one per line (env GITLAB_MCP_AUTH_TOKEN_FILE)")
+	root.Flags().StringVar(&tlsCertFile, "tls-cert", envOrDefault(getenv, "GITLAB_MCP_TLS_CERT", ""),
+		"Serve HTTPS with this PEM certificate when using --http (env GITLAB_MCP_TLS_CERT)")
+	root.Flags().StringVar(&tlsKeyFile, "tls-key", envOrDefault(getenv, "GITLAB_MCP_TLS_KEY", ""),
+		"PEM private key for --tls-cert (env GITLAB_MCP_TLS_KEY)")
+	root.Flags().StringVar(&transport.CAFile, "gitlab-ca-file", envOrDefault(getenv, "GITLAB_CA_FILE", ""),
+		"Trust the certificate authorities in this PEM bundle when connecting to GitLab (env GITLAB_CA_FILE)")
+	root.Flags().StringVar(&transport.CertFile, "gitlab-client-cert", envOrDefault(getenv, "GITLAB_CLIENT_CERT", ""),
+		"Present this PEM client certificate to GitLab for mutual TLS (env GITLAB_CLIENT_CERT)")
+	root.Flags().StringVar(&transport.KeyFile, "gitlab-client-key", envOrDefault(getenv, "GITLAB_CLIENT_KEY", ""),
+		"PEM private key for --gitlab-client-cert (env GITLAB_CLIENT_KEY)")
+	root.Flags().BoolVar(&transport.InsecureSkipVerify, "gitlab-insecure-skip-verify", insecureDefault,
+		"Do not verify GitLab's TLS certificate; for lab instances only (env GITLAB_INSECURE_SKIP_VERIFY)")
+	root.Flags().StringVar(&transport.ProxyURL, "gitlab-proxy", envOrDefault(getenv, "GITLAB_PROXY", ""),
+		"Reach GitLab through this HTTP(S) proxy instead of the one from HTTPS_PROXY (env GITLAB_PROXY)")
+	root.Flags().DurationVar(&transport.Timeout, "gitlab-timeout", timeoutDefault,
+		"Give up on a GitLab request after this long; 0 disables the timeout (env GITLAB_TIMEOUT)")
+	root.Flags().BoolVar(&perCallerTokens, "per-caller-tokens", perCallerDefault,
+		"In HTTP mode, run each request with the GitLab token from its "+app.CallerTokenHeader+" header (env GITLAB_MCP_PER_CALLER_TOKENS)")
+	root.Flags().IntVar(&callerCacheSize, "caller-cache-size", app.DefaultCallerCacheSize,
+		"Maximum number of per-caller GitLab clients kept in memory with --per-caller-tokens")
+	root.Flags().BoolVar(&demo, "demo", false, "Serve tools against an in-memory demo GitLab instead of a real server")
+	root.Flags().StringVar(&logConfig.Level, "log-level", envOrDefault(getenv, "GITLAB_MCP_LOG_LEVEL", "info"),
+		"Minimum log level: debug, info, warn or error (env GITLAB_MCP_LOG_LEVEL)")
+	root.Flags().StringVar(&logConfig.Format, "log-format", envOrDefault(getenv, "GITLAB_MCP_LOG_FORMAT", logging.FormatText),
+		"Log format: text or json (env GITLAB_MCP_LOG_FORMAT)")
+	root.Flags().StringVar(&logConfig.File, "log-file", envOrDefault(getenv, "GITLAB_MCP_LOG_FILE", ""),
+		"Append logs to this file instead of stderr (env GITLAB_MCP_LOG_FILE)")
+
+	root.PersistentFlags().BoolVar(&toolFilter.ReadOnly, "read-only", readOnlyDefault,
+		"Do not register tools that modify GitLab (env GITLAB_MCP_READ_ONLY)")
+	root.PersistentFlags().StringSliceVar(&toolFilter.Toolsets, "toolsets", envList(getenv, "GITLAB_MCP_TOOLSETS"),
+		"Expose only these toolsets: "+strings.Join(app.Toolsets(), ", ")+" (env GITLAB_MCP_TOOLSETS)")
+	root.PersistentFlags().StringSliceVar(&toolFilter.EnableTools, "enable-tools", envList(getenv, "GITLAB_MCP_ENABLE_TOOLS"),
+		"Expose these tools; without --toolsets, expose only these (env GITLAB_MCP_ENABLE_TOOLS)")
+	root.PersistentFlags().StringSliceVar(&toolFilter.DisableTools, "disable-tools", envList(getenv, "GITLAB_MCP_DISABLE_TOOLS"),
+		"Never expose these tools (env GITLAB_MCP_DISABLE_TOOLS)")
+
+	root.AddCommand(newToolsCommand(stdout, &toolFilter))
 
 	return root
 }
 
+// newToolsCommand lists the MCP tools the server registers with filter applied, together with
+// their annotations. It needs no GitLab credentials.
+func newToolsCommand(stdout io.Writer, filter *app.ToolFilter) *cobra.Command {
+	return &cobra.Command{
+		Use:   "tools",
+		Short: "List the MCP tools exposed by the server",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			srv := app.NewServer(gitlabsvc.NewService(gitlabsvc.Backend{}, logging.Discard()), logging.Discard(),
+				app.WithToolFilter(*filter),
+			)
+
+			w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tTITLE\tREAD-ONLY\tDESTRUCTIVE\tIDEMPOTENT\tOPEN-WORLD")
+			for _, tool := range srv.AvailableTools() {
+				fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%t\t%t\n",
+					tool.Name, tool.Title, tool.ReadOnly, tool.Destructive, tool.Idempotent, tool.OpenWorld)
+			}
+
+			return w.Flush()
+		},
+	}
+}
+
+func newGitLabClient(getenv func(string) string, logger *slog.Logger, demo bool, httpClient *http.Client) (*gitlabapi.Client, error) {
+	if demo {
+		logger.Info("demo mode enabled: using an in-memory GitLab", "group", gitlabtest.DemoGroup)
+
+		client, err := gitlabtest.NewDemo().NewClient()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create demo GitLab client: %w", err)
+		}
+		return client, nil
+	}
+
+	token := strings.TrimSpace(getenv("GITLAB_ACCESS_TOKEN"))
+	if token == "" {
+		return nil, fmt.Errorf("GITLAB_ACCESS_TOKEN environment variable not set")
+	}
+	logger.Info("GitLab access token detected")
+
+	client, err := gitlabsvc.NewClient(token, gitlabServerURL(getenv, logger), gitlabsvc.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitLab client: %w", err)
+	}
+
+	return client, nil
+}
+
+func gitlabServerURL(getenv func(string) string, logger *slog.Logger) string {
+	serverURL := strings.TrimSpace(getenv("GITLAB_SERVER_URL"))
+	if serverURL == "" {
+		serverURL = "https://gitlab.com"
+		logger.Info("GITLAB_SERVER_URL not set, using default", "server_url", serverURL)
+	} else {
+		logger.Info("using GitLab server", "server_url", serverURL)
+	}
+
+	return serverURL
+}
+
+// newBearerAuth collects inbound bearer tokens from GITLAB_MCP_AUTH_TOKENS and the token file.
+// It returns nil when neither is configured.
+func newBearerAuth(getenv func(string) string, tokenFile string) (*auth.Bearer, error) {
+	tokens := envList(getenv, "GITLAB_MCP_AUTH_TOKENS")
+
+	if path := strings.TrimSpace(tokenFile); path != "" {
+		fromFile, err := auth.LoadTokenFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(fromFile) == 0 {
+			return nil, fmt.Errorf("token file %s contains no tokens", path)
+		}
+		tokens = append(tokens, fromFile...)
+	}
+
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	bearer, err := auth.NewBearer(tokens)
+	if err != nil {
+		return nil, fmt.Errorf("configure HTTP authentication: %w", err)
+	}
+
+	return bearer, nil
+}
+
+func envOrDefault(getenv func(string) string, key, fallback string) string {
+	if value := strings.TrimSpace(getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envBool(getenv func(string) string, key string) (bool, error) {
+	value := strings.TrimSpace(getenv(key))
+	if value == "" {
+		return false, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value %q: want true or false", key, value)
+	}
+	return parsed, nil
+}
+
+func envDuration(getenv func(string) string, key string, fallback time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(getenv(key))
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback, fmt.Errorf("invalid %s value %q: want a duration such as 30s", key, value)
+	}
+	return parsed, nil
+}
+
+func envList(getenv func(string) string, key string) []string {
+	return cleanList(strings.Split(getenv(key), ","))
+}
+
+// cleanList trims each entry and drops empty ones, so "a, b," and "a,b" are equivalent.
+func cleanList(values []string) []string {
+	var cleaned []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			cleaned = append(cleaned, value)
+		}
+	}
+	return cleaned
+}
+
 func normalizeLegacyFlags(args []string) []string {
 	normalized := make([]string, len(args))
 	for i, arg := range args {
@@ -92,18 +429,14 @@ func normalizeLegacyFlags(args []string) []string {
 }
 
 func main() {
-	logger := log.New(os.Stdout, "", log.LstdFlags)
-
 	start := func(srv *app.Server, useHTTP bool, addr string) error {
 		if useHTTP {
-			logger.Printf("Serving MCP over HTTP on %s", addr)
 			if err := srv.RunHTTP(addr); err != nil {
 				return fmt.Errorf("HTTP server terminated: %w", err)
 			}
 			return nil
 		}
 
-		logger.Println("Serving MCP over stdio")
 		if err := srv.RunStdio(); err != nil {
 			return fmt.Errorf("STDIO server terminated: %w", err)
 		}
@@ -111,7 +444,8 @@ func main() {
 		return nil
 	}
 
-	if err := run(os.Args, os.Getenv, logger, start); err != nil {
-		logger.Fatal(err)
+	if err := run(os.Args, os.Getenv, os.Stdout, os.Stderr, start); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
@@ -1,9 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"io"
-	"log"
 	"strings"
 	"testing"
 
@@ -11,17 +11,13 @@ import (
 )
 
 func TestRunMissingToken(t *testing.T) {
-	logger := log.New(io.Discard, "", 0)
-
-	err := run([]string{"gitlab-mcp-server"}, func(string) string { return "" }, logger, func(*app.Server, bool, string) error { return nil })
+	err := run([]string{"gitlab-mcp-server"}, func(string) string { return "" }, io.Discard, io.Discard, func(*app.Server, bool, string) error { return nil })
 	if err == nil || !strings.Contains(err.Error(), "GITLAB_ACCESS_TOKEN") {
 		t.Fatalf("expected missing token error, got %v", err)
 	}
 }
 
 func TestRunStartsServerWithDefaults(t *testing.T) {
-	logger := log.New(io.Discard, "", 0)
-
 	env := map[string]string{
 		"GITLAB_ACCESS_TOKEN": "token",
 	}
@@ -32,7 +28,7 @@ func TestRunStartsServerWithDefaults(t *testing.T) {
 		addr    string
 	)
 
-	err := run([]string{"gitlab-mcp-server"}, func(key string) string { return env[key] }, logger,
+	err := run([]string{"gitlab-mcp-server"}, func(key string) string { return env[key] }, io.Discard, io.Discard,
 		func(srv *app.Server, serveHTTP bool, httpAddr string) error {
 			if srv == nil {
 				t.Fatal("expected server instance")
@@ -58,8 +54,6 @@ func TestRunStartsServerWithDefaults(t *testing.T) {
 }
 
 func TestRunStartsServerWithHTTP(t *testing.T) {
-	logger := log.New(io.Discard, "", 0)
-
 	env := map[string]string{
 		"GITLAB_ACCESS_TOKEN": "token",
 		"GITLAB_SERVER_URL":   "https://example.com",
@@ -71,7 +65,7 @@ func TestRunStartsServerWithHTTP(t *testing.T) {
 		addr    string
 	)
 
-	err := run([]string{"gitlab-mcp-server", "-http", "-addr", ":9999"}, func(key string) string { return env[key] }, logger,
+	err := run([]string{"gitlab-mcp-server", "-http", "-addr", ":9999"}, func(key string) string { return env[key] }, io.Discard, io.Discard,
 		func(srv *app.Server, serveHTTP bool, httpAddr string) error {
 			called = true
 			useHTTP = serveHTTP
@@ -92,3 +86,193 @@ func TestRunStartsServerWithHTTP(t *testing.T) {
 		t.Fatalf("expected addr :9999, got %s", addr)
 	}
 }
+
+func TestRunDemoModeWithoutToken(t *testing.T) {
+	var called bool
+	err := run([]string{"gitlab-mcp-server", "--demo"}, func(string) string { return "" }, io.Discard, io.Discard,
+		func(srv *app.Server, _ bool, _ string) error {
+			if srv == nil {
+				t.Fatal("expected server instance")
+			}
+			called = true
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	if !called {
+		t.Fatal("expected starter to be called")
+	}
+}
+
+func TestRunWritesLogsToStderr(t *testing.T) {
+	var stderr bytes.Buffer
+
+	env := map[string]string{
+		"GITLAB_ACCESS_TOKEN":   "token",
+		"GITLAB_MCP_LOG_FORMAT": "json",
+	}
+
+	err := run([]string{"gitlab-mcp-server"}, func(key string) string { return env[key] }, io.Discard, &stderr,
+		func(*app.Server, bool, string) error { return nil },
+	)
+	if err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+
+	if !strings.Contains(stderr.String(), `"msg":"registered MCP tool"`) {
+		t.Fatalf("expected JSON tool registration logs on stderr, got %q", stderr.String())
+	}
+}
+
+func TestRunRejectsInvalidLogLevel(t *testing.T) {
+	err := run([]string{"gitlab-mcp-server", "--demo", "--log-level", "loud"}, func(string) string { return "" }, io.Discard, io.Discard,
+		func(*app.Server, bool, string) error { return nil },
+	)
+	if err == nil || !strings.Contains(err.Error(), "log level") {
+		t.Fatalf("expected invalid log level error, got %v", err)
+	}
+}
+
+func TestRunToolsListsAnnotations(t *testing.T) {
+	var stdout bytes.Buffer
+
+	err := run([]string{"gitlab-mcp-server", "tools"}, func(string) string { return "" }, &stdout, io.Discard,
+		func(*app.Server, bool, string) error {
+			t.Fatal("tools command must not start the server")
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+
+	var deleteLine string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if strings.HasPrefix(line, "delete_old_pipelines ") {
+			deleteLine = line
+		}
+	}
+	if fields := strings.Fields(deleteLine); len(fields) < 4 || fields[len(fields)-4] != "false" || fields[len(fields)-3] != "true" {
+		t.Fatalf("expected delete_old_pipelines to be listed as destructive, got %q", stdout.String())
+	}
+}
+
+func TestRunReadOnlyFromEnvironment(t *testing.T) {
+	env := map[string]string{"GITLAB_MCP_READ_ONLY": "true"}
+
+	err := run([]string{"gitlab-mcp-server", "--demo"}, func(key string) string { return env[key] }, io.Discard, io.Discard,
+		func(srv *app.Server, _ bool, _ string) error {
+			for _, tool := range srv.AvailableTools() {
+				if !tool.ReadOnly {
+					t.Errorf("expected only read-only tools, got %s", tool.Name)
+				}
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+
+	env["GITLAB_MCP_READ_ONLY"] = "sometimes"
+	err = run([]string{"gitlab-mcp-server", "--demo"}, func(key string) string { return env[key] }, io.Discard, io.Discard,
+		func(*app.Server, bool, string) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "GITLAB_MCP_READ_ONLY") {
+		t.Fatalf("expected invalid GITLAB_MCP_READ_ONLY to be rejected, got %v", err)
+	}
+}
+
+func TestRunHTTPRejectsShortAuthTokens(t *testing.T) {
+	env := map[string]string{
+		"GITLAB_ACCESS_TOKEN":    "token",
+		"GITLAB_MCP_AUTH_TOKENS": "letmein",
+	}
+
+	err := run([]string{"gitlab-mcp-server", "--http"}, func(key string) string { return env[key] }, io.Discard, io.Discard,
+		func(*app.Server, bool, string) error {
+			t.Fatal("server must not start with a weak bearer token")
+			return nil
+		},
+	)
+	if err == nil || !strings.Contains(err.Error(), "at least 16 characters") {
+		t.Fatalf("expected a bearer token length error, got %v", err)
+	}
+}
+
+func TestRunPerCallerTokens(t *testing.T) {
+	env := map[string]string{"GITLAB_MCP_PER_CALLER_TOKENS": "true"}
+	getenv := func(key string) string { return env[key] }
+
+	err := run([]string{"gitlab-mcp-server"}, getenv, io.Discard, io.Discard, func(*app.Server, bool, string) error {
+		t.Fatal("server must not start per-caller mode over stdio")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "requires --http") {
+		t.Fatalf("expected per-caller tokens to require HTTP, got %v", err)
+	}
+
+	var started bool
+	err = run([]string{"gitlab-mcp-server", "--http"}, getenv, io.Discard, io.Discard, func(srv *app.Server, useHTTP bool, _ string) error {
+		started = srv != nil && useHTTP
+		return nil
+	})
+	if err != nil || !started {
+		t.Fatalf("expected the HTTP server to start without GITLAB_ACCESS_TOKEN, got %v (started %t)", err, started)
+	}
+}
+
+func TestRunValidatesTLSSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "listener key without cert",
+			args: []string{"--http", "--tls-key", "server.key"},
+			want: "must be set together",
+		},
+		{
+			name: "listener TLS over stdio",
+			env:  map[string]string{"GITLAB_MCP_TLS_CERT": "server.crt", "GITLAB_MCP_TLS_KEY": "server.key"},
+			want: "require --http",
+		},
+		{
+			name: "client cert without key",
+			args: []string{"--gitlab-client-cert", "client.crt"},
+			want: "configured together",
+		},
+		{
+			name: "missing CA file",
+			env:  map[string]string{"GITLAB_CA_FILE": "/nonexistent/ca.pem"},
+			want: "read CA file",
+		},
+		{
+			name: "invalid timeout",
+			env:  map[string]string{"GITLAB_TIMEOUT": "soon"},
+			want: "GITLAB_TIMEOUT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"GITLAB_ACCESS_TOKEN": "token"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+
+			err := run(append([]string{"gitlab-mcp-server"}, tt.args...), func(key string) string { return env[key] }, io.Discard, io.Discard,
+				func(*app.Server, bool, string) error {
+					t.Fatal("server must not start with invalid TLS settings")
+					return nil
+				},
+			)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	serverpkg "github.com/mark3labs/mcp-go/server"
+
+	"github.com/ylchen07/gitlab-mcp-server/internal/audit"
+)
+
+const defaultAuditQueryLimit = 50
+
+// auditedOutput is implemented by the structured outputs of tools that change GitLab so the
+// audit log can record what they touched.
+type auditedOutput interface {
+	auditDetails() (project string, affectedIDs []int, outcome string)
+}
+
+func (o ArchiveProjectOutput) auditDetails() (string, []int, string) {
+	if !o.Success {
+		return o.ProjectPath, nil, audit.OutcomeNotPerformed
+	}
+	return o.ProjectPath, []int{o.ProjectID}, audit.OutcomeSuccess
+}
+
+func (o DeleteOldPipelinesOutput) auditDetails() (string, []int, string) {
+	switch {
+	case !o.Performed:
+		return o.Project, nil, audit.OutcomeNotPerformed
+	case len(o.FailedDeletions) > 0:
+		return o.Project, o.DeletedIDs, audit.OutcomePartial
+	default:
+		return o.Project, o.DeletedIDs, audit.OutcomeSuccess
+	}
+}
+
+func (o DeleteOldGroupPipelinesOutput) auditDetails() (string, []int, string) {
+	if !o.Performed {
+		return o.Group, nil, audit.OutcomeNotPerformed
+	}
+
+	var deleted []int
+	for _, project := range o.Projects {
+		deleted = append(deleted, project.DeletedIDs...)
+	}
+	if o.FailedCount > 0 {
+		return o.Group, deleted, audit.OutcomePartial
+	}
+	return o.Group, deleted, audit.OutcomeSuccess
+}
+
+// withAudit wraps the handler of a mutating tool so every call is recorded in the audit log,
+// whatever its outcome.
+func (s *Server) withAudit(tool string, handler serverpkg.ToolHandlerFunc) serverpkg.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		record := s.auditTarget(ctx, tool, request)
+		result, err := handler(ctx, request)
+		s.recordAudit(ctx, record, result, err)
+		return result, err
+	}
+}
+
+// auditTarget starts the audit record of a call with the project or group it targets. Calls that
+// apply a plan name only its ID, so the plan is looked up before the handler takes it or finds it
+// expired; failed attempts are then still attributed to what they would have deleted.
+func (s *Server) auditTarget(ctx context.Context, tool string, request mcp.CallToolRequest) audit.Record {
+	record := audit.Record{
+		Time:      time.Now(),
+		Tool:      tool,
+		Arguments: request.GetArguments(),
+		Project:   request.GetString("project_id_or_path", request.GetString("group_id_or_path", "")),
+	}
+
+	if planID := strings.TrimSpace(request.GetString("plan_id", "")); planID != "" {
+		if target, pipelineIDs, ok := s.plans.Target(planOwner(ctx), planID); ok {
+			record.Project, record.PlannedIDs = target, pipelineIDs
+		}
+	}
+
+	return record
+}
+
+func (s *Server) recordAudit(ctx context.Context, record audit.Record, result *mcp.CallToolResult, callErr error) {
+	tool := record.Tool
+
+	if session := serverpkg.ClientSessionFromContext(ctx); session != nil {
+		record.SessionID = session.SessionID()
+		if withInfo, ok := session.(serverpkg.SessionWithClientInfo); ok {
+			info := withInfo.GetClientInfo()
+			record.Client = strings.TrimSpace(info.Name + " " + info.Version)
+		}
+	}
+
+	switch {
+	case callErr != nil:
+		record.Outcome = audit.OutcomeError
+		record.Error = callErr.Error()
+	case result == nil:
+		record.Outcome = audit.OutcomeError
+	case result.IsError:
+		record.Outcome = audit.OutcomeError
+		if toolErr, ok := result.StructuredContent.(ToolError); ok {
+			record.Error = toolErr.Message
+		}
+	default:
+		if output, ok := result.StructuredContent.(auditedOutput); ok {
+			record.Project, record.AffectedIDs, record.Outcome = output.auditDetails()
+		} else {
+			record.Outcome = audit.OutcomeSuccess
+		}
+	}
+
+	// Preflight has usually just looked the identity up, so this rarely costs a request.
+	if identity, err := s.service(ctx).CachedIdentity(ctx); err != nil {
+		s.logger.WarnContext(ctx, "could not resolve GitLab user for audit record", "tool", tool, "error", err)
+	} else {
+		record.GitLabUser = identity.Username
+	}
+
+	if err := s.audit.Write(record); err != nil {
+		s.logger.ErrorContext(ctx, "failed to write audit record", "tool", tool, "error", err)
+	}
+}
+
+func (s *Server) handleQueryAuditLog(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query := audit.Query{
+		Tool:       strings.TrimSpace(request.GetString("tool", "")),
+		Project:    strings.TrimSpace(request.GetString("project", "")),
+		Outcome:    strings.TrimSpace(request.GetString("outcome", "")),
+		SessionID:  strings.TrimSpace(request.GetString("session_id", "")),
+		AffectedID: request.GetInt("affected_id", 0),
+		Limit:      request.GetInt("limit", defaultAuditQueryLimit),
+	}
+
+	if query.Limit < 0 {
+		return validationError("limit cannot be negative"), nil
+	}
+
+	for name, target := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		value := strings.TrimSpace(request.GetString(name, ""))
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return validationError("%s must be an RFC 3339 timestamp: %v", name, err), nil
+		}
+		*target = parsed
+	}
+
+	records, truncated, err := s.audit.Query(query)
+	if err != nil {
+		return toolError("Error reading audit log", err), nil
+	}
+
+	output := AuditLogOutput{
+		Path:      s.audit.Path(),
+		Count:     len(records),
+		Truncated: truncated,
+		Records:   nonNil(records),
+	}
+
+	summary := fmt.Sprintf("Found %d audit records", output.Count)
+	if truncated {
+		summary += fmt.Sprintf(" (showing the most recent %d; narrow the query or raise limit to see more)", query.Limit)
+	}
+
+	return structuredResult(summary+".", output), nil
+}
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+
+	serverpkg "github.com/mark3labs/mcp-go/server"
+
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab"
+)
+
+// CallerTokenHeader is the HTTP header through which callers supply their own GitLab token when
+// the server runs with per-caller tokens.
+const CallerTokenHeader = "X-GitLab-Token"
+
+// DefaultCallerCacheSize is the number of per-caller GitLab services kept when no explicit cache
+// size is configured.
+const DefaultCallerCacheSize = 100
+
+// ServiceFactory builds a GitLab service that authenticates with token.
+type ServiceFactory func(token string) (*gitlab.Service, error)
+
+type serviceContextKey struct{}
+
+// callerContextKey carries the hex-encoded hash of the caller's GitLab token in per-caller mode.
+type callerContextKey struct{}
+
+// service returns the GitLab service for the current call: the caller's own in per-caller mode,
+// otherwise the one the Server was created with.
+func (s *Server) service(ctx context.Context) *gitlab.Service {
+	if service, ok := ctx.Value(serviceContextKey{}).(*gitlab.Service); ok {
+		return service
+	}
+	return s.gitlab
+}
+
+// planOwner identifies who may apply the deletion plans created by the current call: the
+// caller's GitLab token in per-caller mode, otherwise the MCP session.
+func planOwner(ctx context.Context) string {
+	if caller, ok := ctx.Value(callerContextKey{}).(string); ok {
+		return "token:" + caller
+	}
+	if session := serverpkg.ClientSessionFromContext(ctx); session != nil {
+		return "session:" + session.SessionID()
+	}
+	return ""
+}
+
+// requireCallerToken resolves the GitLab service for the token in CallerTokenHeader and passes
+// it to next through the request context. Requests without a token, or whose token GitLab
+// rejects, never reach next. Services are cached by token hash so the token itself is not kept
+// as a map key, and a token is only cached once GitLab has accepted it.
+func (s *Server) requireCallerToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		token := strings.TrimSpace(r.Header.Get(CallerTokenHeader))
+		if token == "" {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": CallerTokenHeader + " header is required"})
+			return
+		}
+
+		key := sha256.Sum256([]byte(token))
+		service, ok := s.callers.get(key)
+		if !ok {
+			var err error
+			service, err = s.newService(token)
+			if err != nil {
+				s.logger.ErrorContext(ctx, "failed to create GitLab client for caller", "error", err)
+				writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "could not create GitLab client"})
+				return
+			}
+
+			if _, err := service.CurrentUser(ctx); err != nil {
+				category, _ := gitlab.ClassifyError(err)
+				s.logger.WarnContext(ctx, "rejected caller GitLab token", "category", category, "error", err,
+					"remote_addr", r.RemoteAddr)
+
+				status := http.StatusBadGateway
+				if category == gitlab.ErrorCategoryUnauthorized || category == gitlab.ErrorCategoryForbidden {
+					status = http.StatusUnauthorized
+				}
+				writeJSON(w, status, map[string]string{"error": "GitLab did not accept the token: " + string(category)})
+				return
+			}
+
+			s.callers.add(key, service)
+		}
+
+		ctx = context.WithValue(ctx, serviceContextKey{}, service)
+		ctx = context.WithValue(ctx, callerContextKey{}, hex.EncodeToString(key[:]))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// serviceCache is a fixed-size, least-recently-used cache of GitLab services keyed by token hash.
+type serviceCache struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // of *serviceCacheEntry, most recently used first
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type serviceCacheEntry struct {
+	key     [sha256.Size]byte
+	service *gitlab.Service
+}
+
+func newServiceCache(size int) *serviceCache {
+	if size <= 0 {
+		size = DefaultCallerCacheSize
+	}
+
+	return &serviceCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+func (c *serviceCache) get(key [sha256.Size]byte) (*gitlab.Service, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+
+	return element.Value.(*serviceCacheEntry).service, true
+}
+
+// add stores service under key, evicting the least recently used entry when the cache is full.
+func (c *serviceCache) add(key [sha256.Size]byte, service *gitlab.Service) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*serviceCacheEntry).service = service
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&serviceCacheEntry{key: key, service: service})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*serviceCacheEntry).key)
+	}
+}
+
+func (c *serviceCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
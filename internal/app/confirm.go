@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	serverpkg "github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// ConfirmedViaElicitation records that a human approved the action through MCP elicitation.
+	ConfirmedViaElicitation = "elicitation"
+	// ConfirmedViaArgument records that the action was approved by the tool's confirm argument.
+	ConfirmedViaArgument = "confirm_argument"
+)
+
+// confirmation is the outcome of asking for approval of a destructive action.
+type confirmation struct {
+	// Approved reports whether the action may run.
+	Approved bool
+	// Via is ConfirmedViaElicitation or ConfirmedViaArgument when approved.
+	Via string
+	// Reason explains, in a sentence, why the action was not approved.
+	Reason string
+}
+
+// confirmDestructive asks for approval of the destructive action described by prompt. Clients that
+// declared the elicitation capability ask the human directly and the confirm argument is ignored;
+// otherwise the confirm argument decides, unless the server requires elicitation. Errors are only
+// returned when the elicitation request itself fails.
+func (s *Server) confirmDestructive(ctx context.Context, request mcp.CallToolRequest, prompt string) (confirmation, error) {
+	session, ok := elicitationSession(ctx)
+	if !ok {
+		if s.requireElicitation {
+			return confirmation{
+				Reason: "this server requires confirmation through MCP elicitation, which the client does not support",
+			}, nil
+		}
+
+		if !request.GetBool("confirm", false) {
+			return confirmation{Reason: "set confirm=true to proceed"}, nil
+		}
+
+		return confirmation{Approved: true, Via: ConfirmedViaArgument}, nil
+	}
+
+	result, err := session.RequestElicitation(ctx, mcp.ElicitationRequest{
+		Params: mcp.ElicitationParams{
+			Message: prompt,
+			RequestedSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"confirm": map[string]any{
+						"type":        "boolean",
+						"title":       "Proceed",
+						"description": "Approve this irreversible action",
+					},
+				},
+				"required": []string{"confirm"},
+			},
+		},
+	})
+	if err != nil {
+		return confirmation{}, fmt.Errorf("request confirmation: %w", err)
+	}
+
+	if result.Action != mcp.ElicitationResponseActionAccept {
+		return confirmation{Reason: fmt.Sprintf("the user responded %q to the confirmation request", result.Action)}, nil
+	}
+
+	content, _ := result.Content.(map[string]any)
+	if approved, _ := content["confirm"].(bool); !approved {
+		return confirmation{Reason: "the user did not approve the confirmation request"}, nil
+	}
+
+	return confirmation{Approved: true, Via: ConfirmedViaElicitation}, nil
+}
+
+// elicitationSession returns the calling session when its client declared support for elicitation.
+func elicitationSession(ctx context.Context) (serverpkg.SessionWithElicitation, bool) {
+	session := serverpkg.ClientSessionFromContext(ctx)
+
+	withInfo, ok := session.(serverpkg.SessionWithClientInfo)
+	if !ok || withInfo.GetClientCapabilities().Elicitation == nil {
+		return nil, false
+	}
+
+	withElicitation, ok := session.(serverpkg.SessionWithElicitation)
+	return withElicitation, ok
+}
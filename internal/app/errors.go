@@ -0,0 +1,44 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab"
+)
+
+// ToolError is the structured content attached to failed tool calls so clients can branch
+// on the kind of failure without parsing the message.
+type ToolError struct {
+	Category   gitlab.ErrorCategory `json:"category"`
+	Message    string               `json:"message"`
+	StatusCode int                  `json:"status_code,omitempty"`
+}
+
+// toolError reports a failed GitLab operation as an MCP error result. The category is derived
+// from the GitLab response status wrapped in err.
+func toolError(action string, err error) *mcp.CallToolResult {
+	category, status := gitlab.ClassifyError(err)
+
+	return errorResult(ToolError{
+		Category:   category,
+		Message:    fmt.Sprintf("%s: %v", action, err),
+		StatusCode: status,
+	})
+}
+
+// validationError reports invalid tool arguments as an MCP error result.
+func validationError(format string, args ...any) *mcp.CallToolResult {
+	return errorResult(ToolError{
+		Category: gitlab.ErrorCategoryValidation,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func errorResult(toolErr ToolError) *mcp.CallToolResult {
+	result := mcp.NewToolResultError(fmt.Sprintf("[%s] %s", toolErr.Category, toolErr.Message))
+	result.StructuredContent = toolErr
+
+	return result
+}
@@ -0,0 +1,267 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab"
+)
+
+// cutoffArguments are the mutually exclusive ways to set the cutoff of a pipeline cleanup.
+var cutoffArguments = []string{"older_than", "older_than_years", "before"}
+
+// isoDuration matches ISO 8601 durations such as P90D, P1Y6M or PT36H.
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// pipelineCleanupArguments declares the filter and retention arguments shared by the tools that
+// plan pipeline cleanups. pipelineFilter and retentionPolicy read them.
+func pipelineCleanupArguments() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithString("older_than",
+			mcp.Description("Age threshold as an ISO 8601 duration (P90D, P1Y6M) or Go duration (2160h); pipelines created before this long ago are included. Pass exactly one of older_than, older_than_years or before"),
+		),
+		mcp.WithNumber("older_than_years",
+			mcp.Description("Age threshold in whole years; pipelines created before this many years ago are included"),
+		),
+		mcp.WithString("before",
+			mcp.Description("Absolute cutoff as an RFC 3339 timestamp or date (2024-01-31); pipelines created before it are included"),
+		),
+		mcp.WithString("after",
+			mcp.Description("Optional RFC 3339 timestamp or date; pipelines created before it are excluded, limiting the listing to a window"),
+		),
+		mcp.WithArray("statuses",
+			mcp.Description("Only pipelines in one of these states, e.g. failed and canceled"),
+			mcp.WithStringEnumItems(gitlab.PipelineStatuses),
+		),
+		mcp.WithArray("sources",
+			mcp.Description("Only pipelines started by one of these sources, e.g. merge_request_event or schedule"),
+			mcp.WithStringEnumItems(gitlab.PipelineSources),
+		),
+		mcp.WithArray("refs",
+			mcp.Description("Only pipelines whose ref matches one of these globs; * matches anything including slashes, e.g. feature/* or refs/merge-requests/*"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("username",
+			mcp.Description("Only pipelines triggered by this GitLab username"),
+		),
+		mcp.WithBoolean("ref_deleted",
+			mcp.Description("Only pipelines whose branch or tag no longer exists; merge request pipelines count once the merge request or its source branch is gone. Costs one or two API calls per distinct ref"),
+		),
+		mcp.WithNumber("keep_latest_per_ref",
+			mcp.Description("Keep the N most recent pipelines of every ref, whatever their age, so dormant branches keep their last pipelines; 0 disables the rule"),
+			mcp.Min(0),
+		),
+		mcp.WithBoolean("keep_latest_successful",
+			mcp.Description("Keep the most recent successful pipeline on the default branch and on every tag"),
+		),
+		mcp.WithBoolean("keep_deployments",
+			mcp.Description("Keep pipelines that deployed to an environment"),
+		),
+	}
+}
+
+// pipelineFilter reads the filter arguments declared by pipelineCleanupArguments. Exactly one of
+// older_than, older_than_years or before sets the cutoff, after optionally bounds the window from
+// below, and the remaining arguments narrow the listing further. Relative ages are measured back
+// from now.
+func pipelineFilter(request mcp.CallToolRequest, now time.Time) (gitlab.PipelineFilter, error) {
+	args := request.GetArguments()
+
+	var given []string
+	for _, name := range cutoffArguments {
+		if argumentGiven(args, name) {
+			given = append(given, name)
+		}
+	}
+	switch len(given) {
+	case 0:
+		return gitlab.PipelineFilter{}, fmt.Errorf("one of %s is required", strings.Join(cutoffArguments, ", "))
+	case 1:
+	default:
+		return gitlab.PipelineFilter{}, fmt.Errorf("%s cannot be combined; pass only one", strings.Join(given, " and "))
+	}
+
+	var filter gitlab.PipelineFilter
+	switch given[0] {
+	case "older_than_years":
+		years, err := request.RequireInt("older_than_years")
+		if err != nil {
+			return filter, fmt.Errorf("older_than_years must be a whole number: %v", err)
+		}
+		if years <= 0 {
+			return filter, fmt.Errorf("older_than_years must be greater than zero")
+		}
+		filter.CreatedBefore = now.AddDate(-years, 0, 0)
+	case "older_than":
+		cutoff, err := ageCutoff(request.GetString("older_than", ""), now)
+		if err != nil {
+			return filter, err
+		}
+		filter.CreatedBefore = cutoff
+	case "before":
+		before, err := parseTimestamp("before", request.GetString("before", ""))
+		if err != nil {
+			return filter, err
+		}
+		if before.After(now) {
+			return filter, fmt.Errorf("before must not be in the future")
+		}
+		filter.CreatedBefore = before
+	}
+
+	if value := strings.TrimSpace(request.GetString("after", "")); value != "" {
+		after, err := parseTimestamp("after", value)
+		if err != nil {
+			return filter, err
+		}
+		if !after.Before(filter.CreatedBefore) {
+			return filter, fmt.Errorf("after must be earlier than the cutoff %s", filter.CreatedBefore.Format(time.RFC3339))
+		}
+		filter.CreatedAfter = after
+	}
+
+	filter.Statuses = cleanStrings(request.GetStringSlice("statuses", nil))
+	filter.Sources = cleanStrings(request.GetStringSlice("sources", nil))
+	filter.Refs = cleanStrings(request.GetStringSlice("refs", nil))
+	filter.Username = strings.TrimPrefix(strings.TrimSpace(request.GetString("username", "")), "@")
+	filter.RefDeleted = request.GetBool("ref_deleted", false)
+
+	return filter, filter.Validate()
+}
+
+// argumentGiven reports whether the argument has a value. Clients that fill in every field of a
+// form send null or "" for the ones left empty, which count as absent.
+func argumentGiven(args map[string]any, name string) bool {
+	switch value := args[name].(type) {
+	case nil:
+		return false
+	case string:
+		return strings.TrimSpace(value) != ""
+	default:
+		return true
+	}
+}
+
+// cleanStrings trims each value and drops empty ones.
+func cleanStrings(values []string) []string {
+	var cleaned []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			cleaned = append(cleaned, value)
+		}
+	}
+	return cleaned
+}
+
+// retentionPolicy reads the retention arguments declared by pipelineCleanupArguments.
+func retentionPolicy(request mcp.CallToolRequest) (gitlab.RetentionPolicy, error) {
+	policy := gitlab.RetentionPolicy{
+		KeepLatestPerRef:     request.GetInt("keep_latest_per_ref", 0),
+		KeepLatestSuccessful: request.GetBool("keep_latest_successful", false),
+		KeepDeployments:      request.GetBool("keep_deployments", false),
+	}
+	if policy.KeepLatestPerRef < 0 {
+		return policy, fmt.Errorf("keep_latest_per_ref cannot be negative")
+	}
+
+	return policy, nil
+}
+
+// ageCutoff returns the time the age value before now. The value is an ISO 8601 duration such as
+// P90D, whose years, months, weeks and days are calendar units like older_than_years, or a Go
+// duration such as 2160h.
+func ageCutoff(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	upper := strings.ToUpper(value)
+
+	if match := isoDuration.FindStringSubmatch(upper); match != nil && strings.Join(match[1:], "") != "" && !strings.HasSuffix(upper, "T") {
+		var parts [7]int
+		for i, part := range match[1:] {
+			if part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("older_than %q is too large", value)
+			}
+			parts[i] = n
+		}
+
+		clock := time.Duration(0)
+		for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+			n := parts[4+i]
+			if int64(n) > (math.MaxInt64-int64(clock))/int64(unit) {
+				return time.Time{}, fmt.Errorf("older_than %q is too large", value)
+			}
+			clock += time.Duration(n) * unit
+		}
+
+		cutoff := now.AddDate(-parts[0], -parts[1], -(7*parts[2] + parts[3])).Add(-clock)
+		if !cutoff.Before(now) {
+			return time.Time{}, fmt.Errorf("older_than must be greater than zero")
+		}
+		return cutoff, nil
+	}
+
+	age, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("older_than must be an ISO 8601 duration such as P90D or a Go duration such as 2160h, got %q", value)
+	}
+	if age <= 0 {
+		return time.Time{}, fmt.Errorf("older_than must be greater than zero")
+	}
+
+	return now.Add(-age), nil
+}
+
+// parseTimestamp parses an RFC 3339 timestamp or a bare date, which means midnight UTC.
+func parseTimestamp(name, value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	if parsed, err := time.Parse(time.DateOnly, value); err == nil {
+		return parsed, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp or a date such as 2024-01-31, got %q", name, value)
+	}
+
+	return parsed.UTC(), nil
+}
+
+// describeFilter phrases filter for tool summaries, e.g. "created before 2024-01-01T00:00:00Z
+// with status failed on refs matching feature/*".
+func describeFilter(filter gitlab.PipelineFilter) string {
+	var b strings.Builder
+	if filter.CreatedAfter.IsZero() {
+		b.WriteString("created before " + filter.CreatedBefore.Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(&b, "created between %s and %s",
+			filter.CreatedAfter.Format(time.RFC3339), filter.CreatedBefore.Format(time.RFC3339))
+	}
+
+	if len(filter.Statuses) > 0 {
+		b.WriteString(" with status " + strings.Join(filter.Statuses, " or "))
+	}
+	if len(filter.Sources) > 0 {
+		b.WriteString(" from source " + strings.Join(filter.Sources, " or "))
+	}
+	if len(filter.Refs) > 0 {
+		b.WriteString(" on refs matching " + strings.Join(filter.Refs, " or "))
+	}
+	if filter.Username != "" {
+		b.WriteString(" triggered by " + filter.Username)
+	}
+	if filter.RefDeleted {
+		b.WriteString(" whose ref no longer exists")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"time"
+
+	"github.com/ylchen07/gitlab-mcp-server/internal/audit"
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab"
+)
+
+// HealthCheckOutput is the structured result of the health_check tool.
+type HealthCheckOutput struct {
+	Status    string              `json:"status"`
+	Timestamp string              `json:"timestamp"`
+	Server    string              `json:"server"`
+	Version   string              `json:"version"`
+	GitLab    gitlab.HealthReport `json:"gitlab"`
+}
+
+// WhoAmIOutput is the structured result of the whoami tool.
+type WhoAmIOutput struct {
+	Identity gitlab.Identity `json:"identity"`
+	Project  *gitlab.Access  `json:"project,omitempty"`
+	Group    *gitlab.Access  `json:"group,omitempty"`
+}
+
+// ProjectListOutput is the structured result of the project listing tools.
+type ProjectListOutput struct {
+	Group           string                   `json:"group"`
+	Count           int                      `json:"count"`
+	Truncated       bool                     `json:"truncated"`
+	Projects        []gitlab.Project         `json:"projects"`
+	FailedSubgroups []gitlab.SubgroupFailure `json:"failed_subgroups,omitempty"`
+}
+
+// SubgroupListOutput is the structured result of the list_subgroups tool.
+type SubgroupListOutput struct {
+	Group     string            `json:"group"`
+	Count     int               `json:"count"`
+	Truncated bool              `json:"truncated"`
+	Subgroups []gitlab.Subgroup `json:"subgroups"`
+}
+
+// ArchiveProjectOutput is the structured result of the archive_project tool.
+type ArchiveProjectOutput struct {
+	Success           bool   `json:"success"`
+	ProjectID         int    `json:"project_id"`
+	ProjectName       string `json:"project_name"`
+	ProjectPath       string `json:"project_path"`
+	Archived          bool   `json:"archived"`
+	WebURL            string `json:"web_url"`
+	ArchivedTimestamp string `json:"archived_timestamp,omitempty"`
+	ConfirmedVia      string `json:"confirmed_via,omitempty"`
+}
+
+// NamespaceOutput describes the namespace a project belongs to.
+type NamespaceOutput struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	FullPath string `json:"full_path"`
+	Kind     string `json:"kind"`
+}
+
+// ProjectStatusOutput is the structured result of the get_project_status tool.
+type ProjectStatusOutput struct {
+	ID                int              `json:"id"`
+	Name              string           `json:"name"`
+	Path              string           `json:"path"`
+	PathWithNamespace string           `json:"path_with_namespace"`
+	Description       string           `json:"description"`
+	WebURL            string           `json:"web_url"`
+	CloneURLHTTP      string           `json:"clone_url_http"`
+	CloneURLSSH       string           `json:"clone_url_ssh"`
+	Visibility        string           `json:"visibility"`
+	Archived          bool             `json:"archived"`
+	CreatedAt         *time.Time       `json:"created_at,omitempty"`
+	LastActivityAt    *time.Time       `json:"last_activity_at,omitempty"`
+	DefaultBranch     string           `json:"default_branch"`
+	ForksCount        int              `json:"forks_count"`
+	StarCount         int              `json:"star_count"`
+	OpenIssuesCount   int              `json:"open_issues_count"`
+	Topics            []string         `json:"topics"`
+	ReadmeURL         string           `json:"readme_url"`
+	Namespace         *NamespaceOutput `json:"namespace,omitempty"`
+	Size              *int64           `json:"size,omitempty"`
+	CommitCount       *int64           `json:"commit_count,omitempty"`
+	StorageSize       *int64           `json:"storage_size,omitempty"`
+}
+
+// PipelineFilterOutput echoes the filters that selected the pipelines of a listing or plan.
+type PipelineFilterOutput struct {
+	Cutoff     string   `json:"cutoff"`
+	After      string   `json:"after,omitempty"`
+	Statuses   []string `json:"statuses,omitempty"`
+	Sources    []string `json:"sources,omitempty"`
+	Refs       []string `json:"refs,omitempty"`
+	Username   string   `json:"username,omitempty"`
+	RefDeleted bool     `json:"ref_deleted,omitempty"`
+}
+
+func newPipelineFilterOutput(filter gitlab.PipelineFilter) PipelineFilterOutput {
+	output := PipelineFilterOutput{
+		Cutoff:     filter.CreatedBefore.Format(time.RFC3339),
+		Statuses:   filter.Statuses,
+		Sources:    filter.Sources,
+		Refs:       filter.Refs,
+		Username:   filter.Username,
+		RefDeleted: filter.RefDeleted,
+	}
+	if !filter.CreatedAfter.IsZero() {
+		output.After = filter.CreatedAfter.Format(time.RFC3339)
+	}
+
+	return output
+}
+
+// OldPipelinesOutput is the structured result of the list_old_pipelines tool.
+type OldPipelinesOutput struct {
+	Project string `json:"project"`
+	PipelineFilterOutput
+	OlderThan      string                     `json:"older_than,omitempty"`
+	OlderThanYears int                        `json:"older_than_years,omitempty"`
+	Count          int                        `json:"count"`
+	Truncated      bool                       `json:"truncated"`
+	Pipelines      []gitlab.PipelineSummary   `json:"pipelines"`
+	Retention      *gitlab.RetentionPolicy    `json:"retention,omitempty"`
+	KeptCount      int                        `json:"kept_count"`
+	Kept           []gitlab.RetentionDecision `json:"kept,omitempty"`
+	PlanID         string                     `json:"plan_id,omitempty"`
+	Checksum       string                     `json:"checksum,omitempty"`
+	PlanExpiresAt  string                     `json:"plan_expires_at,omitempty"`
+}
+
+// DeleteOldPipelinesOutput is the structured result of the delete_old_pipelines tool.
+type DeleteOldPipelinesOutput struct {
+	PlanID   string `json:"plan_id"`
+	Checksum string `json:"checksum"`
+	Project  string `json:"project"`
+	PipelineFilterOutput
+	Performed       bool                           `json:"performed"`
+	ConfirmedVia    string                         `json:"confirmed_via,omitempty"`
+	TotalCandidates int                            `json:"total_candidates"`
+	DeletedCount    int                            `json:"deleted_count"`
+	DeletedIDs      []int                          `json:"deleted_ids"`
+	FailedDeletions []gitlab.PipelineDeletionError `json:"failed_deletions,omitempty"`
+	SkippedIDs      []int                          `json:"skipped_ids,omitempty"`
+}
+
+// GroupProjectPipelinesOutput summarises the cleanup planned for one project of a group.
+type GroupProjectPipelinesOutput struct {
+	Project     string `json:"project"`
+	Count       int    `json:"count"`
+	KeptCount   int    `json:"kept_count"`
+	Truncated   bool   `json:"truncated"`
+	PipelineIDs []int  `json:"pipeline_ids,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// OldGroupPipelinesOutput is the structured result of the list_old_group_pipelines tool.
+type OldGroupPipelinesOutput struct {
+	Group string `json:"group"`
+	PipelineFilterOutput
+	OlderThan          string                        `json:"older_than,omitempty"`
+	OlderThanYears     int                           `json:"older_than_years,omitempty"`
+	Retention          *gitlab.RetentionPolicy       `json:"retention,omitempty"`
+	SkipArchived       bool                          `json:"skip_archived"`
+	ProjectCount       int                           `json:"project_count"`
+	FailedProjectCount int                           `json:"failed_project_count"`
+	Count              int                           `json:"count"`
+	KeptCount          int                           `json:"kept_count"`
+	Truncated          bool                          `json:"truncated"`
+	TruncatedProjects  []string                      `json:"truncated_projects,omitempty"`
+	Projects           []GroupProjectPipelinesOutput `json:"projects"`
+	FailedSubgroups    []gitlab.SubgroupFailure      `json:"failed_subgroups,omitempty"`
+	PlanID             string                        `json:"plan_id,omitempty"`
+	Checksum           string                        `json:"checksum,omitempty"`
+	PlanExpiresAt      string                        `json:"plan_expires_at,omitempty"`
+}
+
+// GroupProjectDeletionOutput reports the deletion in one project of a group plan.
+type GroupProjectDeletionOutput struct {
+	Project         string                         `json:"project"`
+	TotalCandidates int                            `json:"total_candidates"`
+	DeletedCount    int                            `json:"deleted_count"`
+	DeletedIDs      []int                          `json:"deleted_ids"`
+	FailedDeletions []gitlab.PipelineDeletionError `json:"failed_deletions,omitempty"`
+	SkippedIDs      []int                          `json:"skipped_ids,omitempty"`
+	Error           string                         `json:"error,omitempty"`
+}
+
+// DeleteOldGroupPipelinesOutput is the structured result of the delete_old_group_pipelines tool.
+type DeleteOldGroupPipelinesOutput struct {
+	PlanID   string `json:"plan_id"`
+	Checksum string `json:"checksum"`
+	Group    string `json:"group"`
+	PipelineFilterOutput
+	Performed       bool                         `json:"performed"`
+	ConfirmedVia    string                       `json:"confirmed_via,omitempty"`
+	ProjectCount    int                          `json:"project_count"`
+	TotalCandidates int                          `json:"total_candidates"`
+	DeletedCount    int                          `json:"deleted_count"`
+	FailedCount     int                          `json:"failed_count"`
+	SkippedCount    int                          `json:"skipped_count"`
+	Projects        []GroupProjectDeletionOutput `json:"projects"`
+}
+
+// AuditLogOutput is the structured result of the query_audit_log tool.
+type AuditLogOutput struct {
+	Path      string         `json:"path"`
+	Count     int            `json:"count"`
+	Truncated bool           `json:"truncated"`
+	Records   []audit.Record `json:"records"`
+}
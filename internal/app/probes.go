@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab"
+)
+
+// readinessTimeout bounds how long /readyz waits for GitLab before reporting the server unready.
+const readinessTimeout = 10 * time.Second
+
+// registerHTTPHandlers routes MCP traffic and the health probes served by RunHTTP. With bearer
+// auth configured, MCP requests must authenticate; the probes stay open for orchestrators. In
+// per-caller mode MCP requests must also carry a GitLab token.
+func (s *Server) registerHTTPHandlers(mux *http.ServeMux, mcpHandler http.Handler) {
+	if s.callers != nil {
+		mcpHandler = s.requireCallerToken(mcpHandler)
+	}
+	if s.auth != nil {
+		mcpHandler = s.auth.Require(mcpHandler, s.logger)
+	}
+
+	mux.Handle("/mcp", mcpHandler)
+	mux.HandleFunc("GET /healthz", s.handleLiveness)
+	mux.HandleFunc("GET /readyz", s.handleReadiness)
+}
+
+// handleLiveness reports that the process is up and serving requests. It does not contact
+// GitLab, so an outage there does not get the server restarted.
+func (s *Server) handleLiveness(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadiness runs the GitLab health check and answers 503 when GitLab is unhealthy, so load
+// balancers stop routing to a server that cannot reach GitLab. Degraded still counts as ready.
+// When bearer auth is configured, only authenticated requests see the full report, since it
+// names the GitLab user and token.
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	// Without a server-wide token GitLab can only be checked with each caller's token.
+	if s.gitlab == nil {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	report := s.gitlab.CheckHealth(ctx)
+
+	status := http.StatusOK
+	if report.Status == gitlab.HealthUnhealthy {
+		status = http.StatusServiceUnavailable
+		s.logger.WarnContext(ctx, "readiness check failed", "problems", report.Problems)
+	}
+
+	if s.auth != nil && !s.auth.Authenticate(r) {
+		writeJSON(w, status, map[string]gitlab.HealthStatus{"status": report.Status})
+		return
+	}
+
+	writeJSON(w, status, report)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"context"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab"
+)
+
+// progressReporter returns a ProgressFunc that sends notifications/progress to the caller of
+// request, using describe to build each message. It returns nil when the caller did not supply
+// a progress token, so the service skips progress bookkeeping entirely.
+func (s *Server) progressReporter(ctx context.Context, request mcp.CallToolRequest, describe func(gitlab.Progress) string) gitlab.ProgressFunc {
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return nil
+	}
+
+	token := request.Params.Meta.ProgressToken
+
+	return func(progress gitlab.Progress) {
+		params := map[string]any{
+			"progressToken": token,
+			"progress":      progress.Completed,
+			"total":         progress.Total,
+			"message":       describe(progress),
+		}
+
+		// Progress is advisory; a client that went away should not fail the operation.
+		if err := s.mcpServer.SendNotificationToClient(ctx, "notifications/progress", params); err != nil {
+			s.logger.Debug("failed to send progress notification", "error", err)
+		}
+	}
+}
@@ -3,12 +3,17 @@ package app
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/ylchen07/gitlab-mcp-server/internal/audit"
+	"github.com/ylchen07/gitlab-mcp-server/internal/auth"
 	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab"
+	"github.com/ylchen07/gitlab-mcp-server/internal/logging"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	serverpkg "github.com/mark3labs/mcp-go/server"
@@ -19,32 +24,129 @@ const (
 	serverVersion = "1.0.0"
 )
 
-// ToolInfo describes an MCP tool that has been registered with the server.
+// ToolInfo describes an MCP tool that has been registered with the server, including the
+// behavioural hints advertised to clients in its annotations.
 type ToolInfo struct {
 	Name        string
+	Title       string
 	Description string
+	ReadOnly    bool
+	Destructive bool
+	Idempotent  bool
+	OpenWorld   bool
 }
 
 // Server coordinates MCP tool registration and request handling for the GitLab integration.
 type Server struct {
 	mcpServer *serverpkg.MCPServer
 	gitlab    *gitlab.Service
-	logger    *log.Logger
+	logger    *slog.Logger
 	tools     []ToolInfo
+	planTTL   time.Duration
+	plans     *gitlab.PlanStore
+
+	requireElicitation bool
+	toolFilter         ToolFilter
+	audit              *audit.Log
+	auth               *auth.Bearer
+	newService         ServiceFactory
+	callers            *serviceCache
+	tlsCertFile        string
+	tlsKeyFile         string
+}
+
+// ServerOption customises a Server created by NewServer.
+type ServerOption func(*Server)
+
+// WithPlanTTL sets how long pipeline deletion plans returned by list_old_pipelines and
+// list_old_group_pipelines remain valid.
+// Values below or equal to zero fall back to gitlab.DefaultPlanTTL.
+func WithPlanTTL(ttl time.Duration) ServerOption {
+	return func(s *Server) {
+		if ttl > 0 {
+			s.planTTL = ttl
+		}
+	}
+}
+
+// WithRequireElicitation refuses destructive tool calls from clients that cannot confirm them
+// with the human through MCP elicitation, instead of accepting the tool's confirm argument.
+func WithRequireElicitation(require bool) ServerOption {
+	return func(s *Server) {
+		s.requireElicitation = require
+	}
+}
+
+// WithToolFilter limits the tools the server registers. Validate the filter before use; unknown
+// names are otherwise ignored.
+func WithToolFilter(filter ToolFilter) ServerOption {
+	return func(s *Server) {
+		s.toolFilter = filter
+	}
+}
+
+// WithAuditLog records every call to a tool that changes GitLab in log and registers the
+// query_audit_log tool to search it.
+func WithAuditLog(log *audit.Log) ServerOption {
+	return func(s *Server) {
+		s.audit = log
+	}
+}
+
+// WithBearerAuth requires HTTP clients to authenticate with one of bearer's tokens before their
+// requests reach the MCP server. It has no effect on the stdio transport.
+func WithBearerAuth(bearer *auth.Bearer) ServerOption {
+	return func(s *Server) {
+		s.auth = bearer
+	}
+}
+
+// WithTLS makes RunHTTP serve HTTPS with the PEM certificate and key in certFile and keyFile.
+func WithTLS(certFile, keyFile string) ServerOption {
+	return func(s *Server) {
+		s.tlsCertFile = certFile
+		s.tlsKeyFile = keyFile
+	}
+}
+
+// WithPerCallerTokens makes every HTTP request supply its own GitLab token in the
+// CallerTokenHeader header, so tool calls run with that caller's permissions. newService builds
+// the service for a token; at most cacheSize services are kept, evicting the least recently
+// used. Values below one fall back to DefaultCallerCacheSize. The service passed to NewServer,
+// which may then be nil, is only used for /readyz.
+func WithPerCallerTokens(newService ServiceFactory, cacheSize int) ServerOption {
+	return func(s *Server) {
+		s.newService = newService
+		s.callers = newServiceCache(cacheSize)
+	}
 }
 
 // NewServer constructs a Server backed by the provided GitLab service and logger.
-func NewServer(service *gitlab.Service, logger *log.Logger) *Server {
+func NewServer(service *gitlab.Service, logger *slog.Logger, opts ...ServerOption) *Server {
 	if logger == nil {
-		logger = log.Default()
+		logger = slog.Default()
 	}
 
+	// WithLogging advertises the logging capability and handles logging/setLevel; records
+	// reach clients through the session-aware handler built by the logging package.
+	mcpServer := serverpkg.NewMCPServer(serverName, serverVersion,
+		serverpkg.WithToolCapabilities(false),
+		serverpkg.WithLogging(),
+		serverpkg.WithElicitation(),
+	)
+
 	s := &Server{
-		mcpServer: serverpkg.NewMCPServer(serverName, serverVersion, serverpkg.WithToolCapabilities(false)),
+		mcpServer: mcpServer,
 		gitlab:    service,
 		logger:    logger,
+		planTTL:   gitlab.DefaultPlanTTL,
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
 
+	s.plans = gitlab.NewPlanStore(s.planTTL)
 	s.registerTools()
 
 	return s
@@ -55,60 +157,144 @@ func (s *Server) AvailableTools() []ToolInfo {
 	return append([]ToolInfo(nil), s.tools...)
 }
 
-// RunStdio starts the server using stdio transport.
+// RunStdio starts the server using stdio transport. Transport errors are written to the
+// server logger, never to stdout.
 func (s *Server) RunStdio() error {
-	return serverpkg.ServeStdio(s.mcpServer)
+	return serverpkg.ServeStdio(s.mcpServer,
+		serverpkg.WithErrorLogger(logging.StdLogger(s.logger, slog.LevelError)),
+	)
 }
 
-// RunHTTP starts the server using HTTP transport on the provided address.
+// RunHTTP starts the server using HTTP transport on the provided address. MCP is served at
+// /mcp, next to the /healthz and /readyz probes, over HTTPS when WithTLS was given.
 func (s *Server) RunHTTP(addr string) error {
-	return serverpkg.NewStreamableHTTPServer(s.mcpServer).Start(addr)
+	mux := http.NewServeMux()
+	opts := []serverpkg.StreamableHTTPOption{
+		serverpkg.WithLogger(logging.MCPLogger(s.logger)),
+		serverpkg.WithStreamableHTTPServer(&http.Server{Handler: mux}),
+	}
+	if s.tlsCertFile != "" || s.tlsKeyFile != "" {
+		opts = append(opts, serverpkg.WithTLSCert(s.tlsCertFile, s.tlsKeyFile))
+	}
+
+	streamable := serverpkg.NewStreamableHTTPServer(s.mcpServer, opts...)
+	s.registerHTTPHandlers(mux, streamable)
+
+	return streamable.Start(addr)
 }
 
 func (s *Server) registerTools() {
 	s.addTool(mcp.NewTool(
 		"health_check",
-		mcp.WithDescription("Simple health check to verify the MCP server is working"),
+		mcp.WithDescription("Check the connection to GitLab: reachability and latency, server version, authenticated user, token scopes and expiry, and rate-limit headroom"),
+		mcp.WithTitleAnnotation("Health Check"),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(true),
+		mcp.WithOutputSchema[HealthCheckOutput](),
 	), s.handleHealthCheck)
 
+	s.addTool(mcp.NewTool(
+		"whoami",
+		mcp.WithDescription("Show the GitLab user and access token the server acts as, optionally with the user's role on a project or group and which destructive tools it could not run there"),
+		mcp.WithTitleAnnotation("Who Am I"),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(true),
+		mcp.WithOutputSchema[WhoAmIOutput](),
+		mcp.WithString("project_id_or_path",
+			mcp.Description("GitLab project ID or path to report the user's role on"),
+		),
+		mcp.WithString("group_id_or_path",
+			mcp.Description("GitLab group ID or path to report the user's role on"),
+		),
+	), s.handleWhoAmI)
+
 	s.addTool(mcp.NewTool(
 		"list_all_group_projects",
 		mcp.WithDescription("List all projects in a group and its subgroups recursively"),
+		mcp.WithTitleAnnotation("List All Group Projects"),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(true),
+		mcp.WithOutputSchema[ProjectListOutput](),
 		mcp.WithString("group_id_or_path", mcp.Required(),
 			mcp.Description("GitLab group ID or path"),
 		),
 		mcp.WithBoolean("archived",
 			mcp.Description("Filter by archived status (default: false)"),
 		),
+		mcp.WithNumber("max_results",
+			mcp.Description("Maximum number of projects to return; omit or set to 0 to return all"),
+		),
+		mcp.WithBoolean("fail_fast",
+			mcp.Description("Return an error if any subgroup cannot be listed instead of reporting partial results (default: false)"),
+		),
 	), s.handleListAllGroupProjects)
 
 	s.addTool(mcp.NewTool(
 		"list_direct_group_projects",
 		mcp.WithDescription("List all projects directly in a group (not including subgroups)"),
+		mcp.WithTitleAnnotation("List Direct Group Projects"),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(true),
+		mcp.WithOutputSchema[ProjectListOutput](),
 		mcp.WithString("group_id_or_path", mcp.Required(),
 			mcp.Description("GitLab group ID or path"),
 		),
+		mcp.WithNumber("max_results",
+			mcp.Description("Maximum number of projects to return; omit or set to 0 to return all"),
+		),
 	), s.handleListDirectGroupProjects)
 
 	s.addTool(mcp.NewTool(
 		"list_subgroups",
 		mcp.WithDescription("List all subgroups in a group"),
+		mcp.WithTitleAnnotation("List Subgroups"),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(true),
+		mcp.WithOutputSchema[SubgroupListOutput](),
 		mcp.WithString("group_id_or_path", mcp.Required(),
 			mcp.Description("GitLab group ID or path"),
 		),
+		mcp.WithNumber("max_results",
+			mcp.Description("Maximum number of subgroups to return; omit or set to 0 to return all"),
+		),
 	), s.handleListSubgroups)
 
 	s.addTool(mcp.NewTool(
 		"archive_project",
 		mcp.WithDescription("Archive a GitLab project (requires Owner role or admin permissions)"),
+		mcp.WithTitleAnnotation("Archive Project"),
+		mcp.WithReadOnlyHintAnnotation(false),
+		mcp.WithDestructiveHintAnnotation(true),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(true),
+		mcp.WithOutputSchema[ArchiveProjectOutput](),
 		mcp.WithString("project_id_or_path", mcp.Required(),
 			mcp.Description("GitLab project ID or path with namespace"),
 		),
+		mcp.WithBoolean("confirm",
+			mcp.Description("Set to true to archive when the client cannot ask the user for confirmation; defaults to false for safety"),
+		),
 	), s.handleArchiveProject)
 
 	s.addTool(mcp.NewTool(
 		"get_project_status",
 		mcp.WithDescription("Get detailed status and metadata for a single GitLab project"),
+		mcp.WithTitleAnnotation("Get Project Status"),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(true),
+		mcp.WithOutputSchema[ProjectStatusOutput](),
 		mcp.WithString("project_id_or_path", mcp.Required(),
 			mcp.Description("GitLab project ID or path with namespace"),
 		),
@@ -116,62 +302,252 @@ func (s *Server) registerTools() {
 
 	s.addTool(mcp.NewTool(
 		"list_old_pipelines",
-		mcp.WithDescription("List all pipelines in a project older than the provided age threshold"),
-		mcp.WithString("project_id_or_path", mcp.Required(),
-			mcp.Description("GitLab project ID or path with namespace"),
-		),
-		mcp.WithNumber("older_than_years", mcp.Required(),
-			mcp.Description("Age threshold in years; pipelines created before this many years ago will be included"),
-		),
+		append([]mcp.ToolOption{
+			mcp.WithDescription("List all pipelines in a project older than the provided age threshold, minus those kept by the optional retention rules, and return a deletion plan for exactly those pipelines"),
+			mcp.WithTitleAnnotation("List Old Pipelines"),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithDestructiveHintAnnotation(false),
+			// Every call issues a new deletion plan.
+			mcp.WithIdempotentHintAnnotation(false),
+			mcp.WithOpenWorldHintAnnotation(true),
+			mcp.WithOutputSchema[OldPipelinesOutput](),
+			mcp.WithString("project_id_or_path", mcp.Required(),
+				mcp.Description("GitLab project ID or path with namespace"),
+			),
+			mcp.WithNumber("max_results",
+				mcp.Description("Maximum number of pipelines to return; omit or set to 0 to return all"),
+			),
+		}, pipelineCleanupArguments()...)...,
 	), s.handleListOldPipelines)
 
 	s.addTool(mcp.NewTool(
 		"delete_old_pipelines",
-		mcp.WithDescription("Delete all pipelines in a project older than the provided age threshold"),
-		mcp.WithString("project_id_or_path", mcp.Required(),
-			mcp.Description("GitLab project ID or path with namespace"),
+		mcp.WithDescription("Delete exactly the pipelines in a plan returned by list_old_pipelines"),
+		mcp.WithTitleAnnotation("Delete Old Pipelines"),
+		mcp.WithReadOnlyHintAnnotation(false),
+		mcp.WithDestructiveHintAnnotation(true),
+		mcp.WithIdempotentHintAnnotation(false),
+		mcp.WithOpenWorldHintAnnotation(true),
+		mcp.WithOutputSchema[DeleteOldPipelinesOutput](),
+		mcp.WithString("plan_id", mcp.Required(),
+			mcp.Description("Plan ID returned by list_old_pipelines; plans expire and can be applied only once"),
 		),
-		mcp.WithNumber("older_than_years", mcp.Required(),
-			mcp.Description("Age threshold in years; pipelines created before this many years ago will be deleted"),
+		mcp.WithString("checksum",
+			mcp.Description("Optional plan checksum from list_old_pipelines; the call is refused if it does not match"),
 		),
 		mcp.WithBoolean("confirm",
-			mcp.Description("Set to true to actually delete pipelines; defaults to false for safety"),
+			mcp.Description("Set to true to delete when the client cannot ask the user for confirmation; defaults to false for safety"),
 		),
 	), s.handleDeleteOldPipelines)
+
+	s.addTool(mcp.NewTool(
+		"list_old_group_pipelines",
+		append([]mcp.ToolOption{
+			mcp.WithDescription("List old pipelines in every project of a group and its subgroups, minus those kept by the optional retention rules, and return one deletion plan covering exactly those pipelines"),
+			mcp.WithTitleAnnotation("List Old Group Pipelines"),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithDestructiveHintAnnotation(false),
+			// Every call issues a new deletion plan.
+			mcp.WithIdempotentHintAnnotation(false),
+			mcp.WithOpenWorldHintAnnotation(true),
+			mcp.WithOutputSchema[OldGroupPipelinesOutput](),
+			mcp.WithString("group_id_or_path", mcp.Required(),
+				mcp.Description("GitLab group ID or path"),
+			),
+			mcp.WithBoolean("skip_archived",
+				mcp.Description("Leave archived projects out of the cleanup (default: true)"),
+			),
+			mcp.WithNumber("max_projects",
+				mcp.Description("Maximum number of projects to plan; omit or set to 0 to plan all"),
+			),
+			mcp.WithNumber("max_results_per_project",
+				mcp.Description("Maximum number of pipelines to list in each project; omit or set to 0 to list all"),
+			),
+		}, pipelineCleanupArguments()...)...,
+	), s.handleListOldGroupPipelines)
+
+	s.addTool(mcp.NewTool(
+		"delete_old_group_pipelines",
+		mcp.WithDescription("Delete exactly the pipelines in a group plan returned by list_old_group_pipelines"),
+		mcp.WithTitleAnnotation("Delete Old Group Pipelines"),
+		mcp.WithReadOnlyHintAnnotation(false),
+		mcp.WithDestructiveHintAnnotation(true),
+		mcp.WithIdempotentHintAnnotation(false),
+		mcp.WithOpenWorldHintAnnotation(true),
+		mcp.WithOutputSchema[DeleteOldGroupPipelinesOutput](),
+		mcp.WithString("plan_id", mcp.Required(),
+			mcp.Description("Plan ID returned by list_old_group_pipelines; plans expire and can be applied only once"),
+		),
+		mcp.WithString("checksum",
+			mcp.Description("Optional plan checksum from list_old_group_pipelines; the call is refused if it does not match"),
+		),
+		mcp.WithBoolean("confirm",
+			mcp.Description("Set to true to delete when the client cannot ask the user for confirmation; defaults to false for safety"),
+		),
+	), s.handleDeleteOldGroupPipelines)
+
+	if s.audit != nil {
+		s.addTool(mcp.NewTool(
+			"query_audit_log",
+			mcp.WithDescription("Search the audit log of tool calls that changed GitLab, most recent last"),
+			mcp.WithTitleAnnotation("Query Audit Log"),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithDestructiveHintAnnotation(false),
+			mcp.WithIdempotentHintAnnotation(true),
+			mcp.WithOpenWorldHintAnnotation(false),
+			mcp.WithOutputSchema[AuditLogOutput](),
+			mcp.WithString("tool",
+				mcp.Description("Only records for this tool, e.g. delete_old_pipelines"),
+			),
+			mcp.WithString("project",
+				mcp.Description("Only records for this project ID or path"),
+			),
+			mcp.WithString("outcome",
+				mcp.Description("Only records with this outcome"),
+				mcp.Enum(audit.OutcomeSuccess, audit.OutcomePartial, audit.OutcomeNotPerformed, audit.OutcomeError),
+			),
+			mcp.WithString("session_id",
+				mcp.Description("Only records from this MCP session"),
+			),
+			mcp.WithNumber("affected_id",
+				mcp.Description("Only records that affected this project or pipeline ID"),
+			),
+			mcp.WithString("since",
+				mcp.Description("Only records at or after this RFC 3339 timestamp"),
+			),
+			mcp.WithString("until",
+				mcp.Description("Only records at or before this RFC 3339 timestamp"),
+			),
+			mcp.WithNumber("limit",
+				mcp.Description("Maximum number of most recent records to return (default 50); 0 returns all"),
+			),
+		), s.handleQueryAuditLog)
+	}
 }
 
 func (s *Server) addTool(tool mcp.Tool, handler func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)) {
+	if !s.toolFilter.allows(tool) {
+		s.logger.Debug("skipping MCP tool excluded by configuration", "name", tool.Name)
+		return
+	}
+
+	if s.audit != nil && !hint(tool.Annotations.ReadOnlyHint, false) {
+		handler = s.withAudit(tool.Name, handler)
+	}
+
 	s.mcpServer.AddTool(tool, handler)
-	s.tools = append(s.tools, ToolInfo{Name: tool.Name, Description: tool.Description})
+
+	// Unset hints take the defaults defined by the MCP specification.
+	annotations := tool.Annotations
+	s.tools = append(s.tools, ToolInfo{
+		Name:        tool.Name,
+		Title:       annotations.Title,
+		Description: tool.Description,
+		ReadOnly:    hint(annotations.ReadOnlyHint, false),
+		Destructive: hint(annotations.DestructiveHint, true),
+		Idempotent:  hint(annotations.IdempotentHint, false),
+		OpenWorld:   hint(annotations.OpenWorldHint, true),
+	})
+}
+
+func hint(value *bool, fallback bool) bool {
+	if value == nil {
+		return fallback
+	}
+	return *value
 }
 
-func (s *Server) handleHealthCheck(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	result := map[string]any{
-		"status":    "healthy",
-		"timestamp": time.Now().Format(time.RFC3339),
-		"server":    serverName,
-		"version":   serverVersion,
+func (s *Server) handleHealthCheck(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	report := s.service(ctx).CheckHealth(ctx)
+
+	result := HealthCheckOutput{
+		Status:    string(report.Status),
+		Timestamp: time.Now().Format(time.RFC3339),
+		Server:    serverName,
+		Version:   serverVersion,
+		GitLab:    report,
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf("Health check successful: %+v", result)), nil
+	summary := fmt.Sprintf("Health check: %s %s is %s", serverName, serverVersion, result.Status)
+	if report.Username != "" {
+		summary += fmt.Sprintf(", connected to GitLab %s as %s in %dms", report.GitLabVersion, report.Username, report.LatencyMS)
+	}
+	if len(report.Problems) > 0 {
+		summary += ": " + strings.Join(report.Problems, "; ")
+	}
+
+	return structuredResult(summary+".", result), nil
+}
+
+func (s *Server) handleWhoAmI(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	identity, err := s.service(ctx).Identity(ctx)
+	if err != nil {
+		return toolError("Error identifying access token", err), nil
+	}
+
+	output := WhoAmIOutput{Identity: *identity}
+	summary := fmt.Sprintf("Authenticated as %s", identity.Username)
+	if identity.TokenName != "" {
+		summary += fmt.Sprintf(" with token %q (scopes: %s)", identity.TokenName, strings.Join(identity.TokenScopes, ", "))
+	}
+
+	if project := strings.TrimSpace(request.GetString("project_id_or_path", "")); project != "" {
+		access, err := s.service(ctx).ProjectAccess(ctx, project, identity)
+		if err != nil {
+			return toolError("Error checking project access", err), nil
+		}
+		output.Project = &access
+		summary += fmt.Sprintf("; %s on project %s", access.Role, project)
+	}
+
+	if group := strings.TrimSpace(request.GetString("group_id_or_path", "")); group != "" {
+		access, err := s.service(ctx).GroupAccess(ctx, group, identity)
+		if err != nil {
+			return toolError("Error checking group access", err), nil
+		}
+		output.Group = &access
+		summary += fmt.Sprintf("; %s on group %s", access.Role, group)
+	}
+
+	return structuredResult(summary+".", output), nil
 }
 
 func (s *Server) handleListAllGroupProjects(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	groupIDOrPath, err := request.RequireString("group_id_or_path")
 	if err != nil {
-		return nil, fmt.Errorf("group_id_or_path is required: %w", err)
+		return validationError("group_id_or_path is required: %v", err), nil
 	}
 
 	archived := request.GetBool("archived", false)
 
-	projects, err := s.gitlab.ListGroupProjectsAll(ctx, groupIDOrPath, archived)
-	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf("Error fetching projects: %v", err)), nil
+	maxResults := request.GetInt("max_results", 0)
+	if maxResults < 0 {
+		return validationError("max_results cannot be negative"), nil
 	}
 
-	jsonData, err := json.MarshalIndent(projects, "", "  ")
+	failFast := request.GetBool("fail_fast", false)
+
+	result, err := s.service(ctx).ListGroupProjectsAll(ctx, groupIDOrPath, gitlab.GroupProjectsOptions{
+		Archived:   archived,
+		MaxResults: maxResults,
+		FailFast:   failFast,
+		Progress: s.progressReporter(ctx, request, func(progress gitlab.Progress) string {
+			return fmt.Sprintf("Listed projects of %d/%d subgroups (%d failed)", progress.Completed, progress.Total, progress.Failed)
+		}),
+	})
 	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf("Error serializing projects: %v", err)), nil
+		if failFast {
+			return toolError("Error fetching projects (fail_fast)", err), nil
+		}
+		return toolError("Error fetching projects", err), nil
+	}
+
+	output := ProjectListOutput{
+		Group:           groupIDOrPath,
+		Count:           len(result.Projects),
+		Truncated:       result.Truncated,
+		Projects:        nonNil(result.Projects),
+		FailedSubgroups: result.FailedSubgroups,
 	}
 
 	statusText := "all"
@@ -179,263 +555,678 @@ func (s *Server) handleListAllGroupProjects(ctx context.Context, request mcp.Cal
 		statusText = "archived"
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf(
-		"Found %d %s projects in group %s and its subgroups:\n\n%s",
-		len(projects), statusText, groupIDOrPath, string(jsonData),
-	)), nil
+	summary := fmt.Sprintf(
+		"Found %d %s projects in group %s and its subgroups%s.",
+		output.Count, statusText, groupIDOrPath, truncationNote(output.Truncated, maxResults),
+	)
+
+	if len(result.FailedSubgroups) > 0 {
+		var warnings strings.Builder
+		for _, failure := range result.FailedSubgroups {
+			fmt.Fprintf(&warnings, "\n- %s: %s", failure.SubgroupFullPath, failure.Error)
+		}
+
+		summary += fmt.Sprintf(
+			" Results are incomplete: %d subgroups could not be listed.\n\nWarnings:%s",
+			len(result.FailedSubgroups), warnings.String(),
+		)
+	}
+
+	return structuredResult(summary, output), nil
 }
 
 func (s *Server) handleListDirectGroupProjects(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	groupIDOrPath, err := request.RequireString("group_id_or_path")
 	if err != nil {
-		return nil, fmt.Errorf("group_id_or_path is required: %w", err)
+		return validationError("group_id_or_path is required: %v", err), nil
 	}
 
-	projects, err := s.gitlab.ListGroupProjects(ctx, groupIDOrPath)
-	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf("Error fetching direct projects: %v", err)), nil
+	maxResults := request.GetInt("max_results", 0)
+	if maxResults < 0 {
+		return validationError("max_results cannot be negative"), nil
 	}
 
-	jsonData, err := json.MarshalIndent(projects, "", "  ")
+	projects, truncated, err := s.service(ctx).ListGroupProjects(ctx, groupIDOrPath, maxResults)
 	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf("Error serializing projects: %v", err)), nil
+		return toolError("Error fetching direct projects", err), nil
+	}
+
+	output := ProjectListOutput{
+		Group:     groupIDOrPath,
+		Count:     len(projects),
+		Truncated: truncated,
+		Projects:  nonNil(projects),
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf(
-		"Found %d direct projects in group %s:\n\n%s",
-		len(projects), groupIDOrPath, string(jsonData),
-	)), nil
+	return structuredResult(fmt.Sprintf(
+		"Found %d direct projects in group %s%s.",
+		output.Count, groupIDOrPath, truncationNote(truncated, maxResults),
+	), output), nil
 }
 
 func (s *Server) handleListSubgroups(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	groupIDOrPath, err := request.RequireString("group_id_or_path")
 	if err != nil {
-		return nil, fmt.Errorf("group_id_or_path is required: %w", err)
+		return validationError("group_id_or_path is required: %v", err), nil
 	}
 
-	subgroups, err := s.gitlab.ListGroupSubgroups(ctx, groupIDOrPath)
-	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf("Error fetching subgroups: %v", err)), nil
+	maxResults := request.GetInt("max_results", 0)
+	if maxResults < 0 {
+		return validationError("max_results cannot be negative"), nil
 	}
 
-	jsonData, err := json.MarshalIndent(subgroups, "", "  ")
+	subgroups, truncated, err := s.service(ctx).ListGroupSubgroups(ctx, groupIDOrPath, maxResults)
 	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf("Error serializing subgroups: %v", err)), nil
+		return toolError("Error fetching subgroups", err), nil
+	}
+
+	output := SubgroupListOutput{
+		Group:     groupIDOrPath,
+		Count:     len(subgroups),
+		Truncated: truncated,
+		Subgroups: nonNil(subgroups),
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf(
-		"Found %d subgroups in group %s:\n\n%s",
-		len(subgroups), groupIDOrPath, string(jsonData),
-	)), nil
+	return structuredResult(fmt.Sprintf(
+		"Found %d subgroups in group %s%s.",
+		output.Count, groupIDOrPath, truncationNote(truncated, maxResults),
+	), output), nil
 }
 
 func (s *Server) handleArchiveProject(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	projectIDOrPath, err := request.RequireString("project_id_or_path")
 	if err != nil {
-		return nil, fmt.Errorf("project_id_or_path is required: %w", err)
+		return validationError("project_id_or_path is required: %v", err), nil
+	}
+
+	project, err := s.service(ctx).GetProject(ctx, projectIDOrPath)
+	if err != nil {
+		return toolError("Error fetching project", err), nil
+	}
+
+	output := ArchiveProjectOutput{
+		ProjectID:   project.ID,
+		ProjectName: project.Name,
+		ProjectPath: project.PathWithNamespace,
+		Archived:    project.Archived,
+		WebURL:      project.WebURL,
 	}
 
-	project, err := s.gitlab.ArchiveProject(ctx, projectIDOrPath)
+	// Check permissions before asking the human so they are never asked to approve a call that
+	// GitLab would refuse. The permit spares ArchiveProject from checking again.
+	permit, err := s.service(ctx).Preflight(ctx, projectIDOrPath, gitlab.ActionArchiveProject)
 	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf("Error archiving project: %v", err)), nil
+		return toolError("Cannot archive project", err), nil
 	}
 
-	result := map[string]any{
-		"success":            true,
-		"project_id":         project.ID,
-		"project_name":       project.Name,
-		"project_path":       project.PathWithNamespace,
-		"archived":           project.Archived,
-		"web_url":            project.WebURL,
-		"archived_timestamp": time.Now().Format(time.RFC3339),
+	approval, err := s.confirmDestructive(ctx, request, fmt.Sprintf(
+		"Archive GitLab project %s (ID %d)? The project becomes read-only until it is unarchived.",
+		project.PathWithNamespace, project.ID,
+	))
+	if err != nil {
+		return toolError("Error confirming archive", err), nil
+	}
+	if !approval.Approved {
+		return structuredResult(fmt.Sprintf(
+			"Project '%s' was not archived: %s.", project.PathWithNamespace, approval.Reason,
+		), output), nil
 	}
 
-	jsonData, err := json.MarshalIndent(result, "", "  ")
+	project, err = s.service(ctx).ArchiveProject(ctx, projectIDOrPath, permit)
 	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf("Project archived but failed to serialize response: %v", err)), nil
+		return toolError("Error archiving project", err), nil
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf(
-		"Project '%s' archived successfully:\n\n%s",
-		project.PathWithNamespace, string(jsonData),
-	)), nil
+	output.Success = true
+	output.Archived = project.Archived
+	output.ArchivedTimestamp = time.Now().Format(time.RFC3339)
+	output.ConfirmedVia = approval.Via
+
+	return structuredResult(fmt.Sprintf("Project '%s' archived successfully.", project.PathWithNamespace), output), nil
 }
 
 func (s *Server) handleGetProjectStatus(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	projectIDOrPath, err := request.RequireString("project_id_or_path")
 	if err != nil {
-		return nil, fmt.Errorf("project_id_or_path is required: %w", err)
+		return validationError("project_id_or_path is required: %v", err), nil
 	}
 
-	project, err := s.gitlab.GetProject(ctx, projectIDOrPath)
+	project, err := s.service(ctx).GetProject(ctx, projectIDOrPath)
 	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf("Error fetching project: %v", err)), nil
-	}
-
-	result := map[string]any{
-		"id":                  project.ID,
-		"name":                project.Name,
-		"path":                project.Path,
-		"path_with_namespace": project.PathWithNamespace,
-		"description":         project.Description,
-		"web_url":             project.WebURL,
-		"clone_url_http":      project.HTTPURLToRepo,
-		"clone_url_ssh":       project.SSHURLToRepo,
-		"visibility":          project.Visibility,
-		"archived":            project.Archived,
-		"created_at":          project.CreatedAt,
-		"last_activity_at":    project.LastActivityAt,
-		"default_branch":      project.DefaultBranch,
-		"forks_count":         project.ForksCount,
-		"star_count":          project.StarCount,
-		"open_issues_count":   project.OpenIssuesCount,
-		"topics":              project.Topics,
-		"readme_url":          project.ReadmeURL,
+		return toolError("Error fetching project", err), nil
+	}
+
+	output := ProjectStatusOutput{
+		ID:                project.ID,
+		Name:              project.Name,
+		Path:              project.Path,
+		PathWithNamespace: project.PathWithNamespace,
+		Description:       project.Description,
+		WebURL:            project.WebURL,
+		CloneURLHTTP:      project.HTTPURLToRepo,
+		CloneURLSSH:       project.SSHURLToRepo,
+		Visibility:        string(project.Visibility),
+		Archived:          project.Archived,
+		CreatedAt:         project.CreatedAt,
+		LastActivityAt:    project.LastActivityAt,
+		DefaultBranch:     project.DefaultBranch,
+		ForksCount:        project.ForksCount,
+		StarCount:         project.StarCount,
+		OpenIssuesCount:   project.OpenIssuesCount,
+		Topics:            nonNil(project.Topics),
+		ReadmeURL:         project.ReadmeURL,
 	}
 
 	if project.Namespace != nil {
-		result["namespace"] = map[string]any{
-			"id":        project.Namespace.ID,
-			"name":      project.Namespace.Name,
-			"path":      project.Namespace.Path,
-			"full_path": project.Namespace.FullPath,
-			"kind":      project.Namespace.Kind,
+		output.Namespace = &NamespaceOutput{
+			ID:       project.Namespace.ID,
+			Name:     project.Namespace.Name,
+			Path:     project.Namespace.Path,
+			FullPath: project.Namespace.FullPath,
+			Kind:     project.Namespace.Kind,
 		}
 	}
 
 	if project.Statistics != nil {
-		result["size"] = project.Statistics.RepositorySize
-		result["commit_count"] = project.Statistics.CommitCount
-		result["storage_size"] = project.Statistics.StorageSize
-	}
-
-	jsonData, err := json.MarshalIndent(result, "", "  ")
-	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf("Error serializing project status: %v", err)), nil
+		output.Size = &project.Statistics.RepositorySize
+		output.CommitCount = &project.Statistics.CommitCount
+		output.StorageSize = &project.Statistics.StorageSize
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf(
-		"Project status for '%s':\n\n%s",
-		project.PathWithNamespace, string(jsonData),
-	)), nil
+	return structuredResult(fmt.Sprintf("Project status for '%s'.", project.PathWithNamespace), output), nil
 }
 
 func (s *Server) handleListOldPipelines(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	projectIDOrPath, err := request.RequireString("project_id_or_path")
 	if err != nil {
-		return nil, fmt.Errorf("project_id_or_path is required: %w", err)
+		return validationError("project_id_or_path is required: %v", err), nil
 	}
 
 	projectIDOrPath = strings.TrimSpace(projectIDOrPath)
 	if projectIDOrPath == "" {
-		return mcp.NewToolResultText("project_id_or_path cannot be empty"), nil
+		return validationError("project_id_or_path cannot be empty"), nil
 	}
 
-	years, err := request.RequireInt("older_than_years")
+	filter, err := pipelineFilter(request, time.Now().UTC())
 	if err != nil {
-		return nil, fmt.Errorf("older_than_years is required: %w", err)
+		return validationError("%v", err), nil
 	}
 
-	if years <= 0 {
-		return mcp.NewToolResultText("older_than_years must be greater than zero"), nil
+	maxResults := request.GetInt("max_results", 0)
+	if maxResults < 0 {
+		return validationError("max_results cannot be negative"), nil
 	}
 
-	cutoff := time.Now().UTC().AddDate(-years, 0, 0)
+	policy, err := retentionPolicy(request)
+	if err != nil {
+		return validationError("%v", err), nil
+	}
 
-	pipelines, err := s.gitlab.ListOldPipelines(ctx, projectIDOrPath, cutoff)
+	cleanup, err := s.service(ctx).PlanPipelineCleanup(ctx, projectIDOrPath, filter, policy, maxResults)
 	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf("Error listing old pipelines: %v", err)), nil
+		return toolError("Error listing old pipelines", err), nil
+	}
+	pipelines, truncated := cleanup.Delete, cleanup.Truncated
+
+	output := OldPipelinesOutput{
+		Project:              projectIDOrPath,
+		PipelineFilterOutput: newPipelineFilterOutput(filter),
+		OlderThan:            strings.TrimSpace(request.GetString("older_than", "")),
+		OlderThanYears:       request.GetInt("older_than_years", 0),
+		Count:                len(pipelines),
+		Truncated:            truncated,
+		Pipelines:            nonNil(pipelines),
+		KeptCount:            len(cleanup.Kept),
+		Kept:                 cleanup.Kept,
+	}
+	if !policy.IsZero() {
+		output.Retention = &policy
 	}
 
 	if len(pipelines) == 0 {
-		return mcp.NewToolResultText(fmt.Sprintf(
-			"No pipelines in project %s are older than %d years (cutoff %s).",
-			projectIDOrPath, years, cutoff.Format(time.RFC3339),
-		)), nil
+		return structuredResult(fmt.Sprintf(
+			"No pipelines in project %s were %s%s.", projectIDOrPath, describeFilter(filter), keptNote(len(cleanup.Kept)),
+		), output), nil
+	}
+
+	pipelineIDs := make([]int, 0, len(pipelines))
+	for _, pipeline := range pipelines {
+		pipelineIDs = append(pipelineIDs, pipeline.ID)
 	}
 
-	jsonData, err := json.MarshalIndent(pipelines, "", "  ")
+	plan, err := s.plans.Create(planOwner(ctx), projectIDOrPath, filter, policy, pipelineIDs)
 	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf("Error serializing pipeline list: %v", err)), nil
+		return toolError("Error creating deletion plan", err), nil
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf(
-		"Found %d pipelines in project %s created before %s (older than %d years):\n\n%s",
-		len(pipelines), projectIDOrPath, cutoff.Format(time.RFC3339), years, string(jsonData),
-	)), nil
+	output.PlanID = plan.ID
+	output.Checksum = plan.Checksum
+	output.PlanExpiresAt = plan.ExpiresAt.Format(time.RFC3339)
+
+	return structuredResult(fmt.Sprintf(
+		"Found %d pipelines in project %s %s%s%s. "+
+			"To delete exactly these pipelines, call delete_old_pipelines with plan_id %s before %s.",
+		len(pipelines), projectIDOrPath, describeFilter(filter), keptNote(len(cleanup.Kept)), truncationNote(truncated, maxResults),
+		plan.ID, output.PlanExpiresAt,
+	), output), nil
 }
 
 func (s *Server) handleDeleteOldPipelines(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	projectIDOrPath, err := request.RequireString("project_id_or_path")
+	planID, err := request.RequireString("plan_id")
 	if err != nil {
-		return nil, fmt.Errorf("project_id_or_path is required: %w", err)
+		return validationError("plan_id is required: %v", err), nil
 	}
 
-	projectIDOrPath = strings.TrimSpace(projectIDOrPath)
-	if projectIDOrPath == "" {
-		return mcp.NewToolResultText("project_id_or_path cannot be empty"), nil
+	planID = strings.TrimSpace(planID)
+	if planID == "" {
+		return validationError("plan_id cannot be empty"), nil
 	}
 
-	years, err := request.RequireInt("older_than_years")
+	checksum := strings.TrimSpace(request.GetString("checksum", ""))
+
+	plan, err := s.plans.Get(planOwner(ctx), planID, checksum)
 	if err != nil {
-		return nil, fmt.Errorf("older_than_years is required: %w", err)
+		return toolError("Error loading deletion plan", err), nil
 	}
 
-	if years <= 0 {
-		return mcp.NewToolResultText("older_than_years must be greater than zero"), nil
+	output := DeleteOldPipelinesOutput{
+		PlanID:               plan.ID,
+		Checksum:             plan.Checksum,
+		Project:              plan.Project,
+		PipelineFilterOutput: newPipelineFilterOutput(plan.Filter),
+		TotalCandidates:      len(plan.PipelineIDs),
+		DeletedIDs:           []int{},
 	}
 
-	if !request.GetBool("confirm", false) {
-		return mcp.NewToolResultText(
-			"Deletion not performed: set confirm=true to delete pipelines after reviewing list_old_pipelines output.",
-		), nil
+	var permit *gitlab.Permit
+	if len(plan.PipelineIDs) > 0 {
+		permit, err = s.service(ctx).Preflight(ctx, plan.Project, gitlab.ActionDeletePipelines)
+		if err != nil {
+			return toolError("Cannot delete pipelines", err), nil
+		}
 	}
 
-	cutoff := time.Now().UTC().AddDate(-years, 0, 0)
-
-	summary, err := s.gitlab.DeleteOldPipelines(ctx, projectIDOrPath, cutoff)
+	approval, err := s.confirmDestructive(ctx, request, fmt.Sprintf(
+		"Delete %d pipelines %s from GitLab project %s? This cannot be undone.",
+		output.TotalCandidates, describeFilter(plan.Filter), plan.Project,
+	))
 	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf("Error deleting old pipelines: %v", err)), nil
+		return toolError("Error confirming deletion", err), nil
+	}
+	if !approval.Approved {
+		return structuredResult(fmt.Sprintf(
+			"Deletion not performed: plan %s would delete %d pipelines from project %s; %s.",
+			plan.ID, output.TotalCandidates, plan.Project, approval.Reason,
+		), output), nil
 	}
 
-	if summary.TotalCandidates == 0 {
-		return mcp.NewToolResultText(fmt.Sprintf(
-			"No pipelines in project %s are older than %d years (cutoff %s).",
-			projectIDOrPath, years, cutoff.Format(time.RFC3339),
-		)), nil
+	// Take the plan only once approved so a declined or previewed plan can still be applied, and
+	// so a plan that expired while the user was deciding is refused.
+	if _, err := s.plans.Take(planOwner(ctx), planID, checksum); err != nil {
+		return toolError("Error loading deletion plan", err), nil
 	}
 
-	result := map[string]any{
-		"project":          projectIDOrPath,
-		"cutoff":           cutoff.Format(time.RFC3339),
-		"older_than_years": years,
-		"total_candidates": summary.TotalCandidates,
-		"deleted_count":    len(summary.DeletedIDs),
-		"deleted_ids":      summary.DeletedIDs,
+	progress := s.progressReporter(ctx, request, func(progress gitlab.Progress) string {
+		return fmt.Sprintf("Deleted %d/%d pipelines (%d failed)", progress.Completed-progress.Failed, progress.Total, progress.Failed)
+	})
+
+	summary, err := s.service(ctx).DeletePipelines(ctx, plan.Project, plan.Filter, plan.Retention, plan.PipelineIDs, permit, progress)
+	if err != nil {
+		return toolError("Cannot delete pipelines", err), nil
 	}
 
+	output.Performed = true
+	output.ConfirmedVia = approval.Via
+	output.DeletedCount = len(summary.DeletedIDs)
+	output.DeletedIDs = nonNil(summary.DeletedIDs)
+	output.FailedDeletions = summary.Failed
+	output.SkippedIDs = summary.SkippedIDs
+
 	if len(summary.Failed) > 0 {
-		result["failed_deletions"] = summary.Failed
+		return structuredResult(fmt.Sprintf(
+			"Deleted %d/%d pipelines from project %s using plan %s.%s %d deletions failed.",
+			output.DeletedCount, summary.TotalCandidates, plan.Project, plan.ID, skippedNote(len(summary.SkippedIDs)), len(summary.Failed),
+		), output), nil
 	}
 
-	jsonData, err := json.MarshalIndent(result, "", "  ")
+	return structuredResult(fmt.Sprintf(
+		"Deleted %d/%d pipelines from project %s using plan %s.%s",
+		output.DeletedCount, summary.TotalCandidates, plan.Project, plan.ID, skippedNote(len(summary.SkippedIDs)),
+	), output), nil
+}
+
+func (s *Server) handleListOldGroupPipelines(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	groupIDOrPath, err := request.RequireString("group_id_or_path")
 	if err != nil {
-		return mcp.NewToolResultText(fmt.Sprintf(
-			"Deletion completed but failed to serialize response: %v", err,
-		)), nil
+		return validationError("group_id_or_path is required: %v", err), nil
 	}
 
-	if len(summary.Failed) > 0 {
-		return mcp.NewToolResultText(fmt.Sprintf(
-			"Deleted %d/%d pipelines older than %d years in project %s (cutoff %s). Some deletions failed:\n\n%s",
-			len(summary.DeletedIDs), summary.TotalCandidates, years, projectIDOrPath,
-			cutoff.Format(time.RFC3339), string(jsonData),
-		)), nil
-	}
-
-	return mcp.NewToolResultText(fmt.Sprintf(
-		"Deleted %d/%d pipelines older than %d years in project %s (cutoff %s):\n\n%s",
-		len(summary.DeletedIDs), summary.TotalCandidates, years,
-		projectIDOrPath, cutoff.Format(time.RFC3339), string(jsonData),
-	)), nil
+	groupIDOrPath = strings.TrimSpace(groupIDOrPath)
+	if groupIDOrPath == "" {
+		return validationError("group_id_or_path cannot be empty"), nil
+	}
+
+	filter, err := pipelineFilter(request, time.Now().UTC())
+	if err != nil {
+		return validationError("%v", err), nil
+	}
+
+	policy, err := retentionPolicy(request)
+	if err != nil {
+		return validationError("%v", err), nil
+	}
+
+	maxProjects := request.GetInt("max_projects", 0)
+	if maxProjects < 0 {
+		return validationError("max_projects cannot be negative"), nil
+	}
+
+	maxPerProject := request.GetInt("max_results_per_project", 0)
+	if maxPerProject < 0 {
+		return validationError("max_results_per_project cannot be negative"), nil
+	}
+
+	skipArchived := request.GetBool("skip_archived", true)
+
+	cleanup, err := s.service(ctx).PlanGroupPipelineCleanup(ctx, groupIDOrPath, gitlab.GroupPipelineCleanupOptions{
+		Filter:                 filter,
+		Retention:              policy,
+		SkipArchived:           skipArchived,
+		MaxProjects:            maxProjects,
+		MaxPipelinesPerProject: maxPerProject,
+		Progress: s.progressReporter(ctx, request, func(progress gitlab.Progress) string {
+			return fmt.Sprintf("Listed old pipelines of %d/%d projects (%d failed)", progress.Completed, progress.Total, progress.Failed)
+		}),
+	})
+	if err != nil {
+		return toolError("Error listing old group pipelines", err), nil
+	}
+
+	output := OldGroupPipelinesOutput{
+		Group:                groupIDOrPath,
+		PipelineFilterOutput: newPipelineFilterOutput(filter),
+		OlderThan:            strings.TrimSpace(request.GetString("older_than", "")),
+		OlderThanYears:       request.GetInt("older_than_years", 0),
+		SkipArchived:         skipArchived,
+		ProjectCount:         len(cleanup.Projects),
+		Truncated:            cleanup.Truncated,
+		Projects:             make([]GroupProjectPipelinesOutput, 0, len(cleanup.Projects)),
+		FailedSubgroups:      cleanup.FailedSubgroups,
+	}
+	if !policy.IsZero() {
+		output.Retention = &policy
+	}
+
+	var planned []gitlab.ProjectPipelineIDs
+	var warnings strings.Builder
+	for _, project := range cleanup.Projects {
+		summary := GroupProjectPipelinesOutput{Project: project.Project.PathWithNamespace}
+		if project.Err != nil {
+			summary.Error = project.Err.Error()
+			output.FailedProjectCount++
+			fmt.Fprintf(&warnings, "\n- %s: %s", summary.Project, summary.Error)
+			output.Projects = append(output.Projects, summary)
+			continue
+		}
+
+		for _, pipeline := range project.Cleanup.Delete {
+			summary.PipelineIDs = append(summary.PipelineIDs, pipeline.ID)
+		}
+		summary.Count = len(summary.PipelineIDs)
+		summary.KeptCount = len(project.Cleanup.Kept)
+		summary.Truncated = project.Cleanup.Truncated
+		if summary.Truncated {
+			output.TruncatedProjects = append(output.TruncatedProjects, summary.Project)
+		}
+		output.Count += summary.Count
+		output.KeptCount += summary.KeptCount
+		output.Projects = append(output.Projects, summary)
+
+		planned = append(planned, gitlab.ProjectPipelineIDs{Project: summary.Project, PipelineIDs: summary.PipelineIDs})
+	}
+	for _, failure := range cleanup.FailedSubgroups {
+		fmt.Fprintf(&warnings, "\n- %s: %s", failure.SubgroupFullPath, failure.Error)
+	}
+
+	var text string
+	if output.Count == 0 {
+		text = fmt.Sprintf(
+			"No pipelines in the %d projects of group %s were %s%s%s.",
+			output.ProjectCount, groupIDOrPath, describeFilter(filter), keptNote(output.KeptCount), limitNote(cleanup.Truncated, "max_projects", maxProjects),
+		)
+	} else {
+		plan, err := s.plans.CreateGroup(planOwner(ctx), groupIDOrPath, filter, policy, planned)
+		if err != nil {
+			return toolError("Error creating deletion plan", err), nil
+		}
+
+		output.PlanID = plan.ID
+		output.Checksum = plan.Checksum
+		output.PlanExpiresAt = plan.ExpiresAt.Format(time.RFC3339)
+
+		text = fmt.Sprintf(
+			"Found %d pipelines in %d of the %d projects of group %s %s%s%s. "+
+				"To delete exactly these pipelines, call delete_old_group_pipelines with plan_id %s before %s.",
+			output.Count, len(plan.Projects), output.ProjectCount, groupIDOrPath, describeFilter(filter),
+			keptNote(output.KeptCount), limitNote(cleanup.Truncated, "max_projects", maxProjects), plan.ID, output.PlanExpiresAt,
+		)
+	}
+
+	text += projectTruncationNote(output.TruncatedProjects, maxPerProject)
+
+	if warnings.Len() > 0 {
+		text += fmt.Sprintf(
+			" Results are incomplete: %d projects and %d subgroups could not be listed.\n\nWarnings:%s",
+			output.FailedProjectCount, len(cleanup.FailedSubgroups), warnings.String(),
+		)
+	}
+
+	return structuredResult(text, output), nil
+}
+
+func (s *Server) handleDeleteOldGroupPipelines(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	planID, err := request.RequireString("plan_id")
+	if err != nil {
+		return validationError("plan_id is required: %v", err), nil
+	}
+
+	planID = strings.TrimSpace(planID)
+	if planID == "" {
+		return validationError("plan_id cannot be empty"), nil
+	}
+
+	checksum := strings.TrimSpace(request.GetString("checksum", ""))
+
+	plan, err := s.plans.GetGroup(planOwner(ctx), planID, checksum)
+	if err != nil {
+		return toolError("Error loading deletion plan", err), nil
+	}
+
+	output := DeleteOldGroupPipelinesOutput{
+		PlanID:               plan.ID,
+		Checksum:             plan.Checksum,
+		Group:                plan.Group,
+		PipelineFilterOutput: newPipelineFilterOutput(plan.Filter),
+		ProjectCount:         len(plan.Projects),
+		TotalCandidates:      plan.PipelineCount(),
+		Projects:             []GroupProjectDeletionOutput{},
+	}
+
+	// Check every planned project before asking the human, so the prompt names the projects the
+	// token cannot delete from rather than the deletion failing there after approval.
+	paths := make([]string, len(plan.Projects))
+	for i, project := range plan.Projects {
+		paths[i] = project.Project
+	}
+	permits, preflightErrs := s.service(ctx).PreflightProjects(ctx, paths, gitlab.ActionDeletePipelines)
+
+	var (
+		allowed        []gitlab.ProjectPipelineIDs
+		allowedPermits []*gitlab.Permit
+		denied         []error
+		deniedNote     strings.Builder
+		deniedCount    int
+	)
+	for i, project := range plan.Projects {
+		if err := preflightErrs[i]; err != nil {
+			denied = append(denied, fmt.Errorf("%s: %w", project.Project, err))
+			deniedCount += len(project.PipelineIDs)
+			fmt.Fprintf(&deniedNote, "\n- %s: %v", project.Project, err)
+			continue
+		}
+		allowed = append(allowed, project)
+		allowedPermits = append(allowedPermits, permits[i])
+	}
+	if len(allowed) == 0 && len(denied) > 0 {
+		return toolError("Cannot delete pipelines", errors.Join(denied...)), nil
+	}
+
+	prompt := fmt.Sprintf(
+		"Delete %d pipelines %s from %d projects of GitLab group %s? This cannot be undone.",
+		output.TotalCandidates-deniedCount, describeFilter(plan.Filter), len(allowed), plan.Group,
+	)
+	if len(denied) > 0 {
+		prompt += fmt.Sprintf(
+			" %d pipelines in %d projects will be left alone because the token cannot delete them there:%s",
+			deniedCount, len(denied), deniedNote.String(),
+		)
+	}
+
+	approval, err := s.confirmDestructive(ctx, request, prompt)
+	if err != nil {
+		return toolError("Error confirming deletion", err), nil
+	}
+	if !approval.Approved {
+		text := fmt.Sprintf(
+			"Deletion not performed: plan %s would delete %d pipelines from %d projects of group %s; %s.",
+			plan.ID, output.TotalCandidates, output.ProjectCount, plan.Group, approval.Reason,
+		)
+		if len(denied) > 0 {
+			text += fmt.Sprintf(" The token cannot delete pipelines in %d projects:%s", len(denied), deniedNote.String())
+		}
+		return structuredResult(text, output), nil
+	}
+
+	// As with delete_old_pipelines, take the plan only once approved.
+	if _, err := s.plans.TakeGroup(planOwner(ctx), planID, checksum); err != nil {
+		return toolError("Error loading deletion plan", err), nil
+	}
+
+	progress := s.progressReporter(ctx, request, func(progress gitlab.Progress) string {
+		return fmt.Sprintf("Deleted %d/%d pipelines (%d failed)", progress.Completed-progress.Failed, progress.Total, progress.Failed)
+	})
+
+	results := make(map[string]gitlab.ProjectPipelineDeletion, len(plan.Projects))
+	for _, result := range s.service(ctx).DeleteGroupPipelines(ctx, plan.Filter, plan.Retention, allowed, allowedPermits, progress) {
+		results[result.Project] = result
+	}
+
+	var warnings strings.Builder
+	for i, planned := range plan.Projects {
+		result, ok := results[planned.Project]
+		if !ok {
+			result = gitlab.ProjectPipelineDeletion{Project: planned.Project, Err: preflightErrs[i]}
+		}
+
+		project := GroupProjectDeletionOutput{Project: result.Project, TotalCandidates: len(planned.PipelineIDs), DeletedIDs: []int{}}
+		if result.Err != nil {
+			project.Error = result.Err.Error()
+			output.FailedCount += project.TotalCandidates
+			fmt.Fprintf(&warnings, "\n- %s: %s", project.Project, project.Error)
+		} else {
+			project.DeletedIDs = nonNil(result.Summary.DeletedIDs)
+			project.FailedDeletions = result.Summary.Failed
+			project.SkippedIDs = result.Summary.SkippedIDs
+			output.FailedCount += len(result.Summary.Failed)
+			output.SkippedCount += len(result.Summary.SkippedIDs)
+			if len(result.Summary.Failed) > 0 {
+				fmt.Fprintf(&warnings, "\n- %s: %d deletions failed", project.Project, len(result.Summary.Failed))
+			}
+		}
+		project.DeletedCount = len(project.DeletedIDs)
+		output.DeletedCount += project.DeletedCount
+		output.Projects = append(output.Projects, project)
+	}
+
+	output.Performed = true
+	output.ConfirmedVia = approval.Via
+
+	text := fmt.Sprintf(
+		"Deleted %d/%d pipelines from %d projects of group %s using plan %s.",
+		output.DeletedCount, output.TotalCandidates, output.ProjectCount, plan.Group, plan.ID,
+	)
+	text += skippedNote(output.SkippedCount)
+	if output.FailedCount > 0 {
+		text += fmt.Sprintf(" %d deletions failed.\n\nWarnings:%s", output.FailedCount, warnings.String())
+	}
+
+	return structuredResult(text, output), nil
+}
+
+// structuredResult returns output as MCP structured content. The text content carries the
+// summary followed by the serialized output for clients that do not read structured content.
+func structuredResult(summary string, output any) *mcp.CallToolResult {
+	result := mcp.NewToolResultStructured(output, summary)
+
+	jsonData, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return result
+	}
+
+	result.Content = append(result.Content, mcp.NewTextContent(string(jsonData)))
+
+	return result
+}
+
+// nonNil replaces a nil slice with an empty one so it serializes as [] rather than null.
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+func truncationNote(truncated bool, maxResults int) string {
+	return limitNote(truncated, "max_results", maxResults)
+}
+
+// limitNote is truncationNote for a limit set by the named argument.
+func limitNote(truncated bool, argument string, limit int) string {
+	if !truncated {
+		return ""
+	}
+
+	return fmt.Sprintf(" (truncated at %s=%d; more results are available)", argument, limit)
+}
+
+// projectTruncationNote names the projects whose listing stopped at max_results_per_project.
+func projectTruncationNote(projects []string, maxPerProject int) string {
+	if len(projects) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" Listing stopped at max_results_per_project=%d in %d projects, which may have more matching pipelines: %s.",
+		maxPerProject, len(projects), strings.Join(projects, ", "))
+}
+
+func skippedNote(skipped int) string {
+	switch skipped {
+	case 0:
+		return ""
+	case 1:
+		return " 1 planned pipeline was skipped because it no longer exists or no longer matches the filter."
+	default:
+		return fmt.Sprintf(" %d planned pipelines were skipped because they no longer exist or no longer match the filter.", skipped)
+	}
+}
+
+func keptNote(kept int) string {
+	switch kept {
+	case 0:
+		return ""
+	case 1:
+		return ", besides 1 kept by the retention policy"
+	default:
+		return fmt.Sprintf(", besides %d kept by the retention policy", kept)
+	}
 }
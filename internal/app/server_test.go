@@ -2,18 +2,28 @@ package app
 
 import (
 	"context"
-	"io"
-	"log"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
+	serverpkg "github.com/mark3labs/mcp-go/server"
+	"github.com/ylchen07/gitlab-mcp-server/internal/audit"
+	"github.com/ylchen07/gitlab-mcp-server/internal/auth"
 	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab"
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab/gitlabtest"
+	gitlabapi "gitlab.com/gitlab-org/api/client-go"
 )
 
 func TestNewServerRegistersAllTools(t *testing.T) {
-	service := gitlab.NewService(nil, log.New(io.Discard, "", 0))
-	server := NewServer(service, log.New(io.Discard, "", 0))
+	service := gitlab.NewService(gitlab.Backend{}, slog.New(slog.DiscardHandler))
+	server := NewServer(service, slog.New(slog.DiscardHandler))
 
 	tools := server.AvailableTools()
 	if len(tools) < 7 {
@@ -22,6 +32,7 @@ func TestNewServerRegistersAllTools(t *testing.T) {
 
 	expected := map[string]bool{
 		"health_check":               true,
+		"whoami":                     true,
 		"list_all_group_projects":    true,
 		"list_direct_group_projects": true,
 		"list_subgroups":             true,
@@ -29,6 +40,8 @@ func TestNewServerRegistersAllTools(t *testing.T) {
 		"get_project_status":         true,
 		"list_old_pipelines":         true,
 		"delete_old_pipelines":       true,
+		"list_old_group_pipelines":   true,
+		"delete_old_group_pipelines": true,
 	}
 
 	for _, tool := range tools {
@@ -41,13 +54,20 @@ func TestNewServerRegistersAllTools(t *testing.T) {
 }
 
 func TestHandleHealthCheck(t *testing.T) {
-	server := NewServer(gitlab.NewService(nil, log.New(io.Discard, "", 0)), log.New(io.Discard, "", 0))
+	fake := gitlabtest.New()
+	fake.SetVersion("17.4.1", "abc123")
+	server := newGitLabTestServer(t, fake)
 
 	result, err := server.handleHealthCheck(context.Background(), mcp.CallToolRequest{})
 	if err != nil {
 		t.Fatalf("health check returned error: %v", err)
 	}
 
+	output, ok := result.StructuredContent.(HealthCheckOutput)
+	if !ok || output.Status != "healthy" || output.GitLab.GitLabVersion != "17.4.1" || output.GitLab.Username != "gitlabtest" {
+		t.Fatalf("unexpected health check output: %#v", result.StructuredContent)
+	}
+
 	var combined strings.Builder
 	for _, content := range result.Content {
 		if textContent, ok := content.(mcp.TextContent); ok {
@@ -59,3 +79,1421 @@ func TestHandleHealthCheck(t *testing.T) {
 		t.Fatalf("expected health check output to mention healthy, got %q", combined.String())
 	}
 }
+
+func TestHandleHealthCheckReportsUnhealthyGitLab(t *testing.T) {
+	fake := gitlabtest.New()
+	fake.InjectFault(gitlabtest.Fault{Path: "/version", Status: http.StatusUnauthorized, Message: "401 Unauthorized"})
+	server := newGitLabTestServer(t, fake)
+
+	result, err := server.handleHealthCheck(context.Background(), mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatalf("health check returned error: %v", err)
+	}
+
+	output := result.StructuredContent.(HealthCheckOutput)
+	if output.Status != "unhealthy" || len(output.GitLab.Problems) != 1 {
+		t.Fatalf("expected an unhealthy report with one problem, got %#v", output)
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	fake := gitlabtest.New()
+	server := newGitLabTestServer(t, fake)
+
+	mux := http.NewServeMux()
+	server.registerHTTPHandlers(mux, http.NotFoundHandler())
+
+	probe := func(path string) int {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+
+	if code := probe("/healthz"); code != http.StatusOK {
+		t.Fatalf("expected /healthz to answer 200, got %d", code)
+	}
+	if code := probe("/readyz"); code != http.StatusOK {
+		t.Fatalf("expected /readyz to answer 200 while GitLab is reachable, got %d", code)
+	}
+
+	fake.InjectFault(gitlabtest.Fault{Path: "/version", Status: http.StatusBadGateway})
+
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected /readyz to answer 503 while GitLab fails, got %d", code)
+	}
+	if code := probe("/healthz"); code != http.StatusOK {
+		t.Fatalf("expected /healthz to stay up while GitLab fails, got %d", code)
+	}
+}
+
+type fakeGroups struct {
+	groups      map[string]*gitlabapi.Group
+	descendants map[int][]*gitlabapi.Group
+	projects    map[int][]*gitlabapi.Project
+}
+
+func (f *fakeGroups) GetGroup(gid any, _ *gitlabapi.GetGroupOptions, _ ...gitlabapi.RequestOptionFunc) (*gitlabapi.Group, *gitlabapi.Response, error) {
+	group, ok := f.groups[fmt.Sprint(gid)]
+	if !ok {
+		return nil, nil, fmt.Errorf("group %v not found", gid)
+	}
+	return group, &gitlabapi.Response{}, nil
+}
+
+func (f *fakeGroups) ListGroupProjects(gid any, _ *gitlabapi.ListGroupProjectsOptions, _ ...gitlabapi.RequestOptionFunc) ([]*gitlabapi.Project, *gitlabapi.Response, error) {
+	return f.projects[gid.(int)], &gitlabapi.Response{}, nil
+}
+
+func (f *fakeGroups) ListDescendantGroups(gid any, _ *gitlabapi.ListDescendantGroupsOptions, _ ...gitlabapi.RequestOptionFunc) ([]*gitlabapi.Group, *gitlabapi.Response, error) {
+	return f.descendants[gid.(int)], &gitlabapi.Response{}, nil
+}
+
+func (f *fakeGroups) ListSubGroups(gid any, _ *gitlabapi.ListSubGroupsOptions, _ ...gitlabapi.RequestOptionFunc) ([]*gitlabapi.Group, *gitlabapi.Response, error) {
+	return f.descendants[gid.(int)], &gitlabapi.Response{}, nil
+}
+
+type fakeProjects struct {
+	projects map[string]*gitlabapi.Project
+}
+
+func (f *fakeProjects) GetProject(pid any, _ *gitlabapi.GetProjectOptions, _ ...gitlabapi.RequestOptionFunc) (*gitlabapi.Project, *gitlabapi.Response, error) {
+	project, ok := f.projects[fmt.Sprint(pid)]
+	if !ok {
+		return nil, nil, fmt.Errorf("project %v not found", pid)
+	}
+	return project, &gitlabapi.Response{}, nil
+}
+
+func (f *fakeProjects) ArchiveProject(pid any, _ ...gitlabapi.RequestOptionFunc) (*gitlabapi.Project, *gitlabapi.Response, error) {
+	project, ok := f.projects[fmt.Sprint(pid)]
+	if !ok {
+		return nil, nil, fmt.Errorf("project %v not found", pid)
+	}
+	project.Archived = true
+	return project, &gitlabapi.Response{}, nil
+}
+
+type fakePipelines struct {
+	pipelines map[string][]*gitlabapi.PipelineInfo
+	deleted   []int
+}
+
+func (f *fakePipelines) ListProjectPipelines(pid any, _ *gitlabapi.ListProjectPipelinesOptions, _ ...gitlabapi.RequestOptionFunc) ([]*gitlabapi.PipelineInfo, *gitlabapi.Response, error) {
+	return f.pipelines[fmt.Sprint(pid)], &gitlabapi.Response{}, nil
+}
+
+func (f *fakePipelines) DeletePipeline(_ any, pipeline int, _ ...gitlabapi.RequestOptionFunc) (*gitlabapi.Response, error) {
+	f.deleted = append(f.deleted, pipeline)
+	return &gitlabapi.Response{}, nil
+}
+
+type fakeUsers struct{}
+
+func (fakeUsers) CurrentUser(_ ...gitlabapi.RequestOptionFunc) (*gitlabapi.User, *gitlabapi.Response, error) {
+	return &gitlabapi.User{ID: 1, Username: "tester"}, &gitlabapi.Response{}, nil
+}
+
+type fakeAccessTokens struct{}
+
+func (fakeAccessTokens) GetSinglePersonalAccessToken(_ ...gitlabapi.RequestOptionFunc) (*gitlabapi.PersonalAccessToken, *gitlabapi.Response, error) {
+	return &gitlabapi.PersonalAccessToken{Name: "test", Scopes: []string{"api"}, Active: true}, &gitlabapi.Response{}, nil
+}
+
+type fakeProjectMembers struct{}
+
+func (fakeProjectMembers) GetInheritedProjectMember(_ any, user int, _ ...gitlabapi.RequestOptionFunc) (*gitlabapi.ProjectMember, *gitlabapi.Response, error) {
+	return &gitlabapi.ProjectMember{ID: user, AccessLevel: gitlabapi.OwnerPermissions}, &gitlabapi.Response{}, nil
+}
+
+func newFakeBackendServer(t *testing.T) (*Server, *fakeProjects, *fakePipelines) {
+	t.Helper()
+
+	root := &gitlabapi.Group{ID: 1, Name: "acme", Path: "acme", FullPath: "acme"}
+	sub := &gitlabapi.Group{ID: 2, Name: "tools", Path: "tools", FullPath: "acme/tools"}
+	oldCreated := time.Now().AddDate(-3, 0, 0)
+
+	groups := &fakeGroups{
+		groups:      map[string]*gitlabapi.Group{"acme": root, "1": root},
+		descendants: map[int][]*gitlabapi.Group{1: {sub}},
+		projects: map[int][]*gitlabapi.Project{
+			1: {{ID: 10, Name: "api", Path: "api", PathWithNamespace: "acme/api"}},
+			2: {{ID: 20, Name: "cli", Path: "cli", PathWithNamespace: "acme/tools/cli"}},
+		},
+	}
+	projects := &fakeProjects{projects: map[string]*gitlabapi.Project{
+		"acme/api": {ID: 10, Name: "api", Path: "api", PathWithNamespace: "acme/api"},
+	}}
+	pipelines := &fakePipelines{pipelines: map[string][]*gitlabapi.PipelineInfo{
+		"acme/api": {{ID: 501, ProjectID: 10, Status: "success", Ref: "main", CreatedAt: &oldCreated}},
+	}}
+
+	service := gitlab.NewService(gitlab.Backend{
+		Groups:         groups,
+		Projects:       projects,
+		Pipelines:      pipelines,
+		Users:          fakeUsers{},
+		AccessTokens:   fakeAccessTokens{},
+		ProjectMembers: fakeProjectMembers{},
+	}, slog.New(slog.DiscardHandler))
+
+	return NewServer(service, slog.New(slog.DiscardHandler)), projects, pipelines
+}
+
+func callTool(t *testing.T, handler func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), args map[string]any) string {
+	t.Helper()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = args
+
+	result, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("tool handler returned error: %v", err)
+	}
+
+	var combined strings.Builder
+	for _, content := range result.Content {
+		if textContent, ok := content.(mcp.TextContent); ok {
+			combined.WriteString(textContent.Text)
+		}
+	}
+
+	return combined.String()
+}
+
+func TestHandleListAllGroupProjectsWithFakeBackend(t *testing.T) {
+	server, _, _ := newFakeBackendServer(t)
+
+	output := callTool(t, server.handleListAllGroupProjects, map[string]any{"group_id_or_path": "acme"})
+
+	if !strings.Contains(output, "Found 2 all projects") {
+		t.Fatalf("expected two projects to be reported, got %q", output)
+	}
+	if !strings.Contains(output, "acme/tools/cli") {
+		t.Fatalf("expected subgroup project in output, got %q", output)
+	}
+}
+
+func TestHandleArchiveProjectWithFakeBackend(t *testing.T) {
+	server, projects, _ := newFakeBackendServer(t)
+
+	output := callTool(t, server.handleArchiveProject, map[string]any{"project_id_or_path": "acme/api"})
+	if !strings.Contains(output, "was not archived") || projects.projects["acme/api"].Archived {
+		t.Fatalf("expected archive to require confirmation, got %q", output)
+	}
+
+	output = callTool(t, server.handleArchiveProject, map[string]any{"project_id_or_path": "acme/api", "confirm": true})
+	if !strings.Contains(output, "archived successfully") {
+		t.Fatalf("expected archive confirmation, got %q", output)
+	}
+	if !projects.projects["acme/api"].Archived {
+		t.Fatal("expected project to be archived in the backend")
+	}
+}
+
+func TestHandleArchiveProjectChecksPermissionsBeforeConfirming(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	fake.SetAccessLevel("acme", gitlabapi.DeveloperPermissions)
+	server := newGitLabTestServer(t, fake)
+
+	output := callTool(t, server.handleArchiveProject, map[string]any{"project_id_or_path": "acme/api"})
+	if !strings.Contains(output, "[forbidden]") || !strings.Contains(output, "needs the Owner role on acme/api, but has Developer") {
+		t.Fatalf("expected the preflight to explain the missing role, got %q", output)
+	}
+	if fake.Project(project.ID).Archived {
+		t.Fatal("expected the project to stay unarchived")
+	}
+}
+
+func TestHandleWhoAmI(t *testing.T) {
+	fake := gitlabtest.New()
+	fake.AddProject("acme", "api")
+	fake.SetAccessLevel("acme", gitlabapi.MaintainerPermissions)
+	fake.SetAccessLevel("acme/api", gitlabapi.OwnerPermissions)
+	server := newGitLabTestServer(t, fake)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"project_id_or_path": "acme/api", "group_id_or_path": "acme"}
+
+	result, err := server.handleWhoAmI(context.Background(), request)
+	if err != nil || result.IsError {
+		t.Fatalf("whoami failed: %v %#v", err, result)
+	}
+
+	output := result.StructuredContent.(WhoAmIOutput)
+	if output.Identity.Username != "gitlabtest" || output.Identity.TokenScopes[0] != "api" {
+		t.Fatalf("unexpected identity: %#v", output.Identity)
+	}
+	if output.Project == nil || output.Project.Role != "Owner" || len(output.Project.Denied) != 0 {
+		t.Fatalf("expected Owner access to the project, got %#v", output.Project)
+	}
+	if output.Group == nil || output.Group.Role != "Maintainer" {
+		t.Fatalf("expected Maintainer access to the group, got %#v", output.Group)
+	}
+}
+
+// planDeletion lists the old pipelines of project through list_old_pipelines and returns the
+// structured output carrying the deletion plan.
+func planDeletion(t *testing.T, server *Server, project string) OldPipelinesOutput {
+	t.Helper()
+
+	return planDeletionIn(t, context.Background(), server, project)
+}
+
+// planDeletionIn is planDeletion for a call made with ctx, such as one bound to an MCP session.
+func planDeletionIn(t *testing.T, ctx context.Context, server *Server, project string) OldPipelinesOutput {
+	t.Helper()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"project_id_or_path": project, "older_than_years": 2}
+
+	result, err := server.handleListOldPipelines(ctx, request)
+	if err != nil || result.IsError {
+		t.Fatalf("list_old_pipelines failed: %v %#v", err, result)
+	}
+
+	output, ok := result.StructuredContent.(OldPipelinesOutput)
+	if !ok || output.PlanID == "" || output.Checksum == "" {
+		t.Fatalf("expected a deletion plan, got %#v", result.StructuredContent)
+	}
+
+	return output
+}
+
+func TestHandleDeleteOldPipelinesWithFakeBackend(t *testing.T) {
+	server, _, pipelines := newFakeBackendServer(t)
+
+	plan := planDeletion(t, server, "acme/api")
+
+	output := callTool(t, server.handleDeleteOldPipelines, map[string]any{
+		"plan_id": plan.PlanID,
+	})
+	if !strings.Contains(output, "Deletion not performed") || len(pipelines.deleted) != 0 {
+		t.Fatalf("expected deletion to require confirmation, got %q (deleted %v)", output, pipelines.deleted)
+	}
+
+	output = callTool(t, server.handleDeleteOldPipelines, map[string]any{
+		"plan_id":  plan.PlanID,
+		"checksum": plan.Checksum,
+		"confirm":  true,
+	})
+	if !strings.Contains(output, "Deleted 1/1 pipelines") {
+		t.Fatalf("expected deletion summary, got %q", output)
+	}
+	if len(pipelines.deleted) != 1 || pipelines.deleted[0] != 501 {
+		t.Fatalf("expected pipeline 501 to be deleted, got %v", pipelines.deleted)
+	}
+
+	output = callTool(t, server.handleDeleteOldPipelines, map[string]any{"plan_id": plan.PlanID, "confirm": true})
+	if !strings.Contains(output, "[not_found]") {
+		t.Fatalf("expected an applied plan to be rejected, got %q", output)
+	}
+}
+
+func TestHandleDeleteOldPipelinesDeletesOnlyPlannedPipelines(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	created := time.Now().AddDate(-5, 0, 0)
+	reviewed := fake.AddPipeline(project.ID, gitlabapi.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &created})
+
+	server := newGitLabTestServer(t, fake)
+	plan := planDeletion(t, server, "acme/api")
+
+	// A pipeline that became eligible after the review must survive the apply.
+	late := fake.AddPipeline(project.ID, gitlabapi.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &created})
+
+	output := callTool(t, server.handleDeleteOldPipelines, map[string]any{"plan_id": plan.PlanID, "confirm": true})
+	if !strings.Contains(output, "Deleted 1/1 pipelines") {
+		t.Fatalf("expected only the planned pipeline to be deleted, got %q", output)
+	}
+
+	remaining := fake.Pipelines(project.ID)
+	if len(remaining) != 1 || remaining[0].ID != late.ID || remaining[0].ID == reviewed.ID {
+		t.Fatalf("expected pipeline %d to remain, got %#v", late.ID, remaining)
+	}
+}
+
+func TestHandleDeleteOldPipelinesSkipsPipelinesGoneSincePlanning(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	created := time.Now().AddDate(-5, 0, 0)
+	kept := fake.AddPipeline(project.ID, gitlabapi.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &created})
+	gone := fake.AddPipeline(project.ID, gitlabapi.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &created})
+
+	server := newGitLabTestServer(t, fake)
+	plan := planDeletion(t, server, "acme/api")
+
+	client, err := fake.NewClient(gitlabapi.WithoutRetries())
+	if err != nil {
+		t.Fatalf("create gitlabtest client: %v", err)
+	}
+	if _, err := client.Pipelines.DeletePipeline(project.ID, gone.ID); err != nil {
+		t.Fatalf("DeletePipeline: %v", err)
+	}
+
+	output := callTool(t, server.handleDeleteOldPipelines, map[string]any{"plan_id": plan.PlanID, "confirm": true})
+	if !strings.Contains(output, "Deleted 1/2 pipelines") || !strings.Contains(output, "1 planned pipeline was skipped") ||
+		!strings.Contains(output, fmt.Sprintf(`"skipped_ids": [
+    %d
+  ]`, gone.ID)) {
+		t.Fatalf("expected the pipeline deleted since planning to be skipped, got %q", output)
+	}
+	if remaining := fake.Pipelines(project.ID); len(remaining) != 0 {
+		t.Fatalf("expected pipeline %d to be deleted, got %#v", kept.ID, remaining)
+	}
+}
+
+// namedSession is a notificationSession with a chosen session ID.
+type namedSession struct {
+	notificationSession
+	id string
+}
+
+func (s *namedSession) SessionID() string { return s.id }
+
+func TestDeletionPlansBelongToTheirCaller(t *testing.T) {
+	sessionCtx := func(server *Server, id string) context.Context {
+		return server.mcpServer.WithContext(context.Background(), &namedSession{id: id})
+	}
+	callerCtx := func(hash string) context.Context {
+		return context.WithValue(context.Background(), callerContextKey{}, hash)
+	}
+
+	tests := []struct {
+		name          string
+		owner, caller func(server *Server) context.Context
+	}{
+		{
+			name:   "other session",
+			owner:  func(server *Server) context.Context { return sessionCtx(server, "session-a") },
+			caller: func(server *Server) context.Context { return sessionCtx(server, "session-b") },
+		},
+		{
+			name:   "other token",
+			owner:  func(*Server) context.Context { return callerCtx("token-a") },
+			caller: func(*Server) context.Context { return callerCtx("token-b") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _, pipelines := newFakeBackendServer(t)
+			plan := planDeletionIn(t, tt.owner(server), server, "acme/api")
+
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = map[string]any{"plan_id": plan.PlanID, "confirm": true}
+
+			result, err := server.handleDeleteOldPipelines(tt.caller(server), request)
+			if err != nil {
+				t.Fatalf("handleDeleteOldPipelines returned error: %v", err)
+			}
+			if toolErr, ok := result.StructuredContent.(ToolError); !ok || toolErr.Category != gitlab.ErrorCategoryNotFound {
+				t.Fatalf("expected another caller's plan to be not found, got %#v", result.StructuredContent)
+			}
+			if len(pipelines.deleted) != 0 {
+				t.Fatalf("expected nothing to be deleted, got %v", pipelines.deleted)
+			}
+
+			result, err = server.handleDeleteOldPipelines(tt.owner(server), request)
+			if err != nil || result.IsError {
+				t.Fatalf("expected the owner to apply the plan, got %v %#v", err, result)
+			}
+			if len(pipelines.deleted) != 1 {
+				t.Fatalf("expected the owner's deletion to run, got %v", pipelines.deleted)
+			}
+		})
+	}
+}
+
+func TestHandleOldGroupPipelines(t *testing.T) {
+	fake := gitlabtest.New()
+	api := fake.AddProject("acme", "api")
+	web := fake.AddProject("acme/frontend", "web")
+	fake.AddProject("acme", "docs")
+	fake.SetAccessLevel("acme/api", gitlabapi.OwnerPermissions)
+	fake.SetAccessLevel("acme/frontend/web", gitlabapi.DeveloperPermissions)
+	fake.SetAccessLevel("acme/docs", gitlabapi.OwnerPermissions)
+
+	created := time.Now().AddDate(-3, 0, 0)
+	apiPipeline := fake.AddPipeline(api.ID, gitlabapi.PipelineInfo{Status: "failed", Ref: "main", CreatedAt: &created})
+	webPipeline := fake.AddPipeline(web.ID, gitlabapi.PipelineInfo{Status: "failed", Ref: "main", CreatedAt: &created})
+
+	server := newGitLabTestServer(t, fake)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"group_id_or_path": "acme", "older_than": "P1Y", "statuses": []any{"failed"}}
+
+	result, err := server.handleListOldGroupPipelines(context.Background(), request)
+	if err != nil || result.IsError {
+		t.Fatalf("list_old_group_pipelines failed: %v %#v", err, result)
+	}
+
+	listed := result.StructuredContent.(OldGroupPipelinesOutput)
+	if listed.ProjectCount != 3 || listed.Count != 2 || listed.PlanID == "" || !listed.SkipArchived {
+		t.Fatalf("expected a plan for 2 pipelines across 3 projects, got %#v", listed)
+	}
+	for _, project := range listed.Projects {
+		if project.Project == "acme/api" && (project.Count != 1 || project.PipelineIDs[0] != apiPipeline.ID) {
+			t.Fatalf("expected the acme/api pipeline to be planned, got %#v", project)
+		}
+	}
+
+	summary := result.Content[0].(mcp.TextContent).Text
+	if !strings.Contains(summary, "Found 2 pipelines in 2 of the 3 projects of group acme") {
+		t.Fatalf("expected a group summary, got %q", summary)
+	}
+
+	if output := callTool(t, server.handleDeleteOldGroupPipelines, map[string]any{"plan_id": listed.PlanID}); !strings.Contains(output, "Deletion not performed") ||
+		!strings.Contains(output, "cannot delete pipelines in 1 projects:\n- acme/frontend/web") {
+		t.Fatalf("expected deletion to require confirmation and name the denied project, got %q", output)
+	}
+	if output := callTool(t, server.handleDeleteOldPipelines, map[string]any{"plan_id": listed.PlanID, "confirm": true}); !strings.Contains(output, "[not_found]") {
+		t.Fatalf("expected a group plan to be refused by delete_old_pipelines, got %q", output)
+	}
+
+	request.Params.Arguments = map[string]any{"plan_id": listed.PlanID, "checksum": listed.Checksum, "confirm": true}
+	result, err = server.handleDeleteOldGroupPipelines(context.Background(), request)
+	if err != nil || result.IsError {
+		t.Fatalf("delete_old_group_pipelines failed: %v %#v", err, result)
+	}
+
+	deleted := result.StructuredContent.(DeleteOldGroupPipelinesOutput)
+	if !deleted.Performed || deleted.DeletedCount != 1 || deleted.FailedCount != 1 || deleted.TotalCandidates != 2 {
+		t.Fatalf("expected one deletion and one preflight failure, got %#v", deleted)
+	}
+	for _, project := range deleted.Projects {
+		if project.Project == "acme/frontend/web" && !strings.Contains(project.Error, "needs the Owner role") {
+			t.Fatalf("expected the web project to report the missing role, got %#v", project)
+		}
+	}
+	if len(fake.Pipelines(api.ID)) != 0 || len(fake.Pipelines(web.ID)) != 1 || fake.Pipelines(web.ID)[0].ID != webPipeline.ID {
+		t.Fatal("expected only the acme/api pipeline to be deleted")
+	}
+
+	summary = result.Content[0].(mcp.TextContent).Text
+	if !strings.Contains(summary, "Deleted 1/2 pipelines from 2 projects of group acme") || !strings.Contains(summary, "1 deletions failed") {
+		t.Fatalf("expected the summary to report the partial deletion, got %q", summary)
+	}
+}
+
+func TestHandleOldGroupPipelinesReportsLimits(t *testing.T) {
+	fake := gitlabtest.New()
+	api := fake.AddProject("acme", "api")
+	web := fake.AddProject("acme", "web")
+	fake.AddProject("acme", "docs")
+
+	created := time.Now().AddDate(-3, 0, 0)
+	for range 2 {
+		fake.AddPipeline(api.ID, gitlabapi.PipelineInfo{Status: "failed", Ref: "main", CreatedAt: &created})
+		fake.AddPipeline(web.ID, gitlabapi.PipelineInfo{Status: "failed", Ref: "main", CreatedAt: &created})
+	}
+
+	server := newGitLabTestServer(t, fake)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"group_id_or_path": "acme", "older_than": "P1Y", "max_projects": 2, "max_results_per_project": 1}
+
+	result, err := server.handleListOldGroupPipelines(context.Background(), request)
+	if err != nil || result.IsError {
+		t.Fatalf("list_old_group_pipelines failed: %v %#v", err, result)
+	}
+
+	listed := result.StructuredContent.(OldGroupPipelinesOutput)
+	if !listed.Truncated || len(listed.TruncatedProjects) != 2 {
+		t.Fatalf("expected the group and both projects to be truncated, got %#v", listed)
+	}
+	for _, project := range listed.Projects {
+		if !project.Truncated {
+			t.Fatalf("expected %s to report its truncation, got %#v", project.Project, project)
+		}
+	}
+
+	summary := result.Content[0].(mcp.TextContent).Text
+	if !strings.Contains(summary, "truncated at max_projects=2") || strings.Contains(summary, "max_results=") ||
+		!strings.Contains(summary, "max_results_per_project=1 in 2 projects") {
+		t.Fatalf("expected the summary to name both limits, got %q", summary)
+	}
+}
+
+func TestHandleDeleteOldGroupPipelinesRefusesWhenNoProjectIsPermitted(t *testing.T) {
+	fake := gitlabtest.New()
+	api := fake.AddProject("acme", "api")
+	fake.SetAccessLevel("acme/api", gitlabapi.MaintainerPermissions)
+
+	created := time.Now().AddDate(-3, 0, 0)
+	fake.AddPipeline(api.ID, gitlabapi.PipelineInfo{Status: "failed", Ref: "main", CreatedAt: &created})
+
+	server := newGitLabTestServer(t, fake)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"group_id_or_path": "acme", "older_than": "P1Y"}
+	result, err := server.handleListOldGroupPipelines(context.Background(), request)
+	if err != nil || result.IsError {
+		t.Fatalf("list_old_group_pipelines failed: %v %#v", err, result)
+	}
+	listed := result.StructuredContent.(OldGroupPipelinesOutput)
+
+	output := callTool(t, server.handleDeleteOldGroupPipelines, map[string]any{"plan_id": listed.PlanID, "confirm": true})
+	if !strings.Contains(output, "[forbidden]") || !strings.Contains(output, "acme/api") {
+		t.Fatalf("expected the deletion to be refused before confirmation, got %q", output)
+	}
+	if len(fake.Pipelines(api.ID)) != 1 {
+		t.Fatal("expected the pipeline to be kept")
+	}
+}
+
+func TestHandleDeleteOldPipelinesRejectsStalePlans(t *testing.T) {
+	server, _, pipelines := newFakeBackendServer(t)
+	server.plans = gitlab.NewPlanStore(time.Nanosecond)
+
+	plan := planDeletion(t, server, "acme/api")
+	time.Sleep(time.Millisecond)
+
+	output := callTool(t, server.handleDeleteOldPipelines, map[string]any{"plan_id": plan.PlanID, "confirm": true})
+	if !strings.Contains(output, "[validation]") || !strings.Contains(output, "expired") {
+		t.Fatalf("expected expired plan to be refused, got %q", output)
+	}
+
+	server.plans = gitlab.NewPlanStore(time.Hour)
+	plan = planDeletion(t, server, "acme/api")
+
+	output = callTool(t, server.handleDeleteOldPipelines, map[string]any{
+		"plan_id":  plan.PlanID,
+		"checksum": "sha256:tampered",
+		"confirm":  true,
+	})
+	if !strings.Contains(output, "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch to be refused, got %q", output)
+	}
+	if len(pipelines.deleted) != 0 {
+		t.Fatalf("expected no deletions for rejected plans, got %v", pipelines.deleted)
+	}
+}
+
+func TestPipelineFilter(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		args       map[string]any
+		wantBefore time.Time
+		wantAfter  time.Time
+		wantErr    string
+	}{
+		{name: "years", args: map[string]any{"older_than_years": 2}, wantBefore: now.AddDate(-2, 0, 0)},
+		{name: "ISO days", args: map[string]any{"older_than": "P90D"}, wantBefore: now.AddDate(0, 0, -90)},
+		{name: "ISO mixed", args: map[string]any{"older_than": "p1y2wt12h"}, wantBefore: now.AddDate(-1, 0, -14).Add(-12 * time.Hour)},
+		{name: "Go duration", args: map[string]any{"older_than": "2160h"}, wantBefore: now.Add(-2160 * time.Hour)},
+		{
+			name:       "window",
+			args:       map[string]any{"before": "2025-01-01", "after": "2024-06-01T00:00:00+02:00"},
+			wantBefore: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			wantAfter:  time.Date(2024, 5, 31, 22, 0, 0, 0, time.UTC),
+		},
+		{name: "null and blank cutoffs", args: map[string]any{"older_than": nil, "older_than_years": "", "before": "2025-01-01"}, wantBefore: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "only blank cutoffs", args: map[string]any{"older_than": " ", "before": nil}, wantErr: "one of older_than, older_than_years, before is required"},
+		{name: "no cutoff", args: map[string]any{"after": "2024-01-01"}, wantErr: "one of older_than, older_than_years, before is required"},
+		{name: "two cutoffs", args: map[string]any{"older_than": "P1D", "before": "2024-01-01"}, wantErr: "older_than and before cannot be combined"},
+		{name: "zero age", args: map[string]any{"older_than": "P0D"}, wantErr: "greater than zero"},
+		{name: "bare P", args: map[string]any{"older_than": "P"}, wantErr: "ISO 8601 duration"},
+		{name: "days shorthand", args: map[string]any{"older_than": "90d"}, wantErr: "ISO 8601 duration"},
+		{name: "future before", args: map[string]any{"before": "2027-01-01"}, wantErr: "in the future"},
+		{name: "empty window", args: map[string]any{"older_than": "P30D", "after": "2026-03-15"}, wantErr: "earlier than the cutoff"},
+		{name: "bad timestamp", args: map[string]any{"before": "last tuesday"}, wantErr: "RFC 3339"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = tt.args
+
+			filter, err := pipelineFilter(request, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error mentioning %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("pipelineFilter returned error: %v", err)
+			}
+			if !filter.CreatedBefore.Equal(tt.wantBefore) || !filter.CreatedAfter.Equal(tt.wantAfter) {
+				t.Fatalf("expected window %s..%s, got %s..%s", tt.wantAfter, tt.wantBefore, filter.CreatedAfter, filter.CreatedBefore)
+			}
+		})
+	}
+}
+
+func TestHandleListOldPipelinesAppliesFilters(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	created := time.Now().AddDate(-1, 0, 0)
+	fake.AddPipeline(project.ID, gitlabapi.PipelineInfo{Status: "failed", Source: "push", Ref: "main", CreatedAt: &created})
+	gone := fake.AddPipeline(project.ID, gitlabapi.PipelineInfo{Status: "failed", Source: "push", Ref: "feature/gone", CreatedAt: &created})
+	fake.AddPipeline(project.ID, gitlabapi.PipelineInfo{Status: "success", Source: "push", Ref: "feature/gone", CreatedAt: &created})
+
+	server := newGitLabTestServer(t, fake)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{
+		"project_id_or_path": "acme/api",
+		"older_than":         "P30D",
+		"statuses":           []any{"failed", " canceled "},
+		"refs":               []any{"feature/*"},
+		"ref_deleted":        true,
+	}
+
+	result, err := server.handleListOldPipelines(context.Background(), request)
+	if err != nil || result.IsError {
+		t.Fatalf("list_old_pipelines failed: %v %#v", err, result)
+	}
+
+	output := result.StructuredContent.(OldPipelinesOutput)
+	if output.Count != 1 || output.Pipelines[0].ID != gone.ID {
+		t.Fatalf("expected only the failed pipeline on the deleted branch, got %#v", output.Pipelines)
+	}
+	if len(output.Statuses) != 2 || output.Statuses[1] != "canceled" || !output.RefDeleted {
+		t.Fatalf("expected the filters to be echoed, got %#v", output.PipelineFilterOutput)
+	}
+
+	summary := result.Content[0].(mcp.TextContent).Text
+	if !strings.Contains(summary, "with status failed or canceled on refs matching feature/* whose ref no longer exists") {
+		t.Fatalf("expected the summary to describe the filters, got %q", summary)
+	}
+
+	preview := callTool(t, server.handleDeleteOldPipelines, map[string]any{"plan_id": output.PlanID})
+	if !strings.Contains(preview, `"ref_deleted": true`) {
+		t.Fatalf("expected the plan to carry the filters, got %q", preview)
+	}
+
+	request.Params.Arguments = map[string]any{"project_id_or_path": "acme/api", "older_than": "P30D", "statuses": []any{"broken"}}
+	if result, _ := server.handleListOldPipelines(context.Background(), request); !result.IsError {
+		t.Fatal("expected an unknown status to be rejected")
+	}
+}
+
+func TestHandleListOldPipelinesKeepsRetainedPipelines(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	created := time.Now().AddDate(-1, 0, 0)
+	stale := fake.AddPipeline(project.ID, gitlabapi.PipelineInfo{Status: "failed", Ref: "main", CreatedAt: &created})
+	latest := fake.AddPipeline(project.ID, gitlabapi.PipelineInfo{Status: "failed", Ref: "main", CreatedAt: &created})
+
+	server := newGitLabTestServer(t, fake)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{
+		"project_id_or_path":  "acme/api",
+		"older_than":          "P30D",
+		"keep_latest_per_ref": 1,
+	}
+
+	result, err := server.handleListOldPipelines(context.Background(), request)
+	if err != nil || result.IsError {
+		t.Fatalf("list_old_pipelines failed: %v %#v", err, result)
+	}
+
+	output := result.StructuredContent.(OldPipelinesOutput)
+	if output.Count != 1 || output.Pipelines[0].ID != stale.ID {
+		t.Fatalf("expected only the older pipeline to be planned for deletion, got %#v", output.Pipelines)
+	}
+	if output.KeptCount != 1 || output.Kept[0].ID != latest.ID || output.Kept[0].Reasons[0] != "the most recent pipeline on main" {
+		t.Fatalf("expected the latest pipeline to be kept with its reason, got %#v", output.Kept)
+	}
+	if output.Retention == nil || output.Retention.KeepLatestPerRef != 1 {
+		t.Fatalf("expected the retention policy to be echoed, got %#v", output.Retention)
+	}
+
+	summary := result.Content[0].(mcp.TextContent).Text
+	if !strings.Contains(summary, "besides 1 kept by the retention policy") {
+		t.Fatalf("expected the summary to mention the kept pipeline, got %q", summary)
+	}
+
+	preview := callTool(t, server.handleDeleteOldPipelines, map[string]any{"plan_id": output.PlanID})
+	if !strings.Contains(preview, `"total_candidates": 1`) {
+		t.Fatalf("expected the plan to hold only the pipeline to delete, got %q", preview)
+	}
+
+	request.Params.Arguments = map[string]any{"project_id_or_path": "acme/api", "older_than": "P30D", "keep_latest_per_ref": 2}
+	result, err = server.handleListOldPipelines(context.Background(), request)
+	if err != nil || result.IsError {
+		t.Fatalf("list_old_pipelines failed: %v %#v", err, result)
+	}
+	if output := result.StructuredContent.(OldPipelinesOutput); output.Count != 0 || output.KeptCount != 2 || output.PlanID != "" {
+		t.Fatalf("expected every pipeline to be kept without a plan, got %#v", output)
+	}
+
+	request.Params.Arguments = map[string]any{"project_id_or_path": "acme/api", "older_than": "P30D", "keep_latest_per_ref": -1}
+	if result, _ := server.handleListOldPipelines(context.Background(), request); !result.IsError {
+		t.Fatal("expected a negative keep_latest_per_ref to be rejected")
+	}
+}
+
+func TestHandleListOldPipelinesWithinWindow(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	for _, age := range []int{10, 100, 400} {
+		created := time.Now().AddDate(0, 0, -age)
+		fake.AddPipeline(project.ID, gitlabapi.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &created})
+	}
+
+	server := newGitLabTestServer(t, fake)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{
+		"project_id_or_path": "acme/api",
+		"older_than":         "P90D",
+		"after":              time.Now().AddDate(-1, 0, 0).Format(time.RFC3339),
+	}
+
+	result, err := server.handleListOldPipelines(context.Background(), request)
+	if err != nil || result.IsError {
+		t.Fatalf("list_old_pipelines failed: %v %#v", err, result)
+	}
+
+	output := result.StructuredContent.(OldPipelinesOutput)
+	if output.Count != 1 || output.Pipelines[0].AgeDays != 100 || output.OlderThan != "P90D" || output.After == "" {
+		t.Fatalf("expected only the 100 day old pipeline, got %#v", output)
+	}
+
+	deleted := callTool(t, server.handleDeleteOldPipelines, map[string]any{"plan_id": output.PlanID, "confirm": true})
+	if !strings.Contains(deleted, "Deleted 1/1 pipelines") || len(fake.Pipelines(project.ID)) != 2 {
+		t.Fatalf("expected the planned pipeline to be deleted, got %q", deleted)
+	}
+}
+
+func newGitLabTestServer(t *testing.T, fake *gitlabtest.Server, opts ...ServerOption) *Server {
+	t.Helper()
+
+	client, err := fake.NewClient(gitlabapi.WithoutRetries())
+	if err != nil {
+		t.Fatalf("create gitlabtest client: %v", err)
+	}
+
+	service := gitlab.NewService(gitlab.BackendFromClient(client), slog.New(slog.DiscardHandler))
+
+	return NewServer(service, slog.New(slog.DiscardHandler), opts...)
+}
+
+func TestHTTPHandlersRequireBearerToken(t *testing.T) {
+	const token = "mcp-client-token-0123456789"
+
+	bearer, err := auth.NewBearer([]string{token})
+	if err != nil {
+		t.Fatalf("NewBearer returned error: %v", err)
+	}
+
+	client, err := gitlabtest.New().NewClient(gitlabapi.WithoutRetries())
+	if err != nil {
+		t.Fatalf("create gitlabtest client: %v", err)
+	}
+	server := NewServer(gitlab.NewService(gitlab.BackendFromClient(client), slog.New(slog.DiscardHandler)), slog.New(slog.DiscardHandler),
+		WithBearerAuth(bearer))
+
+	mux := http.NewServeMux()
+	server.registerHTTPHandlers(mux, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	serve := func(path, authorization string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if code := serve("/mcp", "").Code; code != http.StatusUnauthorized {
+		t.Fatalf("expected unauthenticated MCP requests to be rejected, got %d", code)
+	}
+	if code := serve("/mcp", "Bearer "+token).Code; code != http.StatusAccepted {
+		t.Fatalf("expected authenticated MCP requests to reach the handler, got %d", code)
+	}
+
+	if body := serve("/readyz", "").Body.String(); strings.Contains(body, "gitlabtest") {
+		t.Fatalf("expected unauthenticated readiness probes to hide the GitLab user, got %s", body)
+	}
+	if body := serve("/readyz", "Bearer "+token).Body.String(); !strings.Contains(body, "gitlabtest") {
+		t.Fatalf("expected authenticated readiness probes to include the report, got %s", body)
+	}
+	if code := serve("/healthz", "").Code; code != http.StatusOK {
+		t.Fatalf("expected liveness probes to stay open, got %d", code)
+	}
+}
+
+func TestPerCallerTokensRunToolsAsCaller(t *testing.T) {
+	fakes := map[string]*gitlabtest.Server{}
+	for _, name := range []string{"alice", "bob", "mallory"} {
+		fake := gitlabtest.New()
+		fake.SetCurrentUser(gitlabapi.User{ID: 1, Username: name})
+		fakes[name+"-token"] = fake
+	}
+	fakes["mallory-token"].InjectFault(gitlabtest.Fault{Path: "/user", Status: http.StatusUnauthorized})
+
+	var created []string
+	newService := func(token string) (*gitlab.Service, error) {
+		created = append(created, token)
+		client, err := fakes[token].NewClient(gitlabapi.WithoutRetries())
+		if err != nil {
+			return nil, err
+		}
+		return gitlab.NewService(gitlab.BackendFromClient(client), slog.New(slog.DiscardHandler)), nil
+	}
+
+	server := NewServer(nil, slog.New(slog.DiscardHandler), WithPerCallerTokens(newService, 1))
+
+	mux := http.NewServeMux()
+	server.registerHTTPHandlers(mux, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := server.handleWhoAmI(r.Context(), mcp.CallToolRequest{})
+		if err != nil || result.IsError {
+			t.Errorf("whoami failed: %v %#v", err, result)
+			return
+		}
+		fmt.Fprint(w, result.StructuredContent.(WhoAmIOutput).Identity.Username)
+	}))
+
+	call := func(token string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		if token != "" {
+			request.Header.Set(CallerTokenHeader, token)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if code := call("").Code; code != http.StatusUnauthorized {
+		t.Fatalf("expected requests without a GitLab token to be rejected, got %d", code)
+	}
+	if code := call("mallory-token").Code; code != http.StatusUnauthorized {
+		t.Fatalf("expected a token GitLab rejects to be refused, got %d", code)
+	}
+	if server.callers.len() != 0 {
+		t.Fatal("expected rejected tokens not to be cached")
+	}
+
+	for _, caller := range []string{"alice", "alice", "bob", "alice"} {
+		if got := call(caller + "-token").Body.String(); got != caller {
+			t.Fatalf("expected tools to run as %s, got %q", caller, got)
+		}
+	}
+
+	// With room for one client, alice's is rebuilt after bob's request evicted it.
+	if want := "mallory-token,alice-token,bob-token,alice-token"; strings.Join(created, ",") != want {
+		t.Fatalf("expected clients to be created for %s, got %v", want, created)
+	}
+	if server.callers.len() != 1 {
+		t.Fatalf("expected the cache to stay within its bound, got %d entries", server.callers.len())
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected /readyz to answer 200 without a server-wide token, got %d", recorder.Code)
+	}
+}
+
+func TestHandleListSubgroupsFollowsPagination(t *testing.T) {
+	fake := gitlabtest.New()
+	for i := 0; i < 150; i++ {
+		fake.AddGroup(fmt.Sprintf("acme/team-%03d", i))
+	}
+
+	server := newGitLabTestServer(t, fake)
+
+	output := callTool(t, server.handleListSubgroups, map[string]any{"group_id_or_path": "acme"})
+	if !strings.Contains(output, "Found 150 subgroups") {
+		t.Fatalf("expected all 150 subgroups across pages, got %q", output[:min(len(output), 200)])
+	}
+
+	output = callTool(t, server.handleListSubgroups, map[string]any{"group_id_or_path": "acme", "max_results": 120})
+	if !strings.Contains(output, "Found 120 subgroups") || !strings.Contains(output, `"truncated": true`) {
+		t.Fatalf("expected truncated listing of 120 subgroups, got %q", output[:min(len(output), 200)])
+	}
+}
+
+func TestHandleListAllGroupProjectsReportsFailedSubgroups(t *testing.T) {
+	fake := gitlabtest.New()
+	fake.AddProject("acme", "api")
+	fake.AddProject("acme/tools", "cli")
+	fake.AddProject("acme/secret", "vault")
+	fake.InjectFault(gitlabtest.Fault{Path: "/groups/acme/secret/projects", Status: http.StatusForbidden})
+
+	server := newGitLabTestServer(t, fake)
+
+	output := callTool(t, server.handleListAllGroupProjects, map[string]any{"group_id_or_path": "acme"})
+	if !strings.Contains(output, "Results are incomplete") || !strings.Contains(output, "acme/secret") {
+		t.Fatalf("expected failed subgroup warning, got %q", output)
+	}
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"group_id_or_path": "acme", "fail_fast": true}
+
+	result, err := server.handleListAllGroupProjects(context.Background(), request)
+	if err != nil {
+		t.Fatalf("tool handler returned error: %v", err)
+	}
+	if !result.IsError {
+		t.Fatal("expected fail_fast to produce a tool error")
+	}
+}
+
+func TestToolsDeclareOutputSchemas(t *testing.T) {
+	server, _, _ := newFakeBackendServer(t)
+
+	for name, tool := range server.mcpServer.ListTools() {
+		if tool.Tool.OutputSchema.Type != "object" || len(tool.Tool.OutputSchema.Properties) == 0 {
+			t.Errorf("tool %s does not declare an output schema", name)
+		}
+	}
+}
+
+func TestHandleListAllGroupProjectsReturnsStructuredContent(t *testing.T) {
+	server, _, _ := newFakeBackendServer(t)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"group_id_or_path": "acme"}
+
+	result, err := server.handleListAllGroupProjects(context.Background(), request)
+	if err != nil {
+		t.Fatalf("tool handler returned error: %v", err)
+	}
+
+	output, ok := result.StructuredContent.(ProjectListOutput)
+	if !ok {
+		t.Fatalf("expected ProjectListOutput structured content, got %T", result.StructuredContent)
+	}
+
+	if output.Count != 2 || len(output.Projects) != 2 || output.Projects[1].SubgroupFullPath != "acme/tools" {
+		t.Fatalf("unexpected structured output: %#v", output)
+	}
+}
+
+func TestToolErrorsCarryCategories(t *testing.T) {
+	fake := gitlabtest.New()
+	fake.AddProject("acme", "api")
+	fake.InjectFault(gitlabtest.Fault{Method: http.MethodPost, Path: "/projects/acme/api/archive", Status: http.StatusForbidden})
+	fake.InjectFault(gitlabtest.Fault{Path: "/groups/acme/subgroups", Status: http.StatusBadGateway})
+
+	server := newGitLabTestServer(t, fake)
+
+	tests := []struct {
+		name     string
+		handler  func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)
+		args     map[string]any
+		category gitlab.ErrorCategory
+	}{
+		{"not found", server.handleGetProjectStatus, map[string]any{"project_id_or_path": "acme/missing"}, gitlab.ErrorCategoryNotFound},
+		{"forbidden", server.handleArchiveProject, map[string]any{"project_id_or_path": "acme/api", "confirm": true}, gitlab.ErrorCategoryForbidden},
+		{"upstream", server.handleListSubgroups, map[string]any{"group_id_or_path": "acme"}, gitlab.ErrorCategoryUpstream5xx},
+		{"validation", server.handleListOldPipelines, map[string]any{"project_id_or_path": "acme/api", "older_than_years": 0}, gitlab.ErrorCategoryValidation},
+		{"missing argument", server.handleListSubgroups, map[string]any{}, gitlab.ErrorCategoryValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = tt.args
+
+			result, err := tt.handler(context.Background(), request)
+			if err != nil {
+				t.Fatalf("tool handler returned error: %v", err)
+			}
+			if !result.IsError {
+				t.Fatal("expected an error result")
+			}
+
+			toolErr, ok := result.StructuredContent.(ToolError)
+			if !ok {
+				t.Fatalf("expected ToolError structured content, got %T", result.StructuredContent)
+			}
+			if toolErr.Category != tt.category {
+				t.Fatalf("expected category %s, got %s (%s)", tt.category, toolErr.Category, toolErr.Message)
+			}
+		})
+	}
+}
+
+func TestServerAdvertisesLoggingCapability(t *testing.T) {
+	server, _, _ := newFakeBackendServer(t)
+
+	response := server.mcpServer.HandleMessage(context.Background(),
+		[]byte(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1.0.0"}}}`))
+
+	rpc, ok := response.(mcp.JSONRPCResponse)
+	if !ok {
+		t.Fatalf("expected JSON-RPC response, got %T", response)
+	}
+	result, ok := rpc.Result.(mcp.InitializeResult)
+	if !ok {
+		t.Fatalf("expected initialize result, got %T", rpc.Result)
+	}
+	if result.Capabilities.Logging == nil {
+		t.Fatal("expected server to advertise the logging capability")
+	}
+}
+
+type notificationSession struct {
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *notificationSession) Initialize()       {}
+func (s *notificationSession) Initialized() bool { return true }
+func (s *notificationSession) SessionID() string { return "test-session" }
+func (s *notificationSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func TestHandleDeleteOldPipelinesSendsProgress(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	created := time.Now().AddDate(-5, 0, 0)
+	for i := 0; i < 3; i++ {
+		fake.AddPipeline(project.ID, gitlabapi.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &created})
+	}
+
+	server := newGitLabTestServer(t, fake)
+	session := &notificationSession{notifications: make(chan mcp.JSONRPCNotification, 10)}
+	ctx := server.mcpServer.WithContext(context.Background(), session)
+	plan := planDeletionIn(t, ctx, server, "acme/api")
+
+	server.mcpServer.HandleMessage(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{`+
+		`"name":"delete_old_pipelines","_meta":{"progressToken":"cleanup-1"},`+
+		`"arguments":{"plan_id":"`+plan.PlanID+`","confirm":true}}}`))
+
+	if len(session.notifications) != 4 {
+		t.Fatalf("expected initial and per-pipeline progress notifications, got %d", len(session.notifications))
+	}
+
+	var last mcp.JSONRPCNotification
+	for len(session.notifications) > 0 {
+		last = <-session.notifications
+		if last.Method != "notifications/progress" || last.Params.AdditionalFields["progressToken"] != "cleanup-1" {
+			t.Fatalf("unexpected notification: %#v", last)
+		}
+	}
+
+	fields := last.Params.AdditionalFields
+	if fields["progress"] != 3 || fields["total"] != 3 || fields["message"] != "Deleted 3/3 pipelines (0 failed)" {
+		t.Fatalf("unexpected final progress: %v", fields)
+	}
+}
+
+func TestHandleDeleteOldPipelinesWithoutProgressToken(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	created := time.Now().AddDate(-5, 0, 0)
+	fake.AddPipeline(project.ID, gitlabapi.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &created})
+
+	server := newGitLabTestServer(t, fake)
+	session := &notificationSession{notifications: make(chan mcp.JSONRPCNotification, 10)}
+	ctx := server.mcpServer.WithContext(context.Background(), session)
+	plan := planDeletionIn(t, ctx, server, "acme/api")
+
+	server.mcpServer.HandleMessage(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{`+
+		`"name":"delete_old_pipelines","arguments":{"plan_id":"`+plan.PlanID+`","confirm":true}}}`))
+
+	if len(session.notifications) != 0 {
+		t.Fatalf("expected no progress notifications without a token, got %d", len(session.notifications))
+	}
+	if remaining := fake.Pipelines(project.ID); len(remaining) != 0 {
+		t.Fatalf("expected pipeline to be deleted, %d remain", len(remaining))
+	}
+}
+
+type elicitingSession struct {
+	notificationSession
+	capabilities mcp.ClientCapabilities
+	response     mcp.ElicitationResponse
+	requests     []mcp.ElicitationRequest
+}
+
+func (s *elicitingSession) GetClientInfo() mcp.Implementation              { return mcp.Implementation{} }
+func (s *elicitingSession) SetClientInfo(mcp.Implementation)               {}
+func (s *elicitingSession) GetClientCapabilities() mcp.ClientCapabilities  { return s.capabilities }
+func (s *elicitingSession) SetClientCapabilities(c mcp.ClientCapabilities) { s.capabilities = c }
+func (s *elicitingSession) RequestElicitation(_ context.Context, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	s.requests = append(s.requests, request)
+	return &mcp.ElicitationResult{ElicitationResponse: s.response}, nil
+}
+
+func newElicitingSession(response mcp.ElicitationResponse) *elicitingSession {
+	session := &elicitingSession{response: response}
+	session.capabilities.Elicitation = &struct{}{}
+	return session
+}
+
+func callToolInSession(t *testing.T, server *Server, session serverpkg.ClientSession, handler func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), args map[string]any) *mcp.CallToolResult {
+	t.Helper()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = args
+
+	result, err := handler(server.mcpServer.WithContext(context.Background(), session), request)
+	if err != nil {
+		t.Fatalf("tool handler returned error: %v", err)
+	}
+
+	return result
+}
+
+func TestDestructiveToolsAskForElicitation(t *testing.T) {
+	server, projects, pipelines := newFakeBackendServer(t)
+
+	// The model setting confirm=true must not bypass a human who declines.
+	declined := newElicitingSession(mcp.ElicitationResponse{Action: mcp.ElicitationResponseActionDecline})
+	plan := planDeletionIn(t, server.mcpServer.WithContext(context.Background(), declined), server, "acme/api")
+	result := callToolInSession(t, server, declined, server.handleDeleteOldPipelines, map[string]any{"plan_id": plan.PlanID, "confirm": true})
+	output := result.StructuredContent.(DeleteOldPipelinesOutput)
+	if output.Performed || len(pipelines.deleted) != 0 {
+		t.Fatalf("expected declined deletion not to run, got %#v", output)
+	}
+	if len(declined.requests) != 1 || !strings.Contains(declined.requests[0].Params.Message, "Delete 1 pipelines") ||
+		!strings.Contains(declined.requests[0].Params.Message, "acme/api") {
+		t.Fatalf("expected elicitation describing the deletion, got %#v", declined.requests)
+	}
+
+	accepted := newElicitingSession(mcp.ElicitationResponse{
+		Action:  mcp.ElicitationResponseActionAccept,
+		Content: map[string]any{"confirm": true},
+	})
+	result = callToolInSession(t, server, accepted, server.handleDeleteOldPipelines, map[string]any{"plan_id": plan.PlanID})
+	output = result.StructuredContent.(DeleteOldPipelinesOutput)
+	if !output.Performed || output.ConfirmedVia != ConfirmedViaElicitation || len(pipelines.deleted) != 1 {
+		t.Fatalf("expected accepted deletion to run, got %#v", output)
+	}
+
+	result = callToolInSession(t, server, accepted, server.handleArchiveProject, map[string]any{"project_id_or_path": "acme/api"})
+	archived := result.StructuredContent.(ArchiveProjectOutput)
+	if !archived.Success || !projects.projects["acme/api"].Archived || archived.ConfirmedVia != ConfirmedViaElicitation {
+		t.Fatalf("expected accepted archive to run, got %#v", archived)
+	}
+}
+
+func TestRequireElicitationRefusesConfirmArgument(t *testing.T) {
+	server, projects, _ := newFakeBackendServer(t)
+	WithRequireElicitation(true)(server)
+
+	output := callTool(t, server.handleArchiveProject, map[string]any{"project_id_or_path": "acme/api", "confirm": true})
+	if !strings.Contains(output, "requires confirmation through MCP elicitation") || projects.projects["acme/api"].Archived {
+		t.Fatalf("expected archive to be refused without elicitation, got %q", output)
+	}
+}
+
+func TestToolsDeclareAnnotations(t *testing.T) {
+	server, _, _ := newFakeBackendServer(t)
+
+	for name, tool := range server.mcpServer.ListTools() {
+		annotations := tool.Tool.Annotations
+		if annotations.Title == "" || annotations.ReadOnlyHint == nil || annotations.DestructiveHint == nil ||
+			annotations.IdempotentHint == nil || annotations.OpenWorldHint == nil {
+			t.Errorf("tool %s does not declare every annotation: %#v", name, annotations)
+		}
+	}
+
+	tools := map[string]ToolInfo{}
+	for _, tool := range server.AvailableTools() {
+		tools[tool.Name] = tool
+	}
+
+	for _, name := range []string{"list_old_pipelines", "list_old_group_pipelines"} {
+		if list := tools[name]; !list.ReadOnly || list.Destructive || list.Idempotent {
+			t.Errorf("expected %s to be read-only and, issuing a new plan each call, not idempotent, got %#v", name, list)
+		}
+	}
+	if del := tools["delete_old_pipelines"]; del.ReadOnly || !del.Destructive || del.Idempotent {
+		t.Errorf("expected delete_old_pipelines to be destructive and not idempotent, got %#v", del)
+	}
+	if archive := tools["archive_project"]; archive.ReadOnly || !archive.Destructive {
+		t.Errorf("expected archive_project to be destructive, got %#v", archive)
+	}
+}
+
+func registeredToolNames(server *Server) []string {
+	var names []string
+	for _, tool := range server.AvailableTools() {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+func TestToolFilterSelectsTools(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter ToolFilter
+		want   []string
+	}{
+		{
+			name:   "read-only",
+			filter: ToolFilter{ReadOnly: true},
+			want: []string{"health_check", "whoami", "list_all_group_projects", "list_direct_group_projects", "list_subgroups",
+				"get_project_status", "list_old_pipelines", "list_old_group_pipelines"},
+		},
+		{
+			name:   "toolsets",
+			filter: ToolFilter{Toolsets: []string{ToolsetPipelines}, DisableTools: []string{"delete_old_pipelines"}},
+			want:   []string{"health_check", "whoami", "list_old_pipelines", "list_old_group_pipelines", "delete_old_group_pipelines"},
+		},
+		{
+			name:   "enable tools",
+			filter: ToolFilter{EnableTools: []string{"list_subgroups", "archive_project"}},
+			want:   []string{"health_check", "whoami", "list_subgroups", "archive_project"},
+		},
+		{
+			name:   "read-only overrides enable",
+			filter: ToolFilter{ReadOnly: true, Toolsets: []string{ToolsetAdmin}, EnableTools: []string{"archive_project"}},
+			want:   []string{"health_check", "whoami"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(); err != nil {
+				t.Fatalf("Validate returned error: %v", err)
+			}
+
+			server := NewServer(gitlab.NewService(gitlab.Backend{}, slog.New(slog.DiscardHandler)), slog.New(slog.DiscardHandler),
+				WithToolFilter(tt.filter))
+
+			got := registeredToolNames(server)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("expected tools %v, got %v", tt.want, got)
+			}
+			if len(server.mcpServer.ListTools()) != len(tt.want) {
+				t.Fatalf("expected MCP server to expose %d tools, got %d", len(tt.want), len(server.mcpServer.ListTools()))
+			}
+		})
+	}
+}
+
+func TestToolsetsCoverEveryTool(t *testing.T) {
+	server := NewServer(gitlab.NewService(gitlab.Backend{}, slog.New(slog.DiscardHandler)), slog.New(slog.DiscardHandler))
+
+	for _, name := range registeredToolNames(server) {
+		if err := (ToolFilter{EnableTools: []string{name}}).Validate(); err != nil {
+			t.Errorf("tool %s is not known to the tool filter: %v", name, err)
+		}
+	}
+
+	if err := (ToolFilter{Toolsets: []string{"billing"}}).Validate(); err == nil {
+		t.Error("expected unknown toolset to be rejected")
+	}
+	if err := (ToolFilter{DisableTools: []string{"drop_database"}}).Validate(); err == nil {
+		t.Error("expected unknown tool to be rejected")
+	}
+}
+
+func TestMutatingToolsAreAudited(t *testing.T) {
+	fake := gitlabtest.New()
+	fake.AddProject("acme", "api")
+	fake.SetCurrentUser(gitlabapi.User{ID: 9, Username: "ops-bot"})
+
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	client, err := fake.NewClient(gitlabapi.WithoutRetries())
+	if err != nil {
+		t.Fatalf("create gitlabtest client: %v", err)
+	}
+	server := NewServer(gitlab.NewService(gitlab.BackendFromClient(client), slog.New(slog.DiscardHandler)),
+		slog.New(slog.DiscardHandler), WithAuditLog(auditLog))
+
+	session := &notificationSession{notifications: make(chan mcp.JSONRPCNotification, 10)}
+	ctx := server.mcpServer.WithContext(context.Background(), session)
+
+	call := func(name string, args string) {
+		server.mcpServer.HandleMessage(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"`+
+			name+`","arguments":`+args+`}}`))
+	}
+
+	call("archive_project", `{"project_id_or_path":"acme/api"}`)
+	call("archive_project", `{"project_id_or_path":"acme/api","confirm":true}`)
+	call("get_project_status", `{"project_id_or_path":"acme/api"}`)
+	call("delete_old_pipelines", `{"plan_id":"plan_unknown","confirm":true}`)
+
+	records, _, err := auditLog.Query(audit.Query{})
+	if err != nil {
+		t.Fatalf("query audit log: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected only the three mutating calls to be audited, got %#v", records)
+	}
+
+	archived := records[1]
+	if archived.Tool != "archive_project" || archived.Outcome != audit.OutcomeSuccess || archived.GitLabUser != "ops-bot" ||
+		archived.SessionID != "test-session" || archived.Project != "acme/api" || len(archived.AffectedIDs) != 1 ||
+		archived.Arguments["confirm"] != true {
+		t.Fatalf("unexpected archive record: %#v", archived)
+	}
+	if records[0].Outcome != audit.OutcomeNotPerformed {
+		t.Fatalf("expected unconfirmed archive to be recorded as not performed, got %#v", records[0])
+	}
+	if records[2].Outcome != audit.OutcomeError || !strings.Contains(records[2].Error, "plan_unknown") {
+		t.Fatalf("expected failed deletion to be recorded with its error, got %#v", records[2])
+	}
+
+	output := callTool(t, server.handleQueryAuditLog, map[string]any{"tool": "archive_project", "outcome": "success"})
+	if !strings.Contains(output, "Found 1 audit records") || !strings.Contains(output, `"gitlab_user": "ops-bot"`) {
+		t.Fatalf("expected query_audit_log to find the archive, got %q", output)
+	}
+	userLookups := 0
+	for _, request := range fake.Requests() {
+		if request.Method == http.MethodGet && request.Path == "/user" {
+			userLookups++
+		}
+	}
+	if userLookups != 1 {
+		t.Fatalf("expected preflight and the audit records to share one user lookup, got %d", userLookups)
+	}
+}
+
+func TestFailedPlanDeletionsAreAttributed(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	fake.SetAccessLevel("acme/api", gitlabapi.MaintainerPermissions)
+	created := time.Now().AddDate(-2, 0, 0)
+	pipeline := fake.AddPipeline(project.ID, gitlabapi.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &created})
+
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	server := newGitLabTestServer(t, fake, WithAuditLog(auditLog))
+	session := &notificationSession{notifications: make(chan mcp.JSONRPCNotification, 10)}
+	ctx := server.mcpServer.WithContext(context.Background(), session)
+
+	plan, err := server.plans.Create(planOwner(ctx), "acme/api", gitlab.PipelineFilter{CreatedBefore: time.Now()}, gitlab.RetentionPolicy{}, []int{pipeline.ID})
+	if err != nil {
+		t.Fatalf("create plan: %v", err)
+	}
+
+	call := func(args string) {
+		server.mcpServer.HandleMessage(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"delete_old_pipelines","arguments":`+args+`}}`))
+	}
+	call(`{"plan_id":"` + plan.ID + `","checksum":"sha256:tampered","confirm":true}`)
+	call(`{"plan_id":"` + plan.ID + `","confirm":true}`)
+
+	records, _, err := auditLog.Query(audit.Query{})
+	if err != nil {
+		t.Fatalf("query audit log: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected both attempts to be audited, got %#v", records)
+	}
+	for _, record := range records {
+		if record.Outcome != audit.OutcomeError || record.Project != "acme/api" || !slices.Equal(record.PlannedIDs, []int{pipeline.ID}) ||
+			len(record.AffectedIDs) != 0 {
+			t.Fatalf("expected the failed deletion to be attributed to its plan, got %#v", record)
+		}
+	}
+	if !strings.Contains(records[0].Error, "checksum mismatch") || !strings.Contains(records[1].Error, "needs the Owner role") {
+		t.Fatalf("expected the checksum and preflight failures, got %q and %q", records[0].Error, records[1].Error)
+	}
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Toolset names accepted by ToolFilter.Toolsets.
+const (
+	ToolsetGroups    = "groups"
+	ToolsetProjects  = "projects"
+	ToolsetPipelines = "pipelines"
+	ToolsetAdmin     = "admin"
+)
+
+// toolsets maps each toolset to the tools it contains. Tools that belong to no toolset, such as
+// health_check and whoami, are always exposed unless disabled by name.
+var toolsets = map[string][]string{
+	ToolsetGroups:    {"list_all_group_projects", "list_direct_group_projects", "list_subgroups"},
+	ToolsetProjects:  {"get_project_status"},
+	ToolsetPipelines: {"list_old_pipelines", "delete_old_pipelines", "list_old_group_pipelines", "delete_old_group_pipelines"},
+	ToolsetAdmin:     {"archive_project", "query_audit_log"},
+}
+
+// coreTools are registered regardless of the selected toolsets.
+var coreTools = []string{"health_check", "whoami"}
+
+// ToolFilter selects which tools a Server registers. The zero value registers every tool.
+type ToolFilter struct {
+	// ReadOnly skips every tool that is not annotated as read-only. It overrides EnableTools.
+	ReadOnly bool
+	// Toolsets, when non-empty, limits the server to the tools in these toolsets plus EnableTools.
+	Toolsets []string
+	// EnableTools names tools to expose. When set without Toolsets, only these tools are exposed.
+	EnableTools []string
+	// DisableTools names tools that are never exposed.
+	DisableTools []string
+}
+
+// Toolsets returns the names of the available toolsets in sorted order.
+func Toolsets() []string {
+	names := make([]string, 0, len(toolsets))
+	for name := range toolsets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Validate reports unknown toolset or tool names.
+func (f ToolFilter) Validate() error {
+	for _, name := range f.Toolsets {
+		if _, ok := toolsets[name]; !ok {
+			return fmt.Errorf("unknown toolset %q (want one of %s)", name, strings.Join(Toolsets(), ", "))
+		}
+	}
+
+	known := slices.Clone(coreTools)
+	for _, tools := range toolsets {
+		known = append(known, tools...)
+	}
+
+	for _, name := range slices.Concat(f.EnableTools, f.DisableTools) {
+		if !slices.Contains(known, name) {
+			return fmt.Errorf("unknown tool %q", name)
+		}
+	}
+
+	return nil
+}
+
+// allows reports whether tool passes the filter.
+func (f ToolFilter) allows(tool mcp.Tool) bool {
+	if slices.Contains(f.DisableTools, tool.Name) {
+		return false
+	}
+
+	if f.ReadOnly && !hint(tool.Annotations.ReadOnlyHint, false) {
+		return false
+	}
+
+	if len(f.Toolsets) == 0 && len(f.EnableTools) == 0 {
+		return true
+	}
+
+	if slices.Contains(coreTools, tool.Name) || slices.Contains(f.EnableTools, tool.Name) {
+		return true
+	}
+
+	for _, name := range f.Toolsets {
+		if slices.Contains(toolsets[name], tool.Name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,184 @@
+// Package audit keeps an append-only JSONL record of tool calls that change GitLab.
+//
+// Each line is one Record. The file is only ever appended to, so it can be shipped or rotated
+// by external tooling; Query reads it back for the query_audit_log tool.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Outcomes recorded for audited calls.
+const (
+	// OutcomeSuccess means the operation ran and every part of it succeeded.
+	OutcomeSuccess = "success"
+	// OutcomePartial means the operation ran but some items, such as individual pipelines, failed.
+	OutcomePartial = "partial"
+	// OutcomeNotPerformed means the call was declined or not confirmed, so nothing changed.
+	OutcomeNotPerformed = "not_performed"
+	// OutcomeError means the call failed before or while changing GitLab.
+	OutcomeError = "error"
+)
+
+// maxRecordSize bounds the length of a single line read back by Query.
+const maxRecordSize = 4 << 20
+
+// Record is one audited tool call.
+type Record struct {
+	Time        time.Time      `json:"time"`
+	SessionID   string         `json:"session_id,omitempty"`
+	Client      string         `json:"client,omitempty"`
+	Tool        string         `json:"tool"`
+	Arguments   map[string]any `json:"arguments,omitempty"`
+	GitLabUser  string         `json:"gitlab_user,omitempty"`
+	Project     string         `json:"project,omitempty"`
+	AffectedIDs []int          `json:"affected_ids,omitempty"`
+	// PlannedIDs lists the pipelines a plan-based deletion was asked to delete, whatever came of it.
+	PlannedIDs []int  `json:"planned_ids,omitempty"`
+	Outcome    string `json:"outcome"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Log appends records to a JSONL file. It is safe for concurrent use.
+type Log struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens, creating if needed, the audit log at path for appending.
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+
+	return &Log{path: path, file: file}, nil
+}
+
+// Path returns the file the log writes to.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Write appends record as a single line and flushes it to disk. A zero Time is set to now.
+func (l *Log) Write(record Record) error {
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	record.Time = record.Time.UTC()
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Write(line); err != nil {
+		return fmt.Errorf("write audit record: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("sync audit log: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the underlying file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
+
+// Query selects records from the log. Empty fields match every record.
+type Query struct {
+	Tool      string
+	Project   string
+	Outcome   string
+	SessionID string
+	// AffectedID matches records that list this ID among their affected IDs.
+	AffectedID int
+	Since      time.Time
+	Until      time.Time
+	// Limit caps the number of records returned, keeping the most recent; zero or less means no limit.
+	Limit int
+}
+
+func (q Query) matches(record Record) bool {
+	switch {
+	case q.Tool != "" && record.Tool != q.Tool:
+		return false
+	case q.Project != "" && record.Project != q.Project:
+		return false
+	case q.Outcome != "" && record.Outcome != q.Outcome:
+		return false
+	case q.SessionID != "" && record.SessionID != q.SessionID:
+		return false
+	case q.AffectedID != 0 && !slices.Contains(record.AffectedIDs, q.AffectedID):
+		return false
+	case !q.Since.IsZero() && record.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && record.Time.After(q.Until):
+		return false
+	default:
+		return true
+	}
+}
+
+// Query returns the records matching q in the order they were written, and whether older
+// matches were dropped because of q.Limit. Lines that cannot be decoded are skipped.
+func (l *Log) Query(q Query) ([]Record, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, false, fmt.Errorf("open audit log: %w", err)
+	}
+	defer file.Close()
+
+	return readRecords(file, q)
+}
+
+func readRecords(r io.Reader, q Query) ([]Record, bool, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+
+	var (
+		records   []Record
+		truncated bool
+	)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if !q.matches(record) {
+			continue
+		}
+
+		records = append(records, record)
+		if q.Limit > 0 && len(records) > q.Limit {
+			records = records[1:]
+			truncated = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, fmt.Errorf("read audit log: %w", err)
+	}
+
+	return records, truncated, nil
+}
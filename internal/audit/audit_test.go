@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogWriteAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer log.Close()
+
+	base := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Time: base, Tool: "archive_project", Project: "acme/api", AffectedIDs: []int{7}, Outcome: OutcomeSuccess},
+		{Time: base.Add(time.Hour), Tool: "delete_old_pipelines", Project: "acme/api", AffectedIDs: []int{1, 2}, Outcome: OutcomePartial},
+		{Time: base.Add(2 * time.Hour), Tool: "delete_old_pipelines", Project: "acme/web", Outcome: OutcomeNotPerformed},
+		{Time: base.Add(3 * time.Hour), Tool: "delete_old_pipelines", Project: "acme/api", AffectedIDs: []int{3}, Outcome: OutcomeSuccess},
+	}
+	for _, record := range records {
+		if err := log.Write(record); err != nil {
+			t.Fatalf("Write returned error: %v", err)
+		}
+	}
+
+	got, truncated, err := log.Query(Query{Tool: "delete_old_pipelines", Project: "acme/api"})
+	if err != nil {
+		t.Fatalf("Query returned error: %v", err)
+	}
+	if truncated || len(got) != 2 || got[0].Outcome != OutcomePartial || got[1].AffectedIDs[0] != 3 {
+		t.Fatalf("unexpected records: %#v", got)
+	}
+
+	got, _, err = log.Query(Query{AffectedID: 2})
+	if err != nil || len(got) != 1 || got[0].Tool != "delete_old_pipelines" {
+		t.Fatalf("expected one record affecting pipeline 2, got %#v (%v)", got, err)
+	}
+
+	got, _, err = log.Query(Query{Since: base.Add(90 * time.Minute), Until: base.Add(150 * time.Minute)})
+	if err != nil || len(got) != 1 || got[0].Project != "acme/web" {
+		t.Fatalf("expected one record in the time window, got %#v (%v)", got, err)
+	}
+
+	got, truncated, err = log.Query(Query{Limit: 2})
+	if err != nil || !truncated || len(got) != 2 || !got[1].Time.Equal(base.Add(3*time.Hour)) {
+		t.Fatalf("expected the two most recent records, got %#v (truncated %t, %v)", got, truncated, err)
+	}
+}
+
+func TestLogAppendsAndSkipsCorruptLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte("{\"tool\":\"archive_project\",\"outcome\":\"success\"}\nnot json\n"), 0o600); err != nil {
+		t.Fatalf("seed audit log: %v", err)
+	}
+
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	if err := log.Write(Record{Tool: "delete_old_pipelines", Outcome: OutcomeError, Error: "boom"}); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Fatalf("expected the existing lines to be kept and one appended, got %q", data)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer reopened.Close()
+
+	got, _, err := reopened.Query(Query{})
+	if err != nil || len(got) != 2 || got[1].Time.IsZero() {
+		t.Fatalf("expected two decodable records with timestamps, got %#v (%v)", got, err)
+	}
+}
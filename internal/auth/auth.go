@@ -0,0 +1,112 @@
+// Package auth authenticates inbound HTTP requests to the MCP server.
+//
+// Clients present one of a fixed set of bearer tokens in the Authorization header. Tokens are
+// kept only as SHA-256 digests and compared in constant time, so neither the comparison nor its
+// timing reveals how much of a guess was right.
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// MinTokenLength is the shortest bearer token NewBearer accepts.
+const MinTokenLength = 16
+
+// realm is advertised in the WWW-Authenticate header of rejected requests.
+const realm = "gitlab-mcp-server"
+
+// Bearer checks requests against a set of static bearer tokens. It is safe for concurrent use.
+type Bearer struct {
+	digests [][sha256.Size]byte
+}
+
+// NewBearer returns a Bearer accepting any of tokens. Surrounding whitespace is ignored; at least
+// one token is required and each must be at least MinTokenLength characters long.
+func NewBearer(tokens []string) (*Bearer, error) {
+	b := &Bearer{}
+	for _, token := range tokens {
+		token = strings.TrimSpace(token)
+		if len(token) < MinTokenLength {
+			return nil, fmt.Errorf("bearer tokens must be at least %d characters long", MinTokenLength)
+		}
+		b.digests = append(b.digests, sha256.Sum256([]byte(token)))
+	}
+
+	if len(b.digests) == 0 {
+		return nil, errors.New("no bearer tokens configured")
+	}
+
+	return b, nil
+}
+
+// LoadTokenFile reads bearer tokens from path, one per line. Blank lines and lines starting
+// with # are skipped.
+func LoadTokenFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open token file: %w", err)
+	}
+	defer file.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read token file: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// Authenticate reports whether r carries one of the configured tokens as
+// "Authorization: Bearer <token>". Every configured token is compared, whether or not an
+// earlier one matched.
+func (b *Bearer) Authenticate(r *http.Request) bool {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+
+	presented := sha256.Sum256([]byte(strings.TrimSpace(token)))
+
+	match := 0
+	for _, digest := range b.digests {
+		match |= subtle.ConstantTimeCompare(presented[:], digest[:])
+	}
+
+	return match == 1
+}
+
+// Require wraps next so that requests without a valid token are rejected with 401 Unauthorized
+// before they reach it.
+func (b *Bearer) Require(next http.Handler, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !b.Authenticate(r) {
+			logger.WarnContext(r.Context(), "rejected unauthenticated HTTP request",
+				"remote_addr", r.RemoteAddr, "method", r.Method, "path", r.URL.Path)
+
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", realm))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
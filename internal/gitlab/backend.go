@@ -0,0 +1,109 @@
+package gitlab
+
+import (
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// GroupsAPI is the subset of the GitLab groups API used by Service.
+type GroupsAPI interface {
+	GetGroup(gid any, opt *gitlab.GetGroupOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Group, *gitlab.Response, error)
+	ListGroupProjects(gid any, opt *gitlab.ListGroupProjectsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error)
+	ListDescendantGroups(gid any, opt *gitlab.ListDescendantGroupsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Group, *gitlab.Response, error)
+	ListSubGroups(gid any, opt *gitlab.ListSubGroupsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Group, *gitlab.Response, error)
+}
+
+// ProjectsAPI is the subset of the GitLab projects API used by Service.
+type ProjectsAPI interface {
+	GetProject(pid any, opt *gitlab.GetProjectOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Project, *gitlab.Response, error)
+	ArchiveProject(pid any, options ...gitlab.RequestOptionFunc) (*gitlab.Project, *gitlab.Response, error)
+}
+
+// PipelinesAPI is the subset of the GitLab pipelines API used by Service.
+type PipelinesAPI interface {
+	ListProjectPipelines(pid any, opt *gitlab.ListProjectPipelinesOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.PipelineInfo, *gitlab.Response, error)
+	DeletePipeline(pid any, pipeline int, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error)
+}
+
+// BranchesAPI is the subset of the GitLab branches API used by Service.
+type BranchesAPI interface {
+	GetBranch(pid any, branch string, options ...gitlab.RequestOptionFunc) (*gitlab.Branch, *gitlab.Response, error)
+}
+
+// TagsAPI is the subset of the GitLab tags API used by Service.
+type TagsAPI interface {
+	GetTag(pid any, tag string, options ...gitlab.RequestOptionFunc) (*gitlab.Tag, *gitlab.Response, error)
+}
+
+// MergeRequestsAPI is the subset of the GitLab merge requests API used by Service.
+type MergeRequestsAPI interface {
+	GetMergeRequest(pid any, mergeRequest int, opt *gitlab.GetMergeRequestsOptions, options ...gitlab.RequestOptionFunc) (*gitlab.MergeRequest, *gitlab.Response, error)
+}
+
+// DeploymentsAPI is the subset of the GitLab deployments API used by Service.
+type DeploymentsAPI interface {
+	ListProjectDeployments(pid any, opts *gitlab.ListProjectDeploymentsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Deployment, *gitlab.Response, error)
+}
+
+// UsersAPI is the subset of the GitLab users API used by Service.
+type UsersAPI interface {
+	CurrentUser(options ...gitlab.RequestOptionFunc) (*gitlab.User, *gitlab.Response, error)
+}
+
+// VersionAPI is the subset of the GitLab version API used by Service.
+type VersionAPI interface {
+	GetVersion(options ...gitlab.RequestOptionFunc) (*gitlab.Version, *gitlab.Response, error)
+}
+
+// AccessTokensAPI is the subset of the GitLab personal access tokens API used by Service.
+type AccessTokensAPI interface {
+	GetSinglePersonalAccessToken(options ...gitlab.RequestOptionFunc) (*gitlab.PersonalAccessToken, *gitlab.Response, error)
+}
+
+// ProjectMembersAPI is the subset of the GitLab project members API used by Service.
+type ProjectMembersAPI interface {
+	GetInheritedProjectMember(pid any, user int, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectMember, *gitlab.Response, error)
+}
+
+// GroupMembersAPI is the subset of the GitLab group members API used by Service.
+type GroupMembersAPI interface {
+	GetInheritedGroupMember(gid any, user int, options ...gitlab.RequestOptionFunc) (*gitlab.GroupMember, *gitlab.Response, error)
+}
+
+// Backend bundles the GitLab API surfaces a Service talks to. Each field can be
+// backed by the real client, an in-memory fake, or a wrapper such as a cache.
+type Backend struct {
+	Groups         GroupsAPI
+	Projects       ProjectsAPI
+	Pipelines      PipelinesAPI
+	Branches       BranchesAPI
+	Tags           TagsAPI
+	MergeRequests  MergeRequestsAPI
+	Deployments    DeploymentsAPI
+	Users          UsersAPI
+	Version        VersionAPI
+	AccessTokens   AccessTokensAPI
+	ProjectMembers ProjectMembersAPI
+	GroupMembers   GroupMembersAPI
+}
+
+// BackendFromClient returns a Backend that forwards every call to the provided client.
+func BackendFromClient(client *gitlab.Client) Backend {
+	if client == nil {
+		return Backend{}
+	}
+
+	return Backend{
+		Groups:         client.Groups,
+		Projects:       client.Projects,
+		Pipelines:      client.Pipelines,
+		Branches:       client.Branches,
+		Tags:           client.Tags,
+		MergeRequests:  client.MergeRequests,
+		Deployments:    client.Deployments,
+		Users:          client.Users,
+		Version:        client.Version,
+		AccessTokens:   client.PersonalAccessTokens,
+		ProjectMembers: client.ProjectMembers,
+		GroupMembers:   client.GroupMembers,
+	}
+}
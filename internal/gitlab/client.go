@@ -1,14 +1,100 @@
 package gitlab
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"time"
 
 	gitlab "gitlab.com/gitlab-org/api/client-go"
 )
 
+// TransportConfig describes how to reach a GitLab instance over the network. The zero value
+// uses the system certificate pool, the proxy from the environment and no timeout.
+type TransportConfig struct {
+	// CAFile names a PEM bundle of certificate authorities trusted in addition to the system pool.
+	CAFile string
+	// CertFile and KeyFile name a PEM client certificate and key presented for mutual TLS.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables server certificate verification. Only use it in labs.
+	InsecureSkipVerify bool
+	// ProxyURL routes requests through this HTTP(S) proxy instead of the one configured by the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	ProxyURL string
+	// Timeout bounds each HTTP request, including reading the response body; zero means no limit.
+	Timeout time.Duration
+}
+
+// NewHTTPClient returns an HTTP client configured by cfg. Build it once and share it between the
+// GitLab clients created with WithHTTPClient.
+func NewHTTPClient(cfg TransportConfig) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if path := strings.TrimSpace(cfg.CAFile); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file %s contains no PEM certificates", path)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certFile, keyFile := strings.TrimSpace(cfg.CertFile), strings.TrimSpace(cfg.KeyFile)
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("client certificate and key must be configured together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	if proxy := strings.TrimSpace(cfg.ProxyURL); proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{Transport: transport, Timeout: cfg.Timeout}, nil
+}
+
+// ClientOption customises a client created by NewClient.
+type ClientOption func(*[]gitlab.ClientOptionFunc)
+
+// WithHTTPClient makes the GitLab client send its requests through httpClient, typically one
+// built by NewHTTPClient.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(opts *[]gitlab.ClientOptionFunc) {
+		if httpClient != nil {
+			*opts = append(*opts, gitlab.WithHTTPClient(httpClient))
+		}
+	}
+}
+
 // NewClient constructs a GitLab API client with the provided token and optional base URL.
-func NewClient(token string, baseURL string) (*gitlab.Client, error) {
+func NewClient(token string, baseURL string, options ...ClientOption) (*gitlab.Client, error) {
 	trimmedToken := strings.TrimSpace(token)
 	if trimmedToken == "" {
 		return nil, fmt.Errorf("gitlab token cannot be empty")
@@ -18,6 +104,9 @@ func NewClient(token string, baseURL string) (*gitlab.Client, error) {
 	if url := strings.TrimSpace(baseURL); url != "" {
 		opts = append(opts, gitlab.WithBaseURL(url))
 	}
+	for _, option := range options {
+		option(&opts)
+	}
 
 	client, err := gitlab.NewClient(trimmedToken, opts...)
 	if err != nil {
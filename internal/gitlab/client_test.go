@@ -0,0 +1,91 @@
+package gitlab
+
+import (
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClientTrustsCAFile(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("write CA file: %v", err)
+	}
+
+	untrusted, err := NewHTTPClient(TransportConfig{})
+	if err != nil {
+		t.Fatalf("NewHTTPClient returned error: %v", err)
+	}
+	if _, err := untrusted.Get(server.URL); err == nil {
+		t.Fatal("expected the test server's certificate to be rejected without the CA file")
+	}
+
+	trusted, err := NewHTTPClient(TransportConfig{CAFile: caFile, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewHTTPClient returned error: %v", err)
+	}
+	resp, err := trusted.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected the CA file to be trusted, got %v", err)
+	}
+	resp.Body.Close()
+
+	if trusted.Timeout != 5*time.Second {
+		t.Fatalf("expected the timeout to be applied, got %s", trusted.Timeout)
+	}
+}
+
+func TestNewHTTPClientUsesProxy(t *testing.T) {
+	client, err := NewHTTPClient(TransportConfig{ProxyURL: "http://proxy.internal:3128"})
+	if err != nil {
+		t.Fatalf("NewHTTPClient returned error: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://gitlab.example.com/api/v4/user", nil)
+	proxy, err := client.Transport.(*http.Transport).Proxy(req)
+	if err != nil || proxy == nil || proxy.Host != "proxy.internal:3128" {
+		t.Fatalf("expected requests to go through the proxy, got %v (%v)", proxy, err)
+	}
+}
+
+func TestNewHTTPClientRejectsInvalidConfig(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("write CA file: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  TransportConfig
+		want string
+	}{
+		{name: "missing CA file", cfg: TransportConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}, want: "read CA file"},
+		{name: "CA file without certificates", cfg: TransportConfig{CAFile: notPEM}, want: "no PEM certificates"},
+		{name: "key without certificate", cfg: TransportConfig{KeyFile: "client.key"}, want: "configured together"},
+		{name: "unreadable client certificate", cfg: TransportConfig{CertFile: notPEM, KeyFile: notPEM}, want: "load client certificate"},
+		{name: "proxy without scheme", cfg: TransportConfig{ProxyURL: "proxy.internal:3128"}, want: "invalid proxy URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewHTTPClient(tt.cfg); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// ErrorCategory is a machine-readable classification of a failed GitLab operation.
+type ErrorCategory string
+
+const (
+	// ErrorCategoryValidation marks invalid input, either rejected locally or by GitLab (400, 409, 422),
+	// including stale deletion plans.
+	ErrorCategoryValidation ErrorCategory = "validation"
+	// ErrorCategoryUnauthorized marks a missing, expired or revoked token (401).
+	ErrorCategoryUnauthorized ErrorCategory = "unauthorized"
+	// ErrorCategoryForbidden marks a token that lacks the permissions for the operation (403),
+	// whether GitLab refused the call or Preflight caught it first.
+	ErrorCategoryForbidden ErrorCategory = "forbidden"
+	// ErrorCategoryNotFound marks a group, project, pipeline or deletion plan that does not exist or is not visible (404).
+	ErrorCategoryNotFound ErrorCategory = "not_found"
+	// ErrorCategoryRateLimited marks requests rejected by GitLab's rate limiter (429).
+	ErrorCategoryRateLimited ErrorCategory = "rate_limited"
+	// ErrorCategoryUpstream5xx marks server-side GitLab failures (5xx).
+	ErrorCategoryUpstream5xx ErrorCategory = "upstream_5xx"
+	// ErrorCategoryCanceled marks operations interrupted by cancellation or a deadline.
+	ErrorCategoryCanceled ErrorCategory = "canceled"
+	// ErrorCategoryInternal marks any other failure, such as network errors.
+	ErrorCategoryInternal ErrorCategory = "internal"
+)
+
+// ClassifyError returns the category of err and, when err wraps a GitLab API error response,
+// the HTTP status code GitLab returned.
+func ClassifyError(err error) (ErrorCategory, int) {
+	var errResp *gitlab.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil {
+		status := errResp.Response.StatusCode
+		return categoryForStatus(status), status
+	}
+
+	// The client reports every 404 as this sentinel rather than an ErrorResponse.
+	if errors.Is(err, gitlab.ErrNotFound) {
+		return ErrorCategoryNotFound, http.StatusNotFound
+	}
+
+	switch {
+	case errors.Is(err, ErrPlanNotFound):
+		return ErrorCategoryNotFound, 0
+	case errors.Is(err, ErrPlanExpired), errors.Is(err, ErrPlanChecksumMismatch):
+		return ErrorCategoryValidation, 0
+	case errors.Is(err, ErrMissingScope), errors.Is(err, ErrInsufficientAccess):
+		return ErrorCategoryForbidden, 0
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrorCategoryCanceled, 0
+	}
+
+	return ErrorCategoryInternal, 0
+}
+
+func categoryForStatus(status int) ErrorCategory {
+	switch {
+	case status == http.StatusUnauthorized:
+		return ErrorCategoryUnauthorized
+	case status == http.StatusForbidden:
+		return ErrorCategoryForbidden
+	case status == http.StatusNotFound:
+		return ErrorCategoryNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrorCategoryRateLimited
+	case status >= 500:
+		return ErrorCategoryUpstream5xx
+	case status >= 400:
+		return ErrorCategoryValidation
+	default:
+		return ErrorCategoryInternal
+	}
+}
@@ -0,0 +1,48 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	gitlabclient "gitlab.com/gitlab-org/api/client-go"
+)
+
+func TestClassifyError(t *testing.T) {
+	apiError := func(status int) error {
+		return fmt.Errorf("get project: %w", &gitlabclient.ErrorResponse{
+			Response: &http.Response{StatusCode: status},
+		})
+	}
+
+	tests := []struct {
+		name       string
+		err        error
+		category   ErrorCategory
+		statusCode int
+	}{
+		{"bad request", apiError(http.StatusBadRequest), ErrorCategoryValidation, 400},
+		{"unprocessable", apiError(http.StatusUnprocessableEntity), ErrorCategoryValidation, 422},
+		{"unauthorized", apiError(http.StatusUnauthorized), ErrorCategoryUnauthorized, 401},
+		{"forbidden", apiError(http.StatusForbidden), ErrorCategoryForbidden, 403},
+		{"not found", apiError(http.StatusNotFound), ErrorCategoryNotFound, 404},
+		{"not found sentinel", fmt.Errorf("get group: %w", gitlabclient.ErrNotFound), ErrorCategoryNotFound, 404},
+		{"rate limited", apiError(http.StatusTooManyRequests), ErrorCategoryRateLimited, 429},
+		{"bad gateway", apiError(http.StatusBadGateway), ErrorCategoryUpstream5xx, 502},
+		{"unknown plan", fmt.Errorf("apply plan: %w", ErrPlanNotFound), ErrorCategoryNotFound, 0},
+		{"expired plan", fmt.Errorf("apply plan: %w", ErrPlanExpired), ErrorCategoryValidation, 0},
+		{"canceled", fmt.Errorf("list: %w", context.Canceled), ErrorCategoryCanceled, 0},
+		{"other", errors.New("connection refused"), ErrorCategoryInternal, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			category, status := ClassifyError(tt.err)
+			if category != tt.category || status != tt.statusCode {
+				t.Fatalf("expected (%s, %d), got (%s, %d)", tt.category, tt.statusCode, category, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package gitlabtest
+
+import (
+	"fmt"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// DemoGroup is the root group seeded by NewDemo.
+const DemoGroup = "demo-org"
+
+// NewDemo returns a Server seeded with a small organisation: nested subgroups, active and
+// archived projects, and pipelines and production deployments spanning several years so every
+// MCP tool has data to work with offline.
+func NewDemo() *Server {
+	s := New()
+
+	api := s.AddProject(DemoGroup, "api")
+	web := s.AddProject(DemoGroup+"/frontend", "web")
+	s.AddProject(DemoGroup+"/frontend", "design-system")
+	cli := s.AddProject(DemoGroup+"/platform/tooling", "cli")
+	legacy := s.AddProject(DemoGroup+"/platform", "legacy-deployer")
+
+	s.mu.Lock()
+	s.projects[legacy.ID].Archived = true
+	s.mu.Unlock()
+
+	now := time.Now().UTC()
+	statuses := []string{"success", "failed", "canceled", "success", "skipped"}
+	sources := []string{"push", "merge_request_event", "schedule", "push", "web"}
+	refs := []string{"main", "feature/login", "main", "release/1.0", "fix/typo"}
+
+	for p, project := range []*gitlab.Project{api, web, cli, legacy} {
+		// fix/typo was merged and deleted, so its pipelines are on a ref that no longer exists.
+		s.AddBranch(project.ID, "feature/login")
+		s.AddBranch(project.ID, "release/1.0")
+
+		for i := 0; i < 12; i++ {
+			created := now.AddDate(0, -6*i, -p)
+			pipeline := s.AddPipeline(project.ID, gitlab.PipelineInfo{
+				Status:    statuses[i%len(statuses)],
+				Source:    sources[i%len(sources)],
+				Ref:       refs[i%len(refs)],
+				SHA:       fmt.Sprintf("%040x", project.ID*1000+i),
+				CreatedAt: gitlab.Ptr(created),
+			})
+			if pipeline.Status == "success" && pipeline.Ref == "main" {
+				s.AddDeployment(project.ID, pipeline.ID, "production")
+			}
+
+			for _, stage := range []string{"build", "test"} {
+				s.AddJob(project.ID, pipeline.ID, gitlab.Job{
+					Name:      stage,
+					Stage:     stage,
+					Status:    pipeline.Status,
+					CreatedAt: gitlab.Ptr(created),
+				})
+			}
+		}
+	}
+
+	return s
+}
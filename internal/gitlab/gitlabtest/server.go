@@ -0,0 +1,967 @@
+// Package gitlabtest provides a stateful, in-memory GitLab REST API for tests and demos.
+//
+// The Server implements http.Handler and understands the subset of the GitLab v4 API
+// used by the MCP tools: groups, subgroups, group projects, projects (including
+// archiving), branches, tags, merge requests, pipelines, jobs, deployments, the current user, its personal
+// access token and memberships, and the instance version. Responses carry the same pagination
+// headers GitLab sends, and failures can be injected per endpoint or through a simulated
+// rate limit.
+package gitlabtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// BaseURL is the API base URL clients created by Server.NewClient use.
+const BaseURL = "http://gitlab.test/api/v4"
+
+const (
+	apiPrefix      = "/api/v4"
+	defaultPerPage = 20
+	maximumPerPage = 100
+	fakeWebURLRoot = "http://gitlab.test"
+)
+
+// Fault describes a failure the Server returns instead of handling a matching request.
+type Fault struct {
+	// Method restricts the fault to one HTTP method; empty matches any method.
+	Method string
+	// Path is matched as a prefix of the request path below /api/v4, e.g. "/groups/12/projects".
+	// Numeric IDs and URL-decoded paths are both accepted.
+	Path string
+	// Status is the HTTP status code returned.
+	Status int
+	// Message is returned as the GitLab error message; defaults to the status text.
+	Message string
+	// Times limits how many requests the fault applies to; zero means every matching request.
+	Times int
+	// RetryAfter, when positive, is sent as the Retry-After header in whole seconds.
+	RetryAfter time.Duration
+	// Applied makes the Server carry out the request before failing it, like a GitLab that
+	// deleted a pipeline and then timed out answering.
+	Applied bool
+}
+
+// Request records a request handled by the Server.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+}
+
+// Server is an in-memory GitLab instance. The zero value is not usable; create one with New.
+type Server struct {
+	mu sync.Mutex
+
+	nextID    int
+	groups    map[int]*gitlab.Group
+	projects  map[int]*gitlab.Project
+	pipelines map[int][]*gitlab.PipelineInfo
+	jobs      map[int][]*gitlab.Job
+	branches  map[int]map[string]bool
+	tags      map[int]map[string]bool
+	mrs       map[int][]*gitlab.MergeRequest
+	deploys   map[int][]*gitlab.Deployment
+	triggers  map[int]string
+	user      *gitlab.User
+	token     *gitlab.PersonalAccessToken
+	version   *gitlab.Version
+	access    map[string]gitlab.AccessLevelValue
+
+	faults   []*Fault
+	requests []Request
+
+	rateLimit     int
+	rateRemaining int
+	retryAfter    time.Duration
+}
+
+// New returns an empty Server.
+func New() *Server {
+	return &Server{
+		nextID:    1,
+		groups:    make(map[int]*gitlab.Group),
+		projects:  make(map[int]*gitlab.Project),
+		pipelines: make(map[int][]*gitlab.PipelineInfo),
+		jobs:      make(map[int][]*gitlab.Job),
+		branches:  make(map[int]map[string]bool),
+		tags:      make(map[int]map[string]bool),
+		mrs:       make(map[int][]*gitlab.MergeRequest),
+		deploys:   make(map[int][]*gitlab.Deployment),
+		triggers:  make(map[int]string),
+		user:      &gitlab.User{ID: 1, Username: "gitlabtest", Name: "GitLab Test", State: "active"},
+		token:     &gitlab.PersonalAccessToken{ID: 1, Name: "gitlabtest", UserID: 1, Scopes: []string{"api"}, Active: true},
+		version:   &gitlab.Version{Version: "17.0.0", Revision: "gitlabtest"},
+	}
+}
+
+// NewClient returns a GitLab client wired directly to the Server without opening a network
+// socket. Additional options, such as gitlab.WithoutRetries, are applied after the defaults.
+func (s *Server) NewClient(opts ...gitlab.ClientOptionFunc) (*gitlab.Client, error) {
+	return gitlab.NewClient(
+		"gitlabtest-token",
+		append([]gitlab.ClientOptionFunc{
+			gitlab.WithBaseURL(BaseURL),
+			gitlab.WithHTTPClient(s.HTTPClient()),
+		}, opts...)...,
+	)
+}
+
+// HTTPClient returns an HTTP client whose transport dispatches every request to the Server.
+func (s *Server) HTTPClient() *http.Client {
+	return &http.Client{Transport: transport{server: s}}
+}
+
+type transport struct {
+	server *Server
+}
+
+func (t transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	t.server.ServeHTTP(recorder, r)
+
+	resp := recorder.Result()
+	resp.Request = r
+
+	return resp, nil
+}
+
+// SetCurrentUser replaces the user returned for the access token by GET /user.
+func (s *Server) SetCurrentUser(user gitlab.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.user = &user
+}
+
+// SetAccessToken replaces the personal access token returned by GET /personal_access_tokens/self.
+func (s *Server) SetAccessToken(token gitlab.PersonalAccessToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token = &token
+}
+
+// SetAccessLevel gives the current user the role level on the group or project at fullPath.
+// Members inherit their role on a group in its subgroups and projects. Until SetAccessLevel is
+// first called the current user is an Owner of every group and project.
+func (s *Server) SetAccessLevel(fullPath string, level gitlab.AccessLevelValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.access == nil {
+		s.access = make(map[string]gitlab.AccessLevelValue)
+	}
+	s.access[strings.Trim(fullPath, "/")] = level
+}
+
+// SetVersion replaces the instance version returned by GET /version.
+func (s *Server) SetVersion(version, revision string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.version = &gitlab.Version{Version: version, Revision: revision}
+}
+
+// AddGroup creates the group identified by fullPath, creating any missing parent groups.
+// Adding an existing group returns it unchanged.
+func (s *Server) AddGroup(fullPath string) *gitlab.Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.ensureGroup(strings.Trim(fullPath, "/"))
+}
+
+// AddProject creates a project named name in the group at groupFullPath, creating the group if
+// needed. The project starts with its default branch, main.
+func (s *Server) AddProject(groupFullPath, name string) *gitlab.Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group := s.ensureGroup(strings.Trim(groupFullPath, "/"))
+	pathWithNamespace := group.FullPath + "/" + name
+
+	if existing := s.findProject(pathWithNamespace); existing != nil {
+		return existing
+	}
+
+	created := time.Now().UTC()
+	project := &gitlab.Project{
+		ID:                s.allocateID(),
+		Name:              name,
+		Path:              name,
+		PathWithNamespace: pathWithNamespace,
+		NameWithNamespace: strings.ReplaceAll(pathWithNamespace, "/", " / "),
+		WebURL:            fakeWebURLRoot + "/" + pathWithNamespace,
+		HTTPURLToRepo:     fakeWebURLRoot + "/" + pathWithNamespace + ".git",
+		SSHURLToRepo:      "git@gitlab.test:" + pathWithNamespace + ".git",
+		DefaultBranch:     "main",
+		Visibility:        gitlab.PrivateVisibility,
+		CreatedAt:         &created,
+		LastActivityAt:    &created,
+		Namespace: &gitlab.ProjectNamespace{
+			ID:       group.ID,
+			Name:     group.Name,
+			Path:     group.Path,
+			Kind:     "group",
+			FullPath: group.FullPath,
+			ParentID: group.ParentID,
+			WebURL:   group.WebURL,
+		},
+	}
+	s.projects[project.ID] = project
+	s.branches[project.ID] = map[string]bool{project.DefaultBranch: true}
+
+	return project
+}
+
+// AddBranch creates the branch name in the project with the given ID.
+func (s *Server) AddBranch(projectID int, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.branches[projectID] == nil {
+		s.branches[projectID] = make(map[string]bool)
+	}
+	s.branches[projectID][name] = true
+}
+
+// DeleteBranch removes the branch name from the project with the given ID.
+func (s *Server) DeleteBranch(projectID int, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.branches[projectID], name)
+}
+
+// AddTag creates the tag name in the project with the given ID.
+func (s *Server) AddTag(projectID int, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tags[projectID] == nil {
+		s.tags[projectID] = make(map[string]bool)
+	}
+	s.tags[projectID][name] = true
+}
+
+// AddMergeRequest stores mr for the project with the given ID. Missing IDs, the project IDs and
+// the state are filled in. Pipelines for the merge request use the ref refs/merge-requests/:iid/head.
+func (s *Server) AddMergeRequest(projectID int, mr gitlab.MergeRequest) *gitlab.MergeRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if mr.ID == 0 {
+		mr.ID = s.allocateID()
+	}
+	if mr.IID == 0 {
+		mr.IID = len(s.mrs[projectID]) + 1
+	}
+	mr.ProjectID = projectID
+	if mr.SourceProjectID == 0 {
+		mr.SourceProjectID = projectID
+	}
+	if mr.State == "" {
+		mr.State = "opened"
+	}
+
+	stored := mr
+	s.mrs[projectID] = append(s.mrs[projectID], &stored)
+
+	return &stored
+}
+
+// AddPipeline stores pipeline for the project with the given ID. Missing IDs, the project ID,
+// timestamps and web URL are filled in. The stored pipeline is returned.
+func (s *Server) AddPipeline(projectID int, pipeline gitlab.PipelineInfo) *gitlab.PipelineInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pipeline.ID == 0 {
+		pipeline.ID = s.allocateID()
+	}
+	if pipeline.IID == 0 {
+		pipeline.IID = len(s.pipelines[projectID]) + 1
+	}
+	pipeline.ProjectID = projectID
+	if pipeline.CreatedAt == nil {
+		pipeline.CreatedAt = gitlab.Ptr(time.Now().UTC())
+	}
+	if pipeline.UpdatedAt == nil {
+		pipeline.UpdatedAt = pipeline.CreatedAt
+	}
+	if pipeline.Status == "" {
+		pipeline.Status = "success"
+	}
+	if project := s.projects[projectID]; project != nil && pipeline.WebURL == "" {
+		pipeline.WebURL = fmt.Sprintf("%s/-/pipelines/%d", project.WebURL, pipeline.ID)
+	}
+
+	stored := pipeline
+	s.pipelines[projectID] = append(s.pipelines[projectID], &stored)
+
+	return &stored
+}
+
+// AddJob stores job as part of the given pipeline. Missing IDs and pipeline metadata are filled in.
+func (s *Server) AddJob(projectID, pipelineID int, job gitlab.Job) *gitlab.Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job.ID == 0 {
+		job.ID = s.allocateID()
+	}
+	job.Pipeline.ID = pipelineID
+	job.Pipeline.ProjectID = projectID
+	for _, pipeline := range s.pipelines[projectID] {
+		if pipeline.ID == pipelineID {
+			job.Pipeline.Ref = pipeline.Ref
+			job.Pipeline.Sha = pipeline.SHA
+			job.Pipeline.Status = pipeline.Status
+			if job.Ref == "" {
+				job.Ref = pipeline.Ref
+			}
+		}
+	}
+	if job.Status == "" {
+		job.Status = "success"
+	}
+
+	stored := job
+	s.jobs[pipelineID] = append(s.jobs[pipelineID], &stored)
+
+	return &stored
+}
+
+// AddDeployment records a successful deployment to environment by the pipeline with the given ID
+// and returns it.
+func (s *Server) AddDeployment(projectID, pipelineID int, environment string) *gitlab.Deployment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deployment := &gitlab.Deployment{
+		ID:          s.allocateID(),
+		IID:         len(s.deploys[projectID]) + 1,
+		Status:      "success",
+		Environment: &gitlab.Environment{Name: environment},
+	}
+	for _, pipeline := range s.pipelines[projectID] {
+		if pipeline.ID == pipelineID {
+			deployment.Ref = pipeline.Ref
+			deployment.SHA = pipeline.SHA
+			deployment.CreatedAt = pipeline.CreatedAt
+			deployment.Deployable.Pipeline.Ref = pipeline.Ref
+			deployment.Deployable.Pipeline.Status = pipeline.Status
+		}
+	}
+	deployment.Deployable.Pipeline.ID = pipelineID
+
+	s.deploys[projectID] = append(s.deploys[projectID], deployment)
+
+	return deployment
+}
+
+// SetPipelineUser records username as the user who triggered the pipeline with the given ID.
+// Pipelines without one are attributed to the current user.
+func (s *Server) SetPipelineUser(pipelineID int, username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.triggers[pipelineID] = username
+}
+
+// Project returns a copy of the project with the given ID, or nil if it does not exist.
+func (s *Server) Project(id int) *gitlab.Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	project, ok := s.projects[id]
+	if !ok {
+		return nil
+	}
+
+	clone := *project
+	return &clone
+}
+
+// Pipelines returns copies of the pipelines currently stored for the project.
+func (s *Server) Pipelines(projectID int) []gitlab.PipelineInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]gitlab.PipelineInfo, 0, len(s.pipelines[projectID]))
+	for _, pipeline := range s.pipelines[projectID] {
+		result = append(result, *pipeline)
+	}
+
+	return result
+}
+
+// InjectFault makes matching requests fail with the fault's status code.
+func (s *Server) InjectFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := fault
+	s.faults = append(s.faults, &stored)
+}
+
+// SetRateLimit limits the Server to limit requests before it answers with 429 Too Many
+// Requests and a Retry-After header of retryAfter. Responses include GitLab's RateLimit-*
+// headers while a limit is configured. A limit of zero removes the rate limit.
+func (s *Server) SetRateLimit(limit int, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rateLimit = limit
+	s.rateRemaining = limit
+	s.retryAfter = retryAfter
+}
+
+// ResetRateLimit restores the full request budget configured by SetRateLimit.
+func (s *Server) ResetRateLimit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rateRemaining = s.rateLimit
+}
+
+// Requests returns the requests handled so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// ServeHTTP implements http.Handler for the supported GitLab endpoints.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	segments, ok := splitPath(r.URL)
+	if !ok {
+		writeError(w, http.StatusNotFound, "404 Not Found")
+		return
+	}
+	apiPath := "/" + strings.Join(segments, "/")
+
+	s.requests = append(s.requests, Request{Method: r.Method, Path: apiPath, Query: r.URL.Query()})
+
+	if s.rateLimit > 0 {
+		if s.rateRemaining <= 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(s.retryAfter.Seconds())))
+			s.writeRateLimitHeaders(w)
+			writeError(w, http.StatusTooManyRequests, "429 Too Many Requests")
+			return
+		}
+		s.rateRemaining--
+		s.writeRateLimitHeaders(w)
+	}
+
+	if fault := s.matchFault(r.Method, s.canonicalPath(apiPath)); fault != nil {
+		message := fault.Message
+		if message == "" {
+			message = fmt.Sprintf("%d %s", fault.Status, http.StatusText(fault.Status))
+		}
+		if fault.Applied {
+			s.route(httptest.NewRecorder(), r, segments)
+		}
+		if fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(fault.RetryAfter.Seconds())))
+		}
+		writeError(w, fault.Status, message)
+		return
+	}
+
+	s.route(w, r, segments)
+}
+
+// route answers the request addressed by the path segments below /api/v4.
+func (s *Server) route(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch {
+	case len(segments) == 1 && segments[0] == "user" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.user)
+	case len(segments) == 1 && segments[0] == "version" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.version)
+	case len(segments) == 2 && segments[0] == "personal_access_tokens" && segments[1] == "self" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.token)
+	case len(segments) >= 2 && segments[0] == "groups":
+		s.serveGroups(w, r, segments[1:])
+	case len(segments) >= 2 && segments[0] == "projects":
+		s.serveProjects(w, r, segments[1:])
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+func (s *Server) serveGroups(w http.ResponseWriter, r *http.Request, segments []string) {
+	group := s.findGroup(segments[0])
+	if group == nil {
+		writeError(w, http.StatusNotFound, "404 Group Not Found")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "405 Method Not Allowed")
+		return
+	}
+
+	switch {
+	case len(segments) == 1:
+		writeJSON(w, http.StatusOK, group)
+	case len(segments) == 2 && segments[1] == "projects":
+		archived := r.URL.Query().Get("archived")
+		var projects []*gitlab.Project
+		for _, id := range sortedKeys(s.projects) {
+			project := s.projects[id]
+			if project.Namespace == nil || project.Namespace.ID != group.ID {
+				continue
+			}
+			if archived != "" && strconv.FormatBool(project.Archived) != archived {
+				continue
+			}
+			projects = append(projects, project)
+		}
+		writePage(w, r, projects)
+	case len(segments) == 2 && segments[1] == "subgroups":
+		var subgroups []*gitlab.Group
+		for _, id := range sortedKeys(s.groups) {
+			if s.groups[id].ParentID == group.ID {
+				subgroups = append(subgroups, s.groups[id])
+			}
+		}
+		writePage(w, r, subgroups)
+	case len(segments) == 2 && segments[1] == "descendant_groups":
+		var descendants []*gitlab.Group
+		for _, id := range sortedKeys(s.groups) {
+			candidate := s.groups[id]
+			if strings.HasPrefix(candidate.FullPath, group.FullPath+"/") {
+				descendants = append(descendants, candidate)
+			}
+		}
+		writePage(w, r, descendants)
+	case len(segments) == 4 && segments[1] == "members" && segments[2] == "all":
+		s.serveMember(w, group.FullPath, segments[3])
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+func (s *Server) serveProjects(w http.ResponseWriter, r *http.Request, segments []string) {
+	project := s.findProject(segments[0])
+	if project == nil {
+		writeError(w, http.StatusNotFound, "404 Project Not Found")
+		return
+	}
+
+	switch {
+	case len(segments) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, project)
+	case len(segments) == 2 && segments[1] == "archive" && r.Method == http.MethodPost:
+		project.Archived = true
+		writeJSON(w, http.StatusCreated, project)
+	case len(segments) == 2 && segments[1] == "unarchive" && r.Method == http.MethodPost:
+		project.Archived = false
+		writeJSON(w, http.StatusCreated, project)
+	case len(segments) == 2 && segments[1] == "pipelines" && r.Method == http.MethodGet:
+		pipelines, err := s.filterPipelines(s.pipelines[project.ID], r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writePage(w, r, pipelines)
+	case len(segments) == 2 && segments[1] == "jobs" && r.Method == http.MethodGet:
+		var jobs []*gitlab.Job
+		for _, pipeline := range s.pipelines[project.ID] {
+			jobs = append(jobs, s.jobs[pipeline.ID]...)
+		}
+		writePage(w, r, jobs)
+	case len(segments) >= 3 && segments[1] == "pipelines":
+		s.servePipeline(w, r, project, segments[2:])
+	case len(segments) == 2 && segments[1] == "deployments" && r.Method == http.MethodGet:
+		writePage(w, r, s.deploys[project.ID])
+	case len(segments) == 4 && segments[1] == "repository" && segments[2] == "branches" && r.Method == http.MethodGet:
+		if !s.branches[project.ID][segments[3]] {
+			writeError(w, http.StatusNotFound, "404 Branch Not Found")
+			return
+		}
+		writeJSON(w, http.StatusOK, gitlab.Branch{Name: segments[3], Default: segments[3] == project.DefaultBranch})
+	case len(segments) == 4 && segments[1] == "repository" && segments[2] == "tags" && r.Method == http.MethodGet:
+		if !s.tags[project.ID][segments[3]] {
+			writeError(w, http.StatusNotFound, "404 Tag Not Found")
+			return
+		}
+		writeJSON(w, http.StatusOK, gitlab.Tag{Name: segments[3]})
+	case len(segments) == 3 && segments[1] == "merge_requests" && r.Method == http.MethodGet:
+		for _, mr := range s.mrs[project.ID] {
+			if strconv.Itoa(mr.IID) == segments[2] {
+				writeJSON(w, http.StatusOK, mr)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "404 Not found")
+	case len(segments) == 4 && segments[1] == "members" && segments[2] == "all" && r.Method == http.MethodGet:
+		s.serveMember(w, project.PathWithNamespace, segments[3])
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+// serveMember answers GET .../members/all/:user_id with the current user's direct or inherited
+// membership of the group or project at fullPath.
+func (s *Server) serveMember(w http.ResponseWriter, fullPath, userID string) {
+	level := s.accessLevel(fullPath)
+	if userID != strconv.Itoa(s.user.ID) || level == gitlab.NoPermissions {
+		writeError(w, http.StatusNotFound, "404 Not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, gitlab.ProjectMember{
+		ID:          s.user.ID,
+		Username:    s.user.Username,
+		Name:        s.user.Name,
+		State:       s.user.State,
+		AccessLevel: level,
+	})
+}
+
+// accessLevel returns the highest role the current user holds on fullPath or any of its
+// parent groups.
+func (s *Server) accessLevel(fullPath string) gitlab.AccessLevelValue {
+	if s.access == nil {
+		return gitlab.OwnerPermissions
+	}
+
+	level := gitlab.NoPermissions
+	segments := strings.Split(fullPath, "/")
+	for i := range segments {
+		level = max(level, s.access[strings.Join(segments[:i+1], "/")])
+	}
+
+	return level
+}
+
+func (s *Server) servePipeline(w http.ResponseWriter, r *http.Request, project *gitlab.Project, segments []string) {
+	id, err := strconv.Atoi(segments[0])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "400 Bad Request")
+		return
+	}
+
+	index := -1
+	for i, pipeline := range s.pipelines[project.ID] {
+		if pipeline.ID == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		writeError(w, http.StatusNotFound, "404 Pipeline Not Found")
+		return
+	}
+	pipeline := s.pipelines[project.ID][index]
+
+	switch {
+	case len(segments) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, pipeline)
+	case len(segments) == 1 && r.Method == http.MethodDelete:
+		s.pipelines[project.ID] = append(s.pipelines[project.ID][:index:index], s.pipelines[project.ID][index+1:]...)
+		delete(s.jobs, id)
+		w.WriteHeader(http.StatusNoContent)
+	case len(segments) == 2 && segments[1] == "jobs" && r.Method == http.MethodGet:
+		writePage(w, r, s.jobs[id])
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+func (s *Server) filterPipelines(pipelines []*gitlab.PipelineInfo, query url.Values) ([]*gitlab.PipelineInfo, error) {
+	createdBefore, err := parseTimeParam(query, "created_before")
+	if err != nil {
+		return nil, err
+	}
+	createdAfter, err := parseTimeParam(query, "created_after")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*gitlab.PipelineInfo
+	for _, pipeline := range pipelines {
+		created := time.Time{}
+		if pipeline.CreatedAt != nil {
+			created = *pipeline.CreatedAt
+		}
+		if createdBefore != nil && !created.Before(*createdBefore) {
+			continue
+		}
+		if createdAfter != nil && !created.After(*createdAfter) {
+			continue
+		}
+		if status := query.Get("status"); status != "" && pipeline.Status != status {
+			continue
+		}
+		if ref := query.Get("ref"); ref != "" && pipeline.Ref != ref {
+			continue
+		}
+		if source := query.Get("source"); source != "" && pipeline.Source != source {
+			continue
+		}
+		if username := query.Get("username"); username != "" && s.pipelineUser(pipeline.ID) != username {
+			continue
+		}
+		result = append(result, pipeline)
+	}
+
+	orderBy := query.Get("order_by")
+	descending := query.Get("sort") != "asc"
+	less := func(i, j int) bool {
+		switch orderBy {
+		case "created_at":
+			return timeValue(result[i].CreatedAt).Before(timeValue(result[j].CreatedAt))
+		case "updated_at":
+			return timeValue(result[i].UpdatedAt).Before(timeValue(result[j].UpdatedAt))
+		default:
+			return result[i].ID < result[j].ID
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if descending {
+			return less(j, i)
+		}
+		return less(i, j)
+	})
+
+	return result, nil
+}
+
+func (s *Server) pipelineUser(pipelineID int) string {
+	if username, ok := s.triggers[pipelineID]; ok {
+		return username
+	}
+	return s.user.Username
+}
+
+func (s *Server) ensureGroup(fullPath string) *gitlab.Group {
+	if group := s.findGroup(fullPath); group != nil {
+		return group
+	}
+
+	parentID := 0
+	path := fullPath
+	if idx := strings.LastIndex(fullPath, "/"); idx >= 0 {
+		parentID = s.ensureGroup(fullPath[:idx]).ID
+		path = fullPath[idx+1:]
+	}
+
+	group := &gitlab.Group{
+		ID:         s.allocateID(),
+		Name:       path,
+		Path:       path,
+		FullPath:   fullPath,
+		FullName:   strings.ReplaceAll(fullPath, "/", " / "),
+		ParentID:   parentID,
+		WebURL:     fakeWebURLRoot + "/groups/" + fullPath,
+		Visibility: gitlab.PrivateVisibility,
+	}
+	s.groups[group.ID] = group
+
+	return group
+}
+
+func (s *Server) findGroup(idOrPath string) *gitlab.Group {
+	if id, err := strconv.Atoi(idOrPath); err == nil {
+		return s.groups[id]
+	}
+
+	for _, group := range s.groups {
+		if group.FullPath == idOrPath {
+			return group
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) findProject(idOrPath string) *gitlab.Project {
+	if id, err := strconv.Atoi(idOrPath); err == nil {
+		return s.projects[id]
+	}
+
+	for _, project := range s.projects {
+		if project.PathWithNamespace == idOrPath {
+			return project
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) matchFault(method, apiPath string) *Fault {
+	for i, fault := range s.faults {
+		if fault.Method != "" && fault.Method != method {
+			continue
+		}
+		if !strings.HasPrefix(apiPath, s.canonicalPath(fault.Path)) {
+			continue
+		}
+
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+
+		return fault
+	}
+
+	return nil
+}
+
+// canonicalPath rewrites the group or project addressed by path to its numeric ID, so faults
+// declared with either form match requests made with either form.
+func (s *Server) canonicalPath(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) < 2 {
+		return "/" + strings.Join(segments, "/")
+	}
+
+	// Longest matching prefix wins, so "groups/acme/tools/projects" resolves to acme/tools.
+	for end := len(segments); end > 1; end-- {
+		candidate := strings.Join(segments[1:end], "/")
+		switch segments[0] {
+		case "groups":
+			if group := s.findGroup(candidate); group != nil {
+				return "/" + strings.Join(append([]string{"groups", strconv.Itoa(group.ID)}, segments[end:]...), "/")
+			}
+		case "projects":
+			if project := s.findProject(candidate); project != nil {
+				return "/" + strings.Join(append([]string{"projects", strconv.Itoa(project.ID)}, segments[end:]...), "/")
+			}
+		}
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
+
+func (s *Server) writeRateLimitHeaders(w http.ResponseWriter) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(s.rateLimit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(max(s.rateRemaining, 0)))
+	w.Header().Set("RateLimit-Reset", strconv.FormatInt(time.Now().Add(s.retryAfter).Unix(), 10))
+}
+
+func (s *Server) allocateID() int {
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+// splitPath returns the decoded path segments below /api/v4. A URL-encoded group or project
+// path stays a single segment.
+func splitPath(u *url.URL) ([]string, bool) {
+	escaped := strings.TrimPrefix(u.EscapedPath(), apiPrefix)
+	if escaped == u.EscapedPath() {
+		return nil, false
+	}
+
+	var segments []string
+	for _, raw := range strings.Split(strings.Trim(escaped, "/"), "/") {
+		decoded, err := url.PathUnescape(raw)
+		if err != nil {
+			return nil, false
+		}
+		segments = append(segments, decoded)
+	}
+
+	return segments, len(segments) > 0
+}
+
+func writePage[T any](w http.ResponseWriter, r *http.Request, items []T) {
+	query := r.URL.Query()
+
+	perPage, err := strconv.Atoi(query.Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = defaultPerPage
+	}
+	perPage = min(perPage, maximumPerPage)
+
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+
+	totalPages := max((len(items)+perPage-1)/perPage, 1)
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+
+	header := w.Header()
+	header.Set("X-Page", strconv.Itoa(page))
+	header.Set("X-Per-Page", strconv.Itoa(perPage))
+	header.Set("X-Total", strconv.Itoa(len(items)))
+	header.Set("X-Total-Pages", strconv.Itoa(totalPages))
+	if page > 1 {
+		header.Set("X-Prev-Page", strconv.Itoa(page-1))
+	}
+	if page < totalPages {
+		header.Set("X-Next-Page", strconv.Itoa(page+1))
+	}
+
+	pageItems := items[start:end]
+	if pageItems == nil {
+		pageItems = []T{}
+	}
+
+	writeJSON(w, http.StatusOK, pageItems)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
+
+func parseTimeParam(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("400 Bad Request: %s is invalid", name)
+	}
+
+	return &parsed, nil
+}
+
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
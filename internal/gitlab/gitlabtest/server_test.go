@@ -0,0 +1,187 @@
+package gitlabtest
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+func newTestClient(t *testing.T, s *Server) *gitlab.Client {
+	t.Helper()
+
+	client, err := s.NewClient(gitlab.WithoutRetries())
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+
+	return client
+}
+
+func TestGroupsAndPagination(t *testing.T) {
+	s := New()
+	for i := 0; i < 5; i++ {
+		s.AddProject("acme/tools", string(rune('a'+i)))
+	}
+	s.AddGroup("acme/tools/nested")
+
+	client := newTestClient(t, s)
+
+	group, _, err := client.Groups.GetGroup("acme/tools", nil)
+	if err != nil {
+		t.Fatalf("GetGroup: %v", err)
+	}
+	if group.FullPath != "acme/tools" || group.ParentID == 0 {
+		t.Fatalf("unexpected group: %#v", group)
+	}
+
+	projects, resp, err := client.Groups.ListGroupProjects(group.ID, &gitlab.ListGroupProjectsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 2, Page: 1},
+	})
+	if err != nil {
+		t.Fatalf("ListGroupProjects: %v", err)
+	}
+	if len(projects) != 2 || resp.NextPage != 2 || resp.TotalItems != 5 || resp.TotalPages != 3 {
+		t.Fatalf("unexpected first page: %d projects, next %d, total %d/%d", len(projects), resp.NextPage, resp.TotalItems, resp.TotalPages)
+	}
+
+	projects, resp, err = client.Groups.ListGroupProjects(group.ID, &gitlab.ListGroupProjectsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 2, Page: 3},
+	})
+	if err != nil {
+		t.Fatalf("ListGroupProjects last page: %v", err)
+	}
+	if len(projects) != 1 || resp.NextPage != 0 {
+		t.Fatalf("unexpected last page: %d projects, next %d", len(projects), resp.NextPage)
+	}
+
+	descendants, _, err := client.Groups.ListDescendantGroups("acme", nil)
+	if err != nil {
+		t.Fatalf("ListDescendantGroups: %v", err)
+	}
+	if len(descendants) != 2 {
+		t.Fatalf("expected 2 descendant groups, got %d", len(descendants))
+	}
+
+	subgroups, _, err := client.Groups.ListSubGroups("acme", nil)
+	if err != nil {
+		t.Fatalf("ListSubGroups: %v", err)
+	}
+	if len(subgroups) != 1 || subgroups[0].FullPath != "acme/tools" {
+		t.Fatalf("unexpected subgroups: %#v", subgroups)
+	}
+}
+
+func TestArchiveAndPipelines(t *testing.T) {
+	s := New()
+	project := s.AddProject("acme", "api")
+	old := time.Now().AddDate(-2, 0, 0)
+	oldPipeline := s.AddPipeline(project.ID, gitlab.PipelineInfo{Ref: "main", CreatedAt: &old})
+	s.AddPipeline(project.ID, gitlab.PipelineInfo{Ref: "main"})
+	s.AddJob(project.ID, oldPipeline.ID, gitlab.Job{Name: "build"})
+
+	client := newTestClient(t, s)
+
+	archived, _, err := client.Projects.ArchiveProject("acme/api")
+	if err != nil {
+		t.Fatalf("ArchiveProject: %v", err)
+	}
+	if !archived.Archived || !s.Project(project.ID).Archived {
+		t.Fatal("expected project to be archived")
+	}
+
+	pipelines, _, err := client.Pipelines.ListProjectPipelines(project.ID, &gitlab.ListProjectPipelinesOptions{
+		CreatedBefore: gitlab.Ptr(time.Now().AddDate(-1, 0, 0)),
+	})
+	if err != nil {
+		t.Fatalf("ListProjectPipelines: %v", err)
+	}
+	if len(pipelines) != 1 || pipelines[0].ID != oldPipeline.ID {
+		t.Fatalf("expected only the old pipeline, got %#v", pipelines)
+	}
+
+	jobs, _, err := client.Jobs.ListPipelineJobs(project.ID, oldPipeline.ID, nil)
+	if err != nil {
+		t.Fatalf("ListPipelineJobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].Name != "build" {
+		t.Fatalf("unexpected jobs: %#v", jobs)
+	}
+
+	if _, err := client.Pipelines.DeletePipeline(project.ID, oldPipeline.ID); err != nil {
+		t.Fatalf("DeletePipeline: %v", err)
+	}
+	if remaining := s.Pipelines(project.ID); len(remaining) != 1 {
+		t.Fatalf("expected one remaining pipeline, got %d", len(remaining))
+	}
+}
+
+func TestPipelineOrderKeepsTiesStable(t *testing.T) {
+	s := New()
+	project := s.AddProject("acme", "api")
+	older := time.Now().AddDate(-1, 0, 0)
+	newer := time.Now().Add(-time.Hour)
+	first := s.AddPipeline(project.ID, gitlab.PipelineInfo{Ref: "main", CreatedAt: &older})
+	second := s.AddPipeline(project.ID, gitlab.PipelineInfo{Ref: "main", CreatedAt: &older})
+	latest := s.AddPipeline(project.ID, gitlab.PipelineInfo{Ref: "main", CreatedAt: &newer})
+
+	client := newTestClient(t, s)
+
+	pipelines, _, err := client.Pipelines.ListProjectPipelines(project.ID, &gitlab.ListProjectPipelinesOptions{
+		OrderBy: gitlab.Ptr("created_at"),
+		Sort:    gitlab.Ptr("desc"),
+	})
+	if err != nil {
+		t.Fatalf("ListProjectPipelines: %v", err)
+	}
+
+	want := []int{latest.ID, first.ID, second.ID}
+	if len(pipelines) != len(want) {
+		t.Fatalf("expected %d pipelines, got %d", len(want), len(pipelines))
+	}
+	for i, pipeline := range pipelines {
+		if pipeline.ID != want[i] {
+			t.Fatalf("expected pipelines in order %v, got pipeline %d at position %d", want, pipeline.ID, i)
+		}
+	}
+}
+
+func TestInjectedFaultsAndRateLimit(t *testing.T) {
+	s := New()
+	s.AddProject("acme/tools", "cli")
+	s.InjectFault(Fault{Method: http.MethodGet, Path: "/groups/acme/tools/projects", Status: http.StatusForbidden, Times: 1})
+
+	client := newTestClient(t, s)
+
+	_, resp, err := client.Groups.ListGroupProjects("acme/tools", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected injected 403, got resp %v err %v", resp, err)
+	}
+
+	if _, _, err := client.Groups.ListGroupProjects("acme/tools", nil); err != nil {
+		t.Fatalf("expected fault to apply once, got %v", err)
+	}
+
+	s.SetRateLimit(1, 30*time.Second)
+
+	_, resp, err = client.Groups.GetGroup("acme", nil)
+	if err != nil {
+		t.Fatalf("expected first request within the limit to succeed, got %v", err)
+	}
+	if resp.Header.Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("expected RateLimit-Remaining 0, got %q", resp.Header.Get("RateLimit-Remaining"))
+	}
+
+	_, resp, err = client.Groups.GetGroup("acme", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got resp %v err %v", resp, err)
+	}
+	if resp.Header.Get("Retry-After") != "30" {
+		t.Fatalf("expected Retry-After 30, got %q", resp.Header.Get("Retry-After"))
+	}
+
+	if got := len(s.Requests()); got != 4 {
+		t.Fatalf("expected 4 recorded requests, got %d", got)
+	}
+}
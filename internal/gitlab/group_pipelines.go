@@ -0,0 +1,198 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// GroupPipelineCleanupOptions controls how PlanGroupPipelineCleanup selects pipelines across the
+// projects of a group.
+type GroupPipelineCleanupOptions struct {
+	Filter    PipelineFilter
+	Retention RetentionPolicy
+	// SkipArchived leaves archived projects out of the cleanup.
+	SkipArchived bool
+	// MaxProjects caps the number of projects planned; zero or less means no limit.
+	MaxProjects int
+	// MaxPipelinesPerProject caps the pipelines listed in each project; zero or less means no limit.
+	MaxPipelinesPerProject int
+	// Progress, when set, is called each time a project has been planned.
+	Progress ProgressFunc
+}
+
+// ProjectPipelineCleanup is the cleanup planned for one project of a group.
+type ProjectPipelineCleanup struct {
+	Project Project
+	// Cleanup is nil when Err is set.
+	Cleanup *PipelineCleanup
+	Err     error
+}
+
+// GroupPipelineCleanup is the cleanup planned for the projects of a group and its subgroups.
+type GroupPipelineCleanup struct {
+	// Projects lists every project in the order ListGroupProjectsAll returned them.
+	Projects        []ProjectPipelineCleanup
+	FailedSubgroups []SubgroupFailure
+	// Truncated reports that the project listing stopped at MaxProjects.
+	Truncated bool
+}
+
+// PlanGroupPipelineCleanup runs PlanPipelineCleanup in every project of the group and its
+// subgroups, working on at most the configured project concurrency at a time. Projects that
+// cannot be planned are reported in their result rather than failing the whole call.
+func (s *Service) PlanGroupPipelineCleanup(ctx context.Context, groupIDOrPath string, opts GroupPipelineCleanupOptions) (*GroupPipelineCleanup, error) {
+	listing, err := s.ListGroupProjectsAll(ctx, groupIDOrPath, GroupProjectsOptions{
+		ExcludeArchived: opts.SkipArchived,
+		MaxResults:      opts.MaxProjects,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GroupPipelineCleanup{
+		Projects:        make([]ProjectPipelineCleanup, len(listing.Projects)),
+		FailedSubgroups: listing.FailedSubgroups,
+		Truncated:       listing.Truncated,
+	}
+
+	var (
+		progressMu sync.Mutex
+		progress   = Progress{Total: len(listing.Projects)}
+	)
+
+	s.forEachProject(ctx, len(listing.Projects), func(i int) {
+		project := listing.Projects[i]
+
+		cleanup, err := s.PlanPipelineCleanup(ctx, project.PathWithNamespace, opts.Filter, opts.Retention, opts.MaxPipelinesPerProject)
+		if err != nil {
+			s.log.WarnContext(ctx, "failed to plan pipeline cleanup", "project", project.PathWithNamespace, "error", err)
+		}
+		result.Projects[i] = ProjectPipelineCleanup{Project: project, Cleanup: cleanup, Err: err}
+
+		if opts.Progress == nil {
+			return
+		}
+
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		progress.Completed++
+		if err != nil {
+			progress.Failed++
+		}
+		opts.Progress(progress)
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("plan project pipeline cleanups: %w", err)
+	}
+
+	return result, nil
+}
+
+// ProjectPipelineDeletion is the outcome of deleting the planned pipelines of one project.
+type ProjectPipelineDeletion struct {
+	Project string
+	// Summary is nil when Err is set, for example because Preflight rejected the deletion.
+	Summary *PipelineDeletionSummary
+	Err     error
+}
+
+// DeleteGroupPipelines runs DeletePipelines with filter and policy for every project listed,
+// working on at most the configured project concurrency at a time, and returns the outcomes in
+// the order of projects. permits is nil, or holds the permit from PreflightProjects for each
+// project. A project whose pipelines cannot be deleted does not stop the others. When progress is
+// non-nil it is called with the deletion attempts counted across all projects; the total shrinks
+// as projects skip pipelines the plan no longer selects.
+func (s *Service) DeleteGroupPipelines(ctx context.Context, filter PipelineFilter, policy RetentionPolicy, projects []ProjectPipelineIDs, permits []*Permit, progress ProgressFunc) []ProjectPipelineDeletion {
+	results := make([]ProjectPipelineDeletion, len(projects))
+
+	var (
+		progressMu sync.Mutex
+		perProject = make([]Progress, len(projects))
+	)
+	for i, project := range projects {
+		perProject[i].Total = len(project.PipelineIDs)
+	}
+	overall := func() Progress {
+		var sum Progress
+		for _, p := range perProject {
+			sum.Completed += p.Completed
+			sum.Failed += p.Failed
+			sum.Total += p.Total
+		}
+		return sum
+	}
+	report := func(i int, p Progress) {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+
+		perProject[i] = p
+		progress(overall())
+	}
+
+	if progress != nil {
+		progress(overall())
+	}
+
+	s.forEachProject(ctx, len(projects), func(i int) {
+		project := projects[i]
+
+		var projectProgress ProgressFunc
+		if progress != nil {
+			projectProgress = func(p Progress) { report(i, p) }
+		}
+
+		var permit *Permit
+		if permits != nil {
+			permit = permits[i]
+		}
+
+		summary, err := s.DeletePipelines(ctx, project.Project, filter, policy, project.PipelineIDs, permit, projectProgress)
+		if err != nil {
+			s.log.WarnContext(ctx, "failed to delete project pipelines", "project", project.Project, "error", err)
+			if progress != nil {
+				count := len(project.PipelineIDs)
+				report(i, Progress{Completed: count, Failed: count, Total: count})
+			}
+		}
+		results[i] = ProjectPipelineDeletion{Project: project.Project, Summary: summary, Err: err}
+	})
+
+	// Projects never started because ctx was cancelled are reported as failed.
+	for i, result := range results {
+		if result.Summary == nil && result.Err == nil {
+			results[i] = ProjectPipelineDeletion{Project: projects[i].Project, Err: fmt.Errorf("not attempted: %w", context.Cause(ctx))}
+		}
+	}
+
+	return results
+}
+
+// forEachProject calls fn with the indexes 0 to n-1 from at most the configured project
+// concurrency of goroutines at a time. It stops handing out indexes once ctx is done and
+// returns when every started call has returned.
+func (s *Service) forEachProject(ctx context.Context, n int, fn func(i int)) {
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(s.projectConcurrency, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+dispatch:
+	for i := range n {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,138 @@
+package gitlab
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	gitlabclient "gitlab.com/gitlab-org/api/client-go"
+
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab/gitlabtest"
+)
+
+func TestPlanGroupPipelineCleanup(t *testing.T) {
+	fake := gitlabtest.New()
+	api := fake.AddProject("acme", "api")
+	web := fake.AddProject("acme/frontend", "web")
+	archived := fake.AddProject("acme", "legacy")
+
+	old := time.Now().AddDate(-2, 0, 0)
+	add := func(projectID int, ref string) int {
+		return fake.AddPipeline(projectID, gitlabclient.PipelineInfo{Status: "success", Ref: ref, CreatedAt: &old}).ID
+	}
+	apiOld := add(api.ID, "main")
+	apiLatest := add(api.ID, "main")
+	webOnly := add(web.ID, "main")
+	add(archived.ID, "main")
+
+	service := newGitLabTestService(t, fake, WithProjectConcurrency(2))
+	if _, err := service.ArchiveProject(context.Background(), "acme/legacy", nil); err != nil {
+		t.Fatalf("ArchiveProject returned error: %v", err)
+	}
+
+	var progress []Progress
+	cleanup, err := service.PlanGroupPipelineCleanup(context.Background(), "acme", GroupPipelineCleanupOptions{
+		Filter:       PipelineFilter{CreatedBefore: time.Now().AddDate(-1, 0, 0)},
+		Retention:    RetentionPolicy{KeepLatestPerRef: 1},
+		SkipArchived: true,
+		Progress:     func(p Progress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatalf("PlanGroupPipelineCleanup returned error: %v", err)
+	}
+
+	var projects []string
+	for _, project := range cleanup.Projects {
+		if project.Err != nil {
+			t.Fatalf("expected %s to be planned, got %v", project.Project.PathWithNamespace, project.Err)
+		}
+		projects = append(projects, project.Project.PathWithNamespace)
+	}
+	if !slices.Equal(projects, []string{"acme/api", "acme/frontend/web"}) {
+		t.Fatalf("expected the active projects in listing order, got %v", projects)
+	}
+
+	apiCleanup := cleanup.Projects[0].Cleanup
+	if len(apiCleanup.Delete) != 1 || apiCleanup.Delete[0].ID != apiOld || apiCleanup.Kept[0].ID != apiLatest {
+		t.Fatalf("expected the retention policy to apply per project, got %#v", apiCleanup)
+	}
+	if webCleanup := cleanup.Projects[1].Cleanup; len(webCleanup.Delete) != 0 || webCleanup.Kept[0].ID != webOnly {
+		t.Fatalf("expected the only web pipeline to be kept, got %#v", webCleanup)
+	}
+
+	if len(progress) != 2 || progress[1] != (Progress{Completed: 2, Total: 2}) {
+		t.Fatalf("expected one progress update per project, got %v", progress)
+	}
+}
+
+func TestPlanGroupPipelineCleanupReportsFailedProjects(t *testing.T) {
+	fake := gitlabtest.New()
+	fake.AddProject("acme", "api")
+	fake.AddProject("acme", "web")
+	fake.InjectFault(gitlabtest.Fault{Path: "/projects/acme/web/pipelines", Status: 500, Message: "500 Internal Server Error"})
+
+	service := newGitLabTestService(t, fake)
+
+	cleanup, err := service.PlanGroupPipelineCleanup(context.Background(), "acme", GroupPipelineCleanupOptions{
+		Filter: PipelineFilter{CreatedBefore: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("PlanGroupPipelineCleanup returned error: %v", err)
+	}
+
+	if cleanup.Projects[0].Err != nil || cleanup.Projects[1].Err == nil || cleanup.Projects[1].Cleanup != nil {
+		t.Fatalf("expected only acme/web to fail, got %#v", cleanup.Projects)
+	}
+}
+
+func TestDeleteGroupPipelines(t *testing.T) {
+	fake := gitlabtest.New()
+	api := fake.AddProject("acme", "api")
+	web := fake.AddProject("acme", "web")
+	fake.SetAccessLevel("acme/api", gitlabclient.OwnerPermissions)
+	fake.SetAccessLevel("acme/web", gitlabclient.DeveloperPermissions)
+
+	created := time.Now().AddDate(-2, 0, 0)
+	var apiIDs []int
+	for range 3 {
+		apiIDs = append(apiIDs, fake.AddPipeline(api.ID, gitlabclient.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &created}).ID)
+	}
+	webID := fake.AddPipeline(web.ID, gitlabclient.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &created}).ID
+
+	service := newGitLabTestService(t, fake)
+
+	var (
+		mu       sync.Mutex
+		progress []Progress
+	)
+	filter := PipelineFilter{CreatedBefore: time.Now().AddDate(-1, 0, 0)}
+	results := service.DeleteGroupPipelines(context.Background(), filter, RetentionPolicy{}, []ProjectPipelineIDs{
+		{Project: "acme/api", PipelineIDs: apiIDs},
+		{Project: "acme/web", PipelineIDs: []int{webID}},
+	}, nil, func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress = append(progress, p)
+	})
+
+	if results[0].Err != nil || !slices.Equal(results[0].Summary.DeletedIDs, apiIDs) {
+		t.Fatalf("expected every acme/api pipeline to be deleted, got %#v", results[0])
+	}
+	if results[1].Err == nil || results[1].Summary != nil {
+		t.Fatalf("expected the preflight to reject acme/web, got %#v", results[1])
+	}
+	if len(fake.Pipelines(api.ID)) != 0 || len(fake.Pipelines(web.ID)) != 1 {
+		t.Fatal("expected only the acme/api pipelines to be gone")
+	}
+
+	for i := 1; i < len(progress); i++ {
+		if progress[i].Completed < progress[i-1].Completed {
+			t.Fatalf("expected progress never to go backwards, got %v", progress)
+		}
+	}
+	if last := progress[len(progress)-1]; last != (Progress{Completed: 4, Failed: 1, Total: 4}) {
+		t.Fatalf("expected the final progress to count every pipeline, got %v", last)
+	}
+}
@@ -0,0 +1,170 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// Thresholds beyond which CheckHealth reports GitLab as degraded.
+const (
+	// HealthLatencyThreshold is the slowest acceptable round trip to the version endpoint.
+	HealthLatencyThreshold = 2 * time.Second
+	// TokenExpiryWarning is how long before its expiry date a token is reported.
+	TokenExpiryWarning = 7 * 24 * time.Hour
+	// RateLimitHeadroom is the fraction of the rate limit that must remain available.
+	RateLimitHeadroom = 0.1
+)
+
+// HealthStatus summarises the result of CheckHealth.
+type HealthStatus string
+
+// Health statuses, from best to worst.
+const (
+	HealthHealthy   HealthStatus = "healthy"
+	HealthDegraded  HealthStatus = "degraded"
+	HealthUnhealthy HealthStatus = "unhealthy"
+)
+
+// RateLimitStatus is the request budget GitLab reported in its RateLimit-* response headers.
+type RateLimitStatus struct {
+	Limit     int        `json:"limit"`
+	Remaining int        `json:"remaining"`
+	ResetAt   *time.Time `json:"reset_at,omitempty"`
+}
+
+// HealthReport describes the connection to GitLab as seen through the configured access token.
+type HealthReport struct {
+	Status         HealthStatus     `json:"status"`
+	LatencyMS      int64            `json:"latency_ms"`
+	GitLabVersion  string           `json:"gitlab_version,omitempty"`
+	GitLabRevision string           `json:"gitlab_revision,omitempty"`
+	Username       string           `json:"username,omitempty"`
+	TokenName      string           `json:"token_name,omitempty"`
+	TokenScopes    []string         `json:"token_scopes,omitempty"`
+	TokenExpiresAt string           `json:"token_expires_at,omitempty"`
+	RateLimit      *RateLimitStatus `json:"rate_limit,omitempty"`
+	Problems       []string         `json:"problems,omitempty"`
+}
+
+// degrade records problem and lowers the status to degraded unless it is already unhealthy.
+func (r *HealthReport) degrade(problem string) {
+	r.Problems = append(r.Problems, problem)
+	if r.Status == HealthHealthy {
+		r.Status = HealthDegraded
+	}
+}
+
+// fail records problem and marks the report unhealthy.
+func (r *HealthReport) fail(problem string) {
+	r.Problems = append(r.Problems, problem)
+	r.Status = HealthUnhealthy
+}
+
+// CheckHealth calls the GitLab version, current user and token endpoints and reports whether the
+// server can do its job. GitLab being unreachable or rejecting the token is unhealthy; slow
+// responses, a token close to expiry or without API scope, and a nearly exhausted rate limit
+// are degraded. Token details are optional: tokens other than personal access tokens cannot
+// read them, which is not reported as a problem.
+func (s *Service) CheckHealth(ctx context.Context) HealthReport {
+	report := HealthReport{Status: HealthHealthy}
+
+	start := time.Now()
+	version, resp, err := s.api.Version.GetVersion(gitlab.WithContext(ctx))
+	latency := time.Since(start)
+	report.LatencyMS = latency.Milliseconds()
+	if err != nil {
+		report.fail(fmt.Sprintf("get version: %v", err))
+		return report
+	}
+	report.GitLabVersion = version.Version
+	report.GitLabRevision = version.Revision
+
+	if latency > HealthLatencyThreshold {
+		report.degrade(fmt.Sprintf("GitLab took %s to respond (threshold %s)", latency.Round(time.Millisecond), HealthLatencyThreshold))
+	}
+
+	user, userResp, err := s.api.Users.CurrentUser(gitlab.WithContext(ctx))
+	if err != nil {
+		report.fail(fmt.Sprintf("get current user: %v", err))
+		return report
+	}
+	report.Username = user.Username
+	if userResp != nil {
+		resp = userResp
+	}
+
+	token, tokenResp, err := s.api.AccessTokens.GetSinglePersonalAccessToken(gitlab.WithContext(ctx))
+	if err != nil {
+		s.log.DebugContext(ctx, "token details unavailable", "error", err)
+	} else {
+		checkToken(&report, token)
+		if tokenResp != nil {
+			resp = tokenResp
+		}
+	}
+
+	// resp is the most recent successful response, so its headers carry the latest budget.
+	if rateLimit := parseRateLimit(resp); rateLimit != nil {
+		report.RateLimit = rateLimit
+		if float64(rateLimit.Remaining) < float64(rateLimit.Limit)*RateLimitHeadroom {
+			report.degrade(fmt.Sprintf("only %d of %d requests left in the current rate limit window", rateLimit.Remaining, rateLimit.Limit))
+		}
+	}
+
+	return report
+}
+
+func checkToken(report *HealthReport, token *gitlab.PersonalAccessToken) {
+	report.TokenName = token.Name
+	report.TokenScopes = token.Scopes
+
+	if token.Revoked || !token.Active {
+		report.fail(fmt.Sprintf("access token %q is not active", token.Name))
+		return
+	}
+
+	if token.ExpiresAt != nil {
+		expiresAt := time.Time(*token.ExpiresAt)
+		report.TokenExpiresAt = expiresAt.Format("2006-01-02")
+		if time.Until(expiresAt) < TokenExpiryWarning {
+			report.degrade(fmt.Sprintf("access token %q expires on %s", token.Name, report.TokenExpiresAt))
+		}
+	}
+
+	switch {
+	case slices.Contains(token.Scopes, "api"):
+	case slices.Contains(token.Scopes, "read_api"):
+		report.degrade("access token has the read_api scope only; archiving and deleting will fail")
+	default:
+		report.degrade("access token has neither the api nor the read_api scope")
+	}
+}
+
+// parseRateLimit reads GitLab's RateLimit-* headers, returning nil when they are absent.
+func parseRateLimit(resp *gitlab.Response) *RateLimitStatus {
+	if resp == nil || resp.Response == nil {
+		return nil
+	}
+
+	limit, err := strconv.Atoi(resp.Header.Get("RateLimit-Limit"))
+	if err != nil || limit <= 0 {
+		return nil
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("RateLimit-Remaining"))
+	if err != nil {
+		return nil
+	}
+
+	status := &RateLimitStatus{Limit: limit, Remaining: remaining}
+	if reset, err := strconv.ParseInt(resp.Header.Get("RateLimit-Reset"), 10, 64); err == nil {
+		resetAt := time.Unix(reset, 0).UTC()
+		status.ResetAt = &resetAt
+	}
+
+	return status
+}
@@ -0,0 +1,96 @@
+package gitlab
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	gitlabclient "gitlab.com/gitlab-org/api/client-go"
+
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab/gitlabtest"
+)
+
+// unlimited stops the client from throttling itself to the fake's small rate limits.
+type unlimited struct{}
+
+func (unlimited) Wait(context.Context) error { return nil }
+
+func newGitLabTestService(t *testing.T, fake *gitlabtest.Server, opts ...ServiceOption) *Service {
+	t.Helper()
+
+	client, err := fake.NewClient(gitlabclient.WithoutRetries(), gitlabclient.WithCustomLimiter(unlimited{}))
+	if err != nil {
+		t.Fatalf("create gitlabtest client: %v", err)
+	}
+
+	return NewService(BackendFromClient(client), slog.New(slog.DiscardHandler), opts...)
+}
+
+func TestCheckHealthHealthy(t *testing.T) {
+	fake := gitlabtest.New()
+	fake.SetVersion("17.4.1", "abc123")
+	fake.SetRateLimit(100, time.Minute)
+
+	report := newGitLabTestService(t, fake).CheckHealth(context.Background())
+
+	if report.Status != HealthHealthy || len(report.Problems) != 0 {
+		t.Fatalf("expected a healthy report, got %#v", report)
+	}
+	if report.GitLabVersion != "17.4.1" || report.Username != "gitlabtest" || report.TokenScopes[0] != "api" {
+		t.Fatalf("unexpected report details: %#v", report)
+	}
+	if report.RateLimit == nil || report.RateLimit.Limit != 100 || report.RateLimit.Remaining != 97 {
+		t.Fatalf("expected rate limit headroom from the last response, got %#v", report.RateLimit)
+	}
+}
+
+func TestCheckHealthDegraded(t *testing.T) {
+	fake := gitlabtest.New()
+	expires := gitlabclient.ISOTime(time.Now().Add(48 * time.Hour))
+	fake.SetAccessToken(gitlabclient.PersonalAccessToken{Name: "ci", Scopes: []string{"read_api"}, Active: true, ExpiresAt: &expires})
+	fake.SetRateLimit(3, time.Minute)
+
+	report := newGitLabTestService(t, fake).CheckHealth(context.Background())
+
+	if report.Status != HealthDegraded {
+		t.Fatalf("expected a degraded report, got %#v", report)
+	}
+	problems := strings.Join(report.Problems, "\n")
+	for _, want := range []string{"expires on", "read_api scope only", "requests left"} {
+		if !strings.Contains(problems, want) {
+			t.Errorf("expected a problem mentioning %q, got %q", want, problems)
+		}
+	}
+}
+
+func TestCheckHealthUnhealthy(t *testing.T) {
+	fake := gitlabtest.New()
+	fake.InjectFault(gitlabtest.Fault{Path: "/user", Status: http.StatusUnauthorized})
+
+	report := newGitLabTestService(t, fake).CheckHealth(context.Background())
+
+	if report.Status != HealthUnhealthy || report.GitLabVersion == "" || report.Username != "" {
+		t.Fatalf("expected an unhealthy report after the version call, got %#v", report)
+	}
+
+	fake = gitlabtest.New()
+	fake.SetAccessToken(gitlabclient.PersonalAccessToken{Name: "old", Scopes: []string{"api"}, Revoked: true})
+
+	if report := newGitLabTestService(t, fake).CheckHealth(context.Background()); report.Status != HealthUnhealthy {
+		t.Fatalf("expected a revoked token to be unhealthy, got %#v", report)
+	}
+}
+
+func TestCheckHealthIgnoresUnavailableTokenDetails(t *testing.T) {
+	fake := gitlabtest.New()
+	fake.InjectFault(gitlabtest.Fault{Path: "/personal_access_tokens/self", Status: http.StatusNotFound})
+
+	report := newGitLabTestService(t, fake).CheckHealth(context.Background())
+
+	if report.Status != HealthHealthy || report.TokenName != "" {
+		t.Fatalf("expected a healthy report without token details, got %#v", report)
+	}
+}
@@ -1,6 +1,11 @@
 package gitlab
 
-import "time"
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
 
 // Project captures a subset of GitLab project metadata returned to MCP clients.
 type Project struct {
@@ -15,6 +20,46 @@ type Project struct {
 	SubgroupFullPath  string `json:"subgroup_full_path,omitempty"`
 }
 
+// GroupProjectsOptions controls how ListGroupProjectsAll traverses a group hierarchy.
+type GroupProjectsOptions struct {
+	// Archived restricts the listing to archived projects.
+	Archived bool
+	// ExcludeArchived skips archived projects. It is ignored when Archived is set.
+	ExcludeArchived bool
+	// MaxResults caps the number of projects returned; zero or less means no limit.
+	MaxResults int
+	// FailFast aborts the listing with an error as soon as any subgroup cannot be read.
+	FailFast bool
+	// Progress, when set, is called each time a subgroup's projects have been fetched.
+	Progress ProgressFunc
+}
+
+// Progress reports how far a long-running operation has got. Completed counts the items
+// finished so far, successful or not; Failed is the subset of those that failed.
+type Progress struct {
+	Completed int
+	Failed    int
+	Total     int
+}
+
+// ProgressFunc receives progress updates. Calls are never concurrent and Completed never
+// decreases between calls.
+type ProgressFunc func(Progress)
+
+// SubgroupFailure describes a subgroup whose projects could not be listed.
+type SubgroupFailure struct {
+	SubgroupID       int    `json:"subgroup_id"`
+	SubgroupFullPath string `json:"subgroup_full_path"`
+	Error            string `json:"error"`
+}
+
+// GroupProjectsResult reports the projects found in a group and its descendant subgroups.
+type GroupProjectsResult struct {
+	Projects        []Project         `json:"projects"`
+	Truncated       bool              `json:"truncated"`
+	FailedSubgroups []SubgroupFailure `json:"failed_subgroups,omitempty"`
+}
+
 // Subgroup contains the subset of GitLab subgroup metadata exposed via MCP tools.
 type Subgroup struct {
 	ID       int    `json:"id"`
@@ -41,10 +86,69 @@ type PipelineSummary struct {
 	AgeYears  float64    `json:"age_years"`
 }
 
+// PipelineFilter selects the pipelines ListOldPipelines returns. Empty fields do not filter.
+type PipelineFilter struct {
+	// CreatedBefore is the cutoff: only pipelines created before it are returned.
+	CreatedBefore time.Time `json:"created_before"`
+	// CreatedAfter, when set, also excludes pipelines created before it, so that together with
+	// CreatedBefore it describes a window.
+	CreatedAfter time.Time `json:"created_after,omitzero"`
+	// Statuses keeps pipelines in any of these states, e.g. failed or canceled.
+	Statuses []string `json:"statuses,omitempty"`
+	// Sources keeps pipelines started by any of these sources, e.g. schedule or merge_request_event.
+	Sources []string `json:"sources,omitempty"`
+	// Refs keeps pipelines whose ref matches any of these globs. "*" matches any run of
+	// characters, including slashes, and "?" matches a single character.
+	Refs []string `json:"refs,omitempty"`
+	// Username keeps pipelines triggered by this user.
+	Username string `json:"username,omitempty"`
+	// RefDeleted keeps pipelines whose branch or tag no longer exists. Merge request pipelines
+	// qualify once the merge request or its source branch is gone.
+	RefDeleted bool `json:"ref_deleted,omitempty"`
+}
+
+// PipelineStatuses lists the pipeline states PipelineFilter.Statuses accepts.
+var PipelineStatuses = []string{
+	"created", "waiting_for_resource", "preparing", "pending", "running",
+	"success", "failed", "canceled", "skipped", "manual", "scheduled",
+}
+
+// PipelineSources lists the pipeline sources PipelineFilter.Sources accepts.
+var PipelineSources = []string{
+	"push", "web", "trigger", "schedule", "api", "external", "pipeline", "chat", "webide",
+	"merge_request_event", "external_pull_request_event", "parent_pipeline",
+	"ondemand_dast_scan", "ondemand_dast_validation", "security_orchestration_policy",
+	"container_registry_push", "duo_workflow", "pipeline_execution_policy_schedule",
+}
+
+// Validate reports statuses and sources GitLab does not know and empty ref globs.
+func (f PipelineFilter) Validate() error {
+	for _, status := range f.Statuses {
+		if !slices.Contains(PipelineStatuses, status) {
+			return fmt.Errorf("unknown pipeline status %q; valid statuses: %s", status, strings.Join(PipelineStatuses, ", "))
+		}
+	}
+	for _, source := range f.Sources {
+		if !slices.Contains(PipelineSources, source) {
+			return fmt.Errorf("unknown pipeline source %q; valid sources: %s", source, strings.Join(PipelineSources, ", "))
+		}
+	}
+	for _, ref := range f.Refs {
+		if strings.TrimSpace(ref) == "" {
+			return fmt.Errorf("ref globs cannot be empty")
+		}
+	}
+
+	return nil
+}
+
 // PipelineDeletionError describes a failure encountered when deleting a pipeline.
 type PipelineDeletionError struct {
 	PipelineID int    `json:"pipeline_id"`
 	Error      string `json:"error"`
+	// Attempts counts the delete requests sent, including retries; zero means the deletion was
+	// never attempted, for example because the call was cancelled first.
+	Attempts int `json:"attempts"`
 }
 
 // PipelineDeletionSummary reports the outcome of a bulk pipeline deletion attempt.
@@ -52,4 +156,7 @@ type PipelineDeletionSummary struct {
 	TotalCandidates int                     `json:"total_candidates"`
 	DeletedIDs      []int                   `json:"deleted_ids"`
 	Failed          []PipelineDeletionError `json:"failed,omitempty"`
+	// SkippedIDs lists planned pipelines left alone because they no longer exist, no longer
+	// match the plan's filter or are now kept by its retention policy.
+	SkippedIDs []int `json:"skipped_ids,omitempty"`
 }
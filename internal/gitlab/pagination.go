@@ -0,0 +1,67 @@
+package gitlab
+
+import (
+	"context"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// listPageSize is the page size requested from GitLab list endpoints.
+const listPageSize = 100
+
+// pageFetcher retrieves a single page of results. Implementations convert the raw
+// GitLab objects into the values to collect and return the response so the caller
+// can follow the pagination headers.
+type pageFetcher[T any] func(page int) ([]T, *gitlab.Response, error)
+
+// collectPages follows GitLab pagination until every page has been fetched or
+// maxResults items have been collected. A maxResults of zero or less disables the
+// limit. The returned flag reports whether results were cut short by the limit.
+func collectPages[T any](ctx context.Context, maxResults int, fetch pageFetcher[T]) ([]T, bool, error) {
+	var results []T
+
+	page := 1
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+
+		items, resp, err := fetch(page)
+		if err != nil {
+			return nil, false, err
+		}
+
+		for _, item := range items {
+			if limitReached(maxResults, len(results)) {
+				return results, true, nil
+			}
+			results = append(results, item)
+		}
+
+		if resp == nil || resp.NextPage == 0 {
+			return results, false, nil
+		}
+
+		if limitReached(maxResults, len(results)) {
+			return results, true, nil
+		}
+
+		page = resp.NextPage
+	}
+}
+
+// remainingResults returns how many more items may be collected under maxResults
+// once collected items are already present. Zero means no limit applies, so a positive
+// maxResults always leaves room for at least one item: once the limit is reached the
+// caller still fetches just enough to tell whether anything was cut off.
+func remainingResults(maxResults, collected int) int {
+	if maxResults <= 0 {
+		return 0
+	}
+
+	return max(maxResults-collected, 1)
+}
+
+func limitReached(maxResults, collected int) bool {
+	return maxResults > 0 && collected >= maxResults
+}
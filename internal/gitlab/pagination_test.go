@@ -0,0 +1,124 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	gitlabclient "gitlab.com/gitlab-org/api/client-go"
+)
+
+func pagedFetcher(pages [][]int, calls *[]int) pageFetcher[int] {
+	return func(page int) ([]int, *gitlabclient.Response, error) {
+		*calls = append(*calls, page)
+
+		resp := &gitlabclient.Response{}
+		if page < len(pages) {
+			resp.NextPage = page + 1
+		}
+
+		return pages[page-1], resp, nil
+	}
+}
+
+func TestCollectPagesFollowsEveryPage(t *testing.T) {
+	var calls []int
+	pages := [][]int{{1, 2}, {3, 4}, {5}}
+
+	results, truncated, err := collectPages(context.Background(), 0, pagedFetcher(pages, &calls))
+	if err != nil {
+		t.Fatalf("collectPages returned error: %v", err)
+	}
+
+	if truncated {
+		t.Error("expected unlimited collection not to be truncated")
+	}
+
+	if want := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(results, want) {
+		t.Fatalf("expected %v, got %v", want, results)
+	}
+
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("expected page requests %v, got %v", want, calls)
+	}
+}
+
+func TestCollectPagesStopsAtMaxResults(t *testing.T) {
+	var calls []int
+	pages := [][]int{{1, 2}, {3, 4}, {5}}
+
+	results, truncated, err := collectPages(context.Background(), 3, pagedFetcher(pages, &calls))
+	if err != nil {
+		t.Fatalf("collectPages returned error: %v", err)
+	}
+
+	if !truncated {
+		t.Error("expected collection to be truncated")
+	}
+
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(results, want) {
+		t.Fatalf("expected %v, got %v", want, results)
+	}
+
+	if want := []int{1, 2}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("expected page requests %v, got %v", want, calls)
+	}
+}
+
+func TestCollectPagesLimitOnLastPageIsNotTruncated(t *testing.T) {
+	var calls []int
+	pages := [][]int{{1, 2}, {3}}
+
+	results, truncated, err := collectPages(context.Background(), 3, pagedFetcher(pages, &calls))
+	if err != nil {
+		t.Fatalf("collectPages returned error: %v", err)
+	}
+
+	if truncated {
+		t.Error("expected collection that exactly fits the limit not to be truncated")
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+}
+
+func TestRemainingResultsNeverLiftsALimit(t *testing.T) {
+	tests := []struct {
+		maxResults, collected, want int
+	}{
+		{maxResults: 0, collected: 5, want: 0},
+		{maxResults: 5, collected: 2, want: 3},
+		{maxResults: 5, collected: 5, want: 1},
+		{maxResults: 5, collected: 7, want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := remainingResults(tt.maxResults, tt.collected); got != tt.want {
+			t.Errorf("remainingResults(%d, %d) = %d, want %d", tt.maxResults, tt.collected, got, tt.want)
+		}
+	}
+}
+
+func TestCollectPagesPropagatesErrors(t *testing.T) {
+	fetchErr := errors.New("boom")
+
+	_, _, err := collectPages(context.Background(), 0, func(int) ([]int, *gitlabclient.Response, error) {
+		return nil, nil, fetchErr
+	})
+	if !errors.Is(err, fetchErr) {
+		t.Fatalf("expected fetch error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err = collectPages(ctx, 0, func(int) ([]int, *gitlabclient.Response, error) {
+		t.Fatal("fetch should not be called after cancellation")
+		return nil, nil, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context cancellation error, got %v", err)
+	}
+}
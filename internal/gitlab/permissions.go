@@ -0,0 +1,285 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// Errors returned by Preflight when the access token cannot perform an action.
+var (
+	// ErrMissingScope reports a token without the scope an action needs.
+	ErrMissingScope = errors.New("access token lacks the required scope")
+	// ErrInsufficientAccess reports a token user whose role on the target is too low.
+	ErrInsufficientAccess = errors.New("insufficient access level")
+)
+
+// Action is a change to GitLab that Preflight can check before it is attempted.
+type Action struct {
+	// Name describes the action in explanations, e.g. "archive a project".
+	Name string
+	// Scope is the token scope the action needs.
+	Scope string
+	// MinAccess is the lowest role on the project allowed to perform the action.
+	MinAccess gitlab.AccessLevelValue
+}
+
+// Actions guarded by Preflight.
+var (
+	ActionArchiveProject  = Action{Name: "archive a project", Scope: "api", MinAccess: gitlab.OwnerPermissions}
+	ActionDeletePipelines = Action{Name: "delete pipelines", Scope: "api", MinAccess: gitlab.OwnerPermissions}
+)
+
+// projectActions are reported by ProjectAccess in the order they are listed here.
+var projectActions = []Action{ActionArchiveProject, ActionDeletePipelines}
+
+// Identity describes the user and access token the Service talks to GitLab as.
+type Identity struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	IsAdmin  bool   `json:"is_admin"`
+	// The token fields are empty when the token cannot describe itself, which is the case for
+	// anything but personal access tokens.
+	TokenName      string   `json:"token_name,omitempty"`
+	TokenScopes    []string `json:"token_scopes,omitempty"`
+	TokenExpiresAt string   `json:"token_expires_at,omitempty"`
+}
+
+// Access describes the token user's role on a group or project.
+type Access struct {
+	Target      string                  `json:"target"`
+	AccessLevel gitlab.AccessLevelValue `json:"access_level"`
+	Role        string                  `json:"role"`
+	// Denied explains, for projects, each guarded action that Preflight would reject.
+	Denied []string `json:"denied,omitempty"`
+}
+
+// identityTTL is how long CachedIdentity reuses an Identity looked up earlier.
+const identityTTL = 5 * time.Minute
+
+// Identity returns the current user and, when GitLab can describe it, the access token. The
+// result is remembered for CachedIdentity.
+func (s *Service) Identity(ctx context.Context) (*Identity, error) {
+	user, err := s.CurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		UserID:   user.ID,
+		Username: user.Username,
+		Name:     user.Name,
+		IsAdmin:  user.IsAdmin,
+	}
+
+	token, _, err := s.api.AccessTokens.GetSinglePersonalAccessToken(gitlab.WithContext(ctx))
+	if err != nil {
+		// OAuth, job and other tokens that are not personal access tokens cannot describe themselves.
+		s.log.DebugContext(ctx, "token details unavailable", "error", err)
+	} else {
+		identity.TokenName = token.Name
+		identity.TokenScopes = token.Scopes
+		if token.ExpiresAt != nil {
+			identity.TokenExpiresAt = time.Time(*token.ExpiresAt).Format("2006-01-02")
+		}
+	}
+
+	s.rememberIdentity(identity)
+
+	return identity, nil
+}
+
+// CachedIdentity returns the Identity this Service looked up within the last identityTTL, or
+// looks it up. Preflight and audit records use it so a mutating call does not ask GitLab who the
+// token belongs to more than once; callers that find the cache empty together share one lookup.
+func (s *Service) CachedIdentity(ctx context.Context) (*Identity, error) {
+	if identity := s.freshIdentity(); identity != nil {
+		return identity, nil
+	}
+
+	s.identityLookup.Lock()
+	defer s.identityLookup.Unlock()
+
+	if identity := s.freshIdentity(); identity != nil {
+		return identity, nil
+	}
+
+	return s.Identity(ctx)
+}
+
+// freshIdentity returns the remembered Identity while it is younger than identityTTL.
+func (s *Service) freshIdentity() *Identity {
+	s.identityMu.Lock()
+	defer s.identityMu.Unlock()
+
+	if s.identity == nil || time.Since(s.identityAt) >= identityTTL {
+		return nil
+	}
+	return s.identity
+}
+
+func (s *Service) rememberIdentity(identity *Identity) {
+	s.identityMu.Lock()
+	defer s.identityMu.Unlock()
+
+	s.identity, s.identityAt = identity, time.Now()
+}
+
+// ProjectAccess returns the role identity holds on the project, directly or through its groups,
+// and which guarded actions it could not perform there. Administrators can act on every project.
+func (s *Service) ProjectAccess(ctx context.Context, projectIDOrPath string, identity *Identity) (Access, error) {
+	access := Access{Target: projectIDOrPath}
+
+	if identity.IsAdmin {
+		access.AccessLevel = gitlab.AdminPermissions
+	} else {
+		member, _, err := s.api.ProjectMembers.GetInheritedProjectMember(projectIDOrPath, identity.UserID, gitlab.WithContext(ctx))
+		switch {
+		case errors.Is(err, gitlab.ErrNotFound):
+			access.AccessLevel = gitlab.NoPermissions
+		case err != nil:
+			return Access{}, fmt.Errorf("get project membership: %w", err)
+		default:
+			access.AccessLevel = member.AccessLevel
+		}
+	}
+	access.Role = RoleName(access.AccessLevel)
+
+	for _, action := range projectActions {
+		if err := checkAction(identity, access, action); err != nil {
+			access.Denied = append(access.Denied, err.Error())
+		}
+	}
+
+	return access, nil
+}
+
+// GroupAccess returns the role identity holds on the group, directly or through its parents.
+func (s *Service) GroupAccess(ctx context.Context, groupIDOrPath string, identity *Identity) (Access, error) {
+	access := Access{Target: groupIDOrPath}
+
+	if identity.IsAdmin {
+		access.AccessLevel = gitlab.AdminPermissions
+	} else {
+		member, _, err := s.api.GroupMembers.GetInheritedGroupMember(groupIDOrPath, identity.UserID, gitlab.WithContext(ctx))
+		switch {
+		case errors.Is(err, gitlab.ErrNotFound):
+			access.AccessLevel = gitlab.NoPermissions
+		case err != nil:
+			return Access{}, fmt.Errorf("get group membership: %w", err)
+		default:
+			access.AccessLevel = member.AccessLevel
+		}
+	}
+	access.Role = RoleName(access.AccessLevel)
+
+	return access, nil
+}
+
+// Permit is Preflight's approval of one action on one project. The mutating Service methods
+// accept it so that a caller who checked early, for example before asking a human to confirm,
+// does not look the same user, project and membership up again; GitLab still refuses the change
+// itself if the token lost access in between.
+type Permit struct {
+	project string
+	action  Action
+}
+
+// Preflight checks that the access token can perform action on the project before anything is
+// changed, so a missing scope or role fails early with an explanation rather than part-way
+// through. The returned error wraps ErrMissingScope or ErrInsufficientAccess when the check fails.
+func (s *Service) Preflight(ctx context.Context, projectIDOrPath string, action Action) (*Permit, error) {
+	identity, err := s.CachedIdentity(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("preflight: %w", err)
+	}
+
+	access, err := s.ProjectAccess(ctx, projectIDOrPath, identity)
+	if err != nil {
+		return nil, fmt.Errorf("preflight: %w", err)
+	}
+
+	if err := checkAction(identity, access, action); err != nil {
+		s.log.WarnContext(ctx, "preflight check failed", "project", projectIDOrPath, "action", action.Name, "error", err)
+		return nil, err
+	}
+
+	return &Permit{project: projectIDOrPath, action: action}, nil
+}
+
+// PreflightProjects runs Preflight for action on every project, at most the configured project
+// concurrency at a time, and returns the permits and errors in the order of projects.
+func (s *Service) PreflightProjects(ctx context.Context, projects []string, action Action) ([]*Permit, []error) {
+	permits := make([]*Permit, len(projects))
+	errs := make([]error, len(projects))
+
+	s.forEachProject(ctx, len(projects), func(i int) {
+		permits[i], errs[i] = s.Preflight(ctx, projects[i], action)
+	})
+
+	// Projects never checked because ctx was cancelled are reported as failed.
+	for i := range projects {
+		if permits[i] == nil && errs[i] == nil {
+			errs[i] = fmt.Errorf("preflight: not attempted: %w", context.Cause(ctx))
+		}
+	}
+
+	return permits, errs
+}
+
+// authorize runs Preflight unless permit already allows action on the project.
+func (s *Service) authorize(ctx context.Context, permit *Permit, projectIDOrPath string, action Action) error {
+	if permit != nil && permit.project == projectIDOrPath && permit.action == action {
+		return nil
+	}
+
+	_, err := s.Preflight(ctx, projectIDOrPath, action)
+	return err
+}
+
+func checkAction(identity *Identity, access Access, action Action) error {
+	// Tokens that cannot list their scopes are given the benefit of the doubt.
+	if identity.TokenScopes != nil && !slices.Contains(identity.TokenScopes, action.Scope) {
+		return fmt.Errorf("%w: to %s the token needs the %s scope, but %q only has %s",
+			ErrMissingScope, action.Name, action.Scope, identity.TokenName, strings.Join(identity.TokenScopes, ", "))
+	}
+
+	if access.AccessLevel < action.MinAccess {
+		return fmt.Errorf("%w: to %s %s needs the %s role on %s, but has %s",
+			ErrInsufficientAccess, action.Name, identity.Username, RoleName(action.MinAccess), access.Target, RoleName(access.AccessLevel))
+	}
+
+	return nil
+}
+
+// RoleName returns the name GitLab shows for an access level.
+func RoleName(level gitlab.AccessLevelValue) string {
+	switch level {
+	case gitlab.NoPermissions:
+		return "no role"
+	case gitlab.MinimalAccessPermissions:
+		return "Minimal Access"
+	case gitlab.GuestPermissions:
+		return "Guest"
+	case gitlab.PlannerPermissions:
+		return "Planner"
+	case gitlab.ReporterPermissions:
+		return "Reporter"
+	case gitlab.DeveloperPermissions:
+		return "Developer"
+	case gitlab.MaintainerPermissions:
+		return "Maintainer"
+	case gitlab.OwnerPermissions:
+		return "Owner"
+	case gitlab.AdminPermissions:
+		return "Administrator"
+	default:
+		return fmt.Sprintf("access level %d", level)
+	}
+}
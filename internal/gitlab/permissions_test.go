@@ -0,0 +1,199 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	gitlabclient "gitlab.com/gitlab-org/api/client-go"
+
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab/gitlabtest"
+)
+
+func TestPreflight(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(fake *gitlabtest.Server)
+		wantErr error
+		message string
+	}{
+		{
+			name:  "owner through parent group",
+			setup: func(fake *gitlabtest.Server) { fake.SetAccessLevel("acme", gitlabclient.OwnerPermissions) },
+		},
+		{
+			name: "developer",
+			setup: func(fake *gitlabtest.Server) {
+				fake.SetAccessLevel("acme", gitlabclient.ReporterPermissions)
+				fake.SetAccessLevel("acme/tools/cli", gitlabclient.DeveloperPermissions)
+			},
+			wantErr: ErrInsufficientAccess,
+			message: "needs the Owner role on acme/tools/cli, but has Developer",
+		},
+		{
+			name:    "not a member",
+			setup:   func(fake *gitlabtest.Server) { fake.SetAccessLevel("other", gitlabclient.OwnerPermissions) },
+			wantErr: ErrInsufficientAccess,
+			message: "but has no role",
+		},
+		{
+			name: "read-only token",
+			setup: func(fake *gitlabtest.Server) {
+				fake.SetAccessToken(gitlabclient.PersonalAccessToken{Name: "reader", Scopes: []string{"read_api"}, Active: true})
+			},
+			wantErr: ErrMissingScope,
+			message: `needs the api scope, but "reader" only has read_api`,
+		},
+		{
+			name: "token without details",
+			setup: func(fake *gitlabtest.Server) {
+				fake.InjectFault(gitlabtest.Fault{Path: "/personal_access_tokens/self", Status: http.StatusNotFound})
+			},
+		},
+		{
+			name: "administrator",
+			setup: func(fake *gitlabtest.Server) {
+				fake.SetCurrentUser(gitlabclient.User{ID: 1, Username: "root", IsAdmin: true})
+				fake.SetAccessLevel("other", gitlabclient.OwnerPermissions)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := gitlabtest.New()
+			fake.AddProject("acme/tools", "cli")
+			tt.setup(fake)
+
+			_, err := newGitLabTestService(t, fake).Preflight(context.Background(), "acme/tools/cli", ActionArchiveProject)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Preflight returned error: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, tt.wantErr) || !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("expected %v mentioning %q, got %v", tt.wantErr, tt.message, err)
+			}
+			if category, _ := ClassifyError(err); category != ErrorCategoryForbidden {
+				t.Fatalf("expected preflight errors to be forbidden, got %s", category)
+			}
+		})
+	}
+}
+
+func TestArchiveProjectRunsPreflight(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	fake.SetAccessLevel("acme/api", gitlabclient.MaintainerPermissions)
+
+	if _, err := newGitLabTestService(t, fake).ArchiveProject(context.Background(), "acme/api", nil); !errors.Is(err, ErrInsufficientAccess) {
+		t.Fatalf("expected ArchiveProject to fail preflight, got %v", err)
+	}
+	if fake.Project(project.ID).Archived {
+		t.Fatal("expected the project to stay unarchived")
+	}
+}
+
+func TestArchiveProjectUsesPermit(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	service := newGitLabTestService(t, fake)
+
+	permit, err := service.Preflight(context.Background(), "acme/api", ActionArchiveProject)
+	if err != nil {
+		t.Fatalf("Preflight returned error: %v", err)
+	}
+	if _, err := service.ArchiveProject(context.Background(), "acme/api", permit); err != nil {
+		t.Fatalf("ArchiveProject returned error: %v", err)
+	}
+	if !fake.Project(project.ID).Archived {
+		t.Fatal("expected the project to be archived")
+	}
+
+	lookups := 0
+	for _, request := range fake.Requests() {
+		if strings.Contains(request.Path, "/members/all/") {
+			lookups++
+		}
+	}
+	if lookups != 1 {
+		t.Fatalf("expected the permit to spare a second membership lookup, got %d", lookups)
+	}
+}
+
+func TestPreflightProjects(t *testing.T) {
+	fake := gitlabtest.New()
+	fake.AddProject("acme", "api")
+	fake.AddProject("acme", "web")
+	fake.SetAccessLevel("acme/api", gitlabclient.OwnerPermissions)
+	fake.SetAccessLevel("acme/web", gitlabclient.DeveloperPermissions)
+
+	permits, errs := newGitLabTestService(t, fake).PreflightProjects(context.Background(), []string{"acme/api", "acme/web"}, ActionDeletePipelines)
+
+	if permits[0] == nil || errs[0] != nil {
+		t.Fatalf("expected acme/api to be permitted, got %v", errs[0])
+	}
+	if permits[1] != nil || !errors.Is(errs[1], ErrInsufficientAccess) {
+		t.Fatalf("expected acme/web to be rejected, got %v", errs[1])
+	}
+}
+
+func TestCachedIdentityWithoutTokenDetails(t *testing.T) {
+	fake := gitlabtest.New()
+	paths := []string{"acme/api", "acme/web", "acme/docs", "acme/cli"}
+	for _, path := range paths {
+		fake.AddProject("acme", strings.TrimPrefix(path, "acme/"))
+	}
+	// OAuth and job tokens cannot look themselves up.
+	fake.InjectFault(gitlabtest.Fault{Method: http.MethodGet, Path: "/personal_access_tokens/self", Status: http.StatusNotFound})
+
+	service := newGitLabTestService(t, fake, WithProjectConcurrency(len(paths)))
+	for range 2 {
+		_, errs := service.PreflightProjects(context.Background(), paths, ActionDeletePipelines)
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("expected %s to be permitted, got %v", paths[i], err)
+			}
+		}
+	}
+
+	lookups := map[string]int{}
+	for _, request := range fake.Requests() {
+		lookups[request.Path]++
+	}
+	if lookups["/user"] != 1 || lookups["/personal_access_tokens/self"] != 1 {
+		t.Fatalf("expected the identity to be looked up once, got %v", lookups)
+	}
+}
+
+func TestProjectAndGroupAccess(t *testing.T) {
+	fake := gitlabtest.New()
+	fake.AddProject("acme", "api")
+	fake.SetAccessLevel("acme", gitlabclient.MaintainerPermissions)
+
+	service := newGitLabTestService(t, fake)
+	identity, err := service.Identity(context.Background())
+	if err != nil {
+		t.Fatalf("Identity returned error: %v", err)
+	}
+	if identity.Username != "gitlabtest" || identity.TokenName != "gitlabtest" {
+		t.Fatalf("unexpected identity: %#v", identity)
+	}
+
+	access, err := service.ProjectAccess(context.Background(), "acme/api", identity)
+	if err != nil {
+		t.Fatalf("ProjectAccess returned error: %v", err)
+	}
+	if access.Role != "Maintainer" || len(access.Denied) != 2 {
+		t.Fatalf("expected Maintainer access denied both guarded actions, got %#v", access)
+	}
+
+	group, err := service.GroupAccess(context.Background(), "acme", identity)
+	if err != nil || group.AccessLevel != gitlabclient.MaintainerPermissions || len(group.Denied) != 0 {
+		t.Fatalf("unexpected group access %#v (%v)", group, err)
+	}
+}
@@ -2,53 +2,102 @@ package gitlab
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	gitlab "gitlab.com/gitlab-org/api/client-go"
 )
 
-const pipelinePageSize = 100
-
-// ListOldPipelines returns pipelines for the given project created before the specified timestamp.
-func (s *Service) ListOldPipelines(ctx context.Context, projectIDOrPath string, before time.Time) ([]PipelineSummary, error) {
-	cutoff := before.UTC()
+// ListOldPipelines returns pipelines for the given project created before filter.CreatedBefore that
+// match the rest of filter. At most maxResults pipelines are returned when maxResults is positive;
+// the boolean result reports whether the listing stopped early because of that limit.
+func (s *Service) ListOldPipelines(ctx context.Context, projectIDOrPath string, filter PipelineFilter, maxResults int) ([]PipelineSummary, bool, error) {
+	cutoff := filter.CreatedBefore.UTC()
+	after := filter.CreatedAfter.UTC()
+	refs := compileRefGlobs(filter.Refs)
+	refExists := map[string]bool{}
 
 	opts := &gitlab.ListProjectPipelinesOptions{
 		ListOptions: gitlab.ListOptions{
-			PerPage: pipelinePageSize,
-			Page:    1,
+			PerPage: listPageSize,
 		},
 		CreatedBefore: gitlab.Ptr(cutoff),
 		OrderBy:       gitlab.Ptr("created_at"),
 		Sort:          gitlab.Ptr("asc"),
 	}
+	if !filter.CreatedAfter.IsZero() {
+		opts.CreatedAfter = gitlab.Ptr(after)
+	}
+	// GitLab filters on a single value per field; anything broader is filtered below.
+	if len(filter.Statuses) == 1 {
+		opts.Status = gitlab.Ptr(gitlab.BuildStateValue(filter.Statuses[0]))
+	}
+	if len(filter.Sources) == 1 {
+		opts.Source = gitlab.Ptr(filter.Sources[0])
+	}
+	if len(filter.Refs) == 1 && !strings.ContainsAny(filter.Refs[0], "*?") {
+		opts.Ref = gitlab.Ptr(filter.Refs[0])
+	}
+	if filter.Username != "" {
+		opts.Username = gitlab.Ptr(filter.Username)
+	}
 
-	var results []PipelineSummary
+	results, truncated, err := collectPages(ctx, maxResults, func(page int) ([]PipelineSummary, *gitlab.Response, error) {
+		opts.Page = page
 
-	for {
-		pipelines, resp, err := s.client.Pipelines.ListProjectPipelines(projectIDOrPath, opts, gitlab.WithContext(ctx))
+		pipelines, resp, err := s.api.Pipelines.ListProjectPipelines(projectIDOrPath, opts, gitlab.WithContext(ctx))
 		if err != nil {
-			return nil, fmt.Errorf("list project pipelines: %w", err)
+			return nil, nil, err
 		}
 
+		var summaries []PipelineSummary
 		for _, pipeline := range pipelines {
 			if pipeline == nil {
 				continue
 			}
 
+			if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, pipeline.Status) {
+				continue
+			}
+			if len(filter.Sources) > 0 && !slices.Contains(filter.Sources, pipeline.Source) {
+				continue
+			}
+			if len(refs) > 0 && !slices.ContainsFunc(refs, func(glob *regexp.Regexp) bool { return glob.MatchString(pipeline.Ref) }) {
+				continue
+			}
+
 			var createdAtPtr *time.Time
 			var updatedAtPtr *time.Time
 
 			if pipeline.CreatedAt != nil {
 				created := pipeline.CreatedAt.UTC()
-				if !created.Before(cutoff) {
+				if !created.Before(cutoff) || (!filter.CreatedAfter.IsZero() && created.Before(after)) {
 					continue
 				}
 				createdAtPtr = gitlab.Ptr(created)
 			}
 
+			if filter.RefDeleted {
+				exists, seen := refExists[pipeline.Ref]
+				if !seen {
+					exists, err = s.refExists(ctx, projectIDOrPath, pipeline.Ref)
+					if err != nil {
+						return nil, nil, err
+					}
+					refExists[pipeline.Ref] = exists
+				}
+				if exists {
+					continue
+				}
+			}
+
 			if pipeline.UpdatedAt != nil {
 				updated := pipeline.UpdatedAt.UTC()
 				updatedAtPtr = gitlab.Ptr(updated)
@@ -56,7 +105,7 @@ func (s *Service) ListOldPipelines(ctx context.Context, projectIDOrPath string,
 
 			ageDays, ageYears := pipelineAge(createdAtPtr)
 
-			results = append(results, PipelineSummary{
+			summaries = append(summaries, PipelineSummary{
 				ID:        pipeline.ID,
 				IID:       pipeline.IID,
 				ProjectID: pipeline.ProjectID,
@@ -72,45 +121,245 @@ func (s *Service) ListOldPipelines(ctx context.Context, projectIDOrPath string,
 			})
 		}
 
-		if resp == nil || resp.NextPage == 0 {
-			break
-		}
+		return summaries, resp, nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("list project pipelines: %w", err)
+	}
+
+	return results, truncated, nil
+}
+
+// DeleteOldPipelines deletes all pipelines for the given project that match filter, except those
+// policy keeps. When progress is non-nil it is called once the candidates are known and again
+// after each deletion attempt.
+func (s *Service) DeleteOldPipelines(ctx context.Context, projectIDOrPath string, filter PipelineFilter, policy RetentionPolicy, progress ProgressFunc) (*PipelineDeletionSummary, error) {
+	cleanup, err := s.PlanPipelineCleanup(ctx, projectIDOrPath, filter, policy, 0)
+	if err != nil {
+		return nil, err
+	}
 
-		opts.Page = resp.NextPage
+	pipelineIDs := make([]int, 0, len(cleanup.Delete))
+	for _, pipeline := range cleanup.Delete {
+		pipelineIDs = append(pipelineIDs, pipeline.ID)
 	}
 
-	return results, nil
+	if len(pipelineIDs) > 0 {
+		if _, err := s.Preflight(ctx, projectIDOrPath, ActionDeletePipelines); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.deletePipelines(ctx, projectIDOrPath, pipelineIDs, progress), nil
 }
 
-// DeleteOldPipelines deletes all pipelines for the given project created before the specified timestamp.
-func (s *Service) DeleteOldPipelines(ctx context.Context, projectIDOrPath string, before time.Time) (*PipelineDeletionSummary, error) {
-	pipelines, err := s.ListOldPipelines(ctx, projectIDOrPath, before)
+// DeletePipelines deletes the given pipelines from the project, typically those of a reviewed
+// plan. The pipelines are listed again with filter and policy first; any that no longer exist, no
+// longer match or are now kept are left alone and reported in SkippedIDs. Permissions are taken
+// from permit, or checked with Preflight when permit is nil. It returns an error only when the
+// check fails or the pipelines cannot be listed again; see deletePipelines for how the rest are
+// deleted.
+func (s *Service) DeletePipelines(ctx context.Context, projectIDOrPath string, filter PipelineFilter, policy RetentionPolicy, pipelineIDs []int, permit *Permit, progress ProgressFunc) (*PipelineDeletionSummary, error) {
+	if len(pipelineIDs) > 0 {
+		if err := s.authorize(ctx, permit, projectIDOrPath, ActionDeletePipelines); err != nil {
+			return nil, err
+		}
+	}
+
+	current, skipped, err := s.RecheckPipelines(ctx, projectIDOrPath, filter, policy, pipelineIDs)
 	if err != nil {
 		return nil, err
 	}
+	if len(skipped) > 0 {
+		s.log.InfoContext(ctx, "skipping pipelines the plan no longer selects", "project", projectIDOrPath,
+			"pipeline_ids", skipped)
+	}
+
+	result := s.deletePipelines(ctx, projectIDOrPath, current, progress)
+	result.TotalCandidates = len(pipelineIDs)
+	result.SkippedIDs = skipped
+
+	return result, nil
+}
+
+// RecheckPipelines plans the project's cleanup with filter and policy again and splits
+// pipelineIDs into those it still deletes and those that were deleted meanwhile, no longer match
+// or are now kept, for example because they became the latest pipelines of their ref. Both are in
+// the order of pipelineIDs.
+func (s *Service) RecheckPipelines(ctx context.Context, projectIDOrPath string, filter PipelineFilter, policy RetentionPolicy, pipelineIDs []int) (current, stale []int, err error) {
+	if len(pipelineIDs) == 0 {
+		return nil, nil, nil
+	}
+
+	cleanup, err := s.PlanPipelineCleanup(ctx, projectIDOrPath, filter, policy, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("recheck planned pipelines: %w", err)
+	}
+
+	matching := make(map[int]bool, len(cleanup.Delete))
+	for _, pipeline := range cleanup.Delete {
+		matching[pipeline.ID] = true
+	}
+
+	for _, id := range pipelineIDs {
+		if matching[id] {
+			current = append(current, id)
+		} else {
+			stale = append(stale, id)
+		}
+	}
+
+	return current, stale, nil
+}
 
+// deletePipelines deletes exactly the given pipelines from the project, several at a time and
+// paced by the Service's deletion rate limit, once Preflight has allowed it. Deletions rejected
+// with 429 or a 5xx status are retried. Individual failures, including pipelines not attempted
+// because ctx was cancelled, are recorded in the summary rather than aborting the run. Deleted
+// and failed pipelines are listed in the order of pipelineIDs. When progress is non-nil it is
+// called before the first deletion and again after each pipeline is done.
+func (s *Service) deletePipelines(ctx context.Context, projectIDOrPath string, pipelineIDs []int, progress ProgressFunc) *PipelineDeletionSummary {
 	result := &PipelineDeletionSummary{
-		TotalCandidates: len(pipelines),
+		TotalCandidates: len(pipelineIDs),
+	}
+
+	var (
+		mu        sync.Mutex
+		completed Progress
+	)
+	report := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		completed.Completed++
+		if err != nil {
+			completed.Failed++
+		}
+		if progress != nil {
+			progress(Progress{Completed: completed.Completed, Failed: completed.Failed, Total: len(pipelineIDs)})
+		}
+	}
+
+	if progress != nil {
+		progress(Progress{Total: len(pipelineIDs)})
 	}
 
-	if len(pipelines) == 0 {
-		return result, nil
+	if len(pipelineIDs) == 0 {
+		return result
+	}
+
+	s.log.InfoContext(ctx, "deleting pipelines", "project", projectIDOrPath, "candidates", len(pipelineIDs),
+		"concurrency", s.deletionConcurrency)
+
+	type outcome struct {
+		attempts int
+		err      error
+	}
+	outcomes := make([]outcome, len(pipelineIDs))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(s.deletionConcurrency, len(pipelineIDs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				attempts, err := s.deletePipeline(ctx, projectIDOrPath, pipelineIDs[i])
+				if err != nil {
+					s.log.ErrorContext(ctx, "failed to delete pipeline", "project", projectIDOrPath, "pipeline_id", pipelineIDs[i],
+						"attempts", attempts, "error", err)
+				}
+				outcomes[i] = outcome{attempts: attempts, err: err}
+				report(err)
+			}
+		}()
+	}
+	for i := range pipelineIDs {
+		jobs <- i
 	}
+	close(jobs)
+	wg.Wait()
 
-	for _, pipeline := range pipelines {
-		if _, err := s.client.Pipelines.DeletePipeline(projectIDOrPath, pipeline.ID, gitlab.WithContext(ctx)); err != nil {
-			s.log.Printf("error deleting pipeline %d in project %s: %v", pipeline.ID, projectIDOrPath, err)
+	for i, pipelineID := range pipelineIDs {
+		if err := outcomes[i].err; err != nil {
 			result.Failed = append(result.Failed, PipelineDeletionError{
-				PipelineID: pipeline.ID,
+				PipelineID: pipelineID,
 				Error:      err.Error(),
+				Attempts:   outcomes[i].attempts,
 			})
-			continue
+		} else {
+			result.DeletedIDs = append(result.DeletedIDs, pipelineID)
 		}
+	}
+
+	s.log.InfoContext(ctx, "finished deleting pipelines", "project", projectIDOrPath,
+		"deleted", len(result.DeletedIDs), "failed", len(result.Failed))
+
+	return result
+}
+
+// mergeRequestRef matches the refs GitLab runs merge request pipelines on.
+var mergeRequestRef = regexp.MustCompile(`^refs/merge-requests/(\d+)/(?:head|merge|train)$`)
 
-		result.DeletedIDs = append(result.DeletedIDs, pipeline.ID)
+// refExists reports whether ref is still a branch or tag of the project or, for merge request
+// pipelines, whether the merge request's source branch still exists.
+func (s *Service) refExists(ctx context.Context, projectIDOrPath string, ref string) (bool, error) {
+	if match := mergeRequestRef.FindStringSubmatch(ref); match != nil {
+		if iid, err := strconv.Atoi(match[1]); err == nil {
+			mr, _, err := s.api.MergeRequests.GetMergeRequest(projectIDOrPath, iid, nil, gitlab.WithContext(ctx))
+			switch {
+			case errors.Is(err, gitlab.ErrNotFound):
+				return false, nil
+			case err != nil:
+				return false, fmt.Errorf("get merge request !%d: %w", iid, err)
+			}
+			return s.branchExists(ctx, mr.SourceProjectID, mr.SourceBranch)
+		}
 	}
 
-	return result, nil
+	if exists, err := s.branchExists(ctx, projectIDOrPath, ref); err != nil || exists {
+		return exists, err
+	}
+
+	return s.tagExists(ctx, projectIDOrPath, ref)
+}
+
+func (s *Service) tagExists(ctx context.Context, projectIDOrPath string, tag string) (bool, error) {
+	_, _, err := s.api.Tags.GetTag(projectIDOrPath, tag, gitlab.WithContext(ctx))
+	switch {
+	case errors.Is(err, gitlab.ErrNotFound):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("get tag %s: %w", tag, err)
+	}
+
+	return true, nil
+}
+
+func (s *Service) branchExists(ctx context.Context, projectIDOrPath any, branch string) (bool, error) {
+	_, _, err := s.api.Branches.GetBranch(projectIDOrPath, branch, gitlab.WithContext(ctx))
+	switch {
+	case errors.Is(err, gitlab.ErrNotFound):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("get branch %s: %w", branch, err)
+	}
+
+	return true, nil
+}
+
+// compileRefGlobs turns ref globs into anchored regular expressions in which "*" matches any run
+// of characters, slashes included, and "?" matches one character.
+func compileRefGlobs(globs []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(globs))
+	for _, glob := range globs {
+		pattern := regexp.QuoteMeta(strings.TrimSpace(glob))
+		pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+		pattern = strings.ReplaceAll(pattern, `\?`, ".")
+		compiled = append(compiled, regexp.MustCompile("^"+pattern+"$"))
+	}
+
+	return compiled
 }
 
 func pipelineAge(createdAt *time.Time) (int, float64) {
@@ -2,169 +2,83 @@ package gitlab
 
 import (
 	"context"
-	"encoding/json"
-	"io"
-	"log"
+	"fmt"
 	"math"
 	"net/http"
-	"net/http/httptest"
 	"net/url"
 	"path"
+	"slices"
 	"strconv"
 	"strings"
-	"sync"
 	"testing"
 	"time"
 
 	gitlabclient "gitlab.com/gitlab-org/api/client-go"
-)
-
-type pipelineResponse struct {
-	ID        int        `json:"id"`
-	IID       int        `json:"iid"`
-	ProjectID int        `json:"project_id"`
-	Status    string     `json:"status"`
-	Source    string     `json:"source"`
-	Ref       string     `json:"ref"`
-	SHA       string     `json:"sha"`
-	WebURL    string     `json:"web_url"`
-	CreatedAt *time.Time `json:"created_at,omitempty"`
-	UpdatedAt *time.Time `json:"updated_at,omitempty"`
-}
-
-type fakeGitLabServer struct {
-	t              *testing.T
-	projectPath    string
-	pipelines      []pipelineResponse
-	deleteFailures map[int]bool
 
-	mu          sync.Mutex
-	lastQuery   url.Values
-	lastPath    string
-	deleteCalls []int
-}
-
-func (f *fakeGitLabServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	f.mu.Lock()
-	f.lastPath = r.URL.Path
-	f.mu.Unlock()
-
-	switch {
-	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, f.projectPath) && strings.HasSuffix(r.URL.Path, "/pipelines"):
-		f.mu.Lock()
-		f.lastQuery = r.URL.Query()
-		pipelines := append([]pipelineResponse(nil), f.pipelines...)
-		f.mu.Unlock()
-
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(pipelines); err != nil {
-			f.t.Fatalf("encodes pipelines: %v", err)
-		}
-	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, f.projectPath) && strings.Contains(r.URL.Path, "/pipelines/"):
-		idStr := path.Base(r.URL.Path)
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			http.Error(w, "invalid id", http.StatusBadRequest)
-			return
-		}
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab/gitlabtest"
+)
 
-		f.mu.Lock()
-		f.deleteCalls = append(f.deleteCalls, id)
-		f.lastPath = r.URL.Path
-		fail := f.deleteFailures != nil && f.deleteFailures[id]
-		f.mu.Unlock()
+// lastPipelineQuery returns the query of the last pipeline listing the fake answered.
+func lastPipelineQuery(t *testing.T, fake *gitlabtest.Server) url.Values {
+	t.Helper()
 
-		if fail {
-			http.Error(w, "delete failed", http.StatusInternalServerError)
-			return
+	requests := fake.Requests()
+	for i := len(requests) - 1; i >= 0; i-- {
+		if requests[i].Method == http.MethodGet && strings.HasSuffix(requests[i].Path, "/pipelines") {
+			return requests[i].Query
 		}
-
-		w.WriteHeader(http.StatusNoContent)
-	default:
-		http.NotFound(w, r)
 	}
+	t.Fatal("expected a pipeline listing request")
+	return nil
 }
 
-type roundTripFunc func(*http.Request) (*http.Response, error)
-
-func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
-	return f(r)
-}
-
-func setupPipelineService(t *testing.T, project string, pipelines []pipelineResponse, deleteFailures map[int]bool) (*Service, *fakeGitLabServer) {
-	t.Helper()
-
-	projectPath := "/api/v4/projects/" + project
-	fake := &fakeGitLabServer{
-		t:              t,
-		projectPath:    projectPath,
-		pipelines:      append([]pipelineResponse(nil), pipelines...),
-		deleteFailures: deleteFailures,
-	}
-
-	httpClient := &http.Client{
-		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
-			recorder := httptest.NewRecorder()
-			fake.ServeHTTP(recorder, r)
-			return recorder.Result(), nil
-		}),
-	}
-
-	client, err := gitlabclient.NewClient(
-		"test-token",
-		gitlabclient.WithBaseURL("http://example.com/api/v4"),
-		gitlabclient.WithHTTPClient(httpClient),
-	)
-	if err != nil {
-		t.Fatalf("create gitlab client: %v", err)
+// pipelineDeletes returns the IDs of the pipelines the fake was asked to delete, in order.
+func pipelineDeletes(fake *gitlabtest.Server) []int {
+	var ids []int
+	for _, request := range fake.Requests() {
+		if request.Method != http.MethodDelete || !strings.Contains(request.Path, "/pipelines/") {
+			continue
+		}
+		if id, err := strconv.Atoi(path.Base(request.Path)); err == nil {
+			ids = append(ids, id)
+		}
 	}
-
-	service := NewService(client, log.New(io.Discard, "", 0))
-
-	return service, fake
+	return ids
 }
 
 func TestListOldPipelines(t *testing.T) {
-	project := "group/project"
+	fake := gitlabtest.New()
+	project := fake.AddProject("group", "project")
 	oldCreated := time.Now().AddDate(-3, 0, 0).UTC()
 	newCreated := time.Now().AddDate(-1, 0, 0).UTC()
 
-	pipelines := []pipelineResponse{
-		{
-			ID:        101,
-			IID:       1,
-			ProjectID: 999,
-			Status:    "success",
-			Source:    "push",
-			Ref:       "main",
-			SHA:       "abc123",
-			WebURL:    "https://example.com",
-			CreatedAt: &oldCreated,
-			UpdatedAt: &oldCreated,
-		},
-		{
-			ID:        202,
-			IID:       2,
-			ProjectID: 999,
-			Status:    "failed",
-			Source:    "web",
-			Ref:       "feature",
-			SHA:       "def456",
-			WebURL:    "https://example.com/newer",
-			CreatedAt: &newCreated,
-			UpdatedAt: &newCreated,
-		},
-	}
-
-	service, fake := setupPipelineService(t, project, pipelines, nil)
+	fake.AddPipeline(project.ID, gitlabclient.PipelineInfo{
+		ID:        101,
+		Status:    "success",
+		Source:    "push",
+		Ref:       "main",
+		SHA:       "abc123",
+		CreatedAt: &oldCreated,
+	})
+	fake.AddPipeline(project.ID, gitlabclient.PipelineInfo{
+		ID:        202,
+		Status:    "failed",
+		Source:    "web",
+		Ref:       "feature",
+		SHA:       "def456",
+		CreatedAt: &newCreated,
+	})
+
+	service := newGitLabTestService(t, fake)
 
 	cutoff := time.Now().UTC().AddDate(-2, 0, 0)
-	result, err := service.ListOldPipelines(context.Background(), project, cutoff)
+	result, truncated, err := service.ListOldPipelines(context.Background(), "group/project", PipelineFilter{CreatedBefore: cutoff}, 0)
 	if err != nil {
-		fake.mu.Lock()
-		path := fake.lastPath
-		fake.mu.Unlock()
-		t.Fatalf("ListOldPipelines returned error: %v (path: %s)", err, path)
+		t.Fatalf("ListOldPipelines returned error: %v", err)
+	}
+
+	if truncated {
+		t.Error("expected listing without max_results not to be truncated")
 	}
 
 	if len(result) != 1 {
@@ -184,42 +98,138 @@ func TestListOldPipelines(t *testing.T) {
 		t.Errorf("expected AgeYears >= 2.0, got %.2f", p.AgeYears)
 	}
 
-	fake.mu.Lock()
-	createdBefore := fake.lastQuery.Get("created_before")
-	fake.mu.Unlock()
-	if createdBefore == "" {
+	if lastPipelineQuery(t, fake).Get("created_before") == "" {
 		t.Error("expected created_before query parameter to be set")
 	}
 }
 
-func TestDeleteOldPipelines(t *testing.T) {
-	project := "group/project"
-	created := time.Now().AddDate(-5, 0, 0).UTC()
+func TestListOldPipelinesWithinWindow(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("group", "project")
+	ancient := time.Now().AddDate(-6, 0, 0).UTC()
+	old := time.Now().AddDate(-3, 0, 0).UTC()
+
+	fake.AddPipeline(project.ID, gitlabclient.PipelineInfo{ID: 1001, Status: "success", CreatedAt: &ancient})
+	fake.AddPipeline(project.ID, gitlabclient.PipelineInfo{ID: 1002, Status: "success", CreatedAt: &old})
+
+	service := newGitLabTestService(t, fake)
 
-	pipelines := []pipelineResponse{
+	filter := PipelineFilter{
+		CreatedBefore: time.Now().UTC().AddDate(-2, 0, 0),
+		CreatedAfter:  time.Now().UTC().AddDate(-5, 0, 0),
+	}
+	result, _, err := service.ListOldPipelines(context.Background(), "group/project", filter, 0)
+	if err != nil {
+		t.Fatalf("ListOldPipelines returned error: %v", err)
+	}
+
+	if len(result) != 1 || result[0].ID != 1002 {
+		t.Fatalf("expected only pipeline 1002 inside the window, got %#v", result)
+	}
+
+	if lastPipelineQuery(t, fake).Get("created_after") == "" {
+		t.Error("expected created_after query parameter to be set")
+	}
+}
+
+func TestListOldPipelinesFilters(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	fake.AddBranch(project.ID, "feature/live")
+	fake.AddTag(project.ID, "v1.0")
+	merged := fake.AddMergeRequest(project.ID, gitlabclient.MergeRequest{BasicMergeRequest: gitlabclient.BasicMergeRequest{SourceBranch: "feature/gone", State: "merged"}})
+	open := fake.AddMergeRequest(project.ID, gitlabclient.MergeRequest{BasicMergeRequest: gitlabclient.BasicMergeRequest{SourceBranch: "feature/live"}})
+
+	created := time.Now().AddDate(-1, 0, 0)
+	add := func(status, source, ref string) int {
+		return fake.AddPipeline(project.ID, gitlabclient.PipelineInfo{Status: status, Source: source, Ref: ref, CreatedAt: &created}).ID
+	}
+	mainPipeline := add("success", "push", "main")
+	gonePipeline := add("failed", "push", "feature/gone")
+	livePipeline := add("failed", "push", "feature/live")
+	tagPipeline := add("success", "push", "v1.0")
+	mergedMR := add("failed", "merge_request_event", fmt.Sprintf("refs/merge-requests/%d/head", merged.IID))
+	openMR := add("failed", "merge_request_event", fmt.Sprintf("refs/merge-requests/%d/head", open.IID))
+	canceledMR := add("canceled", "merge_request_event", "refs/merge-requests/99/merge")
+	fake.SetPipelineUser(livePipeline, "alice")
+
+	service := newGitLabTestService(t, fake)
+	cutoff := time.Now()
+
+	tests := []struct {
+		name   string
+		filter PipelineFilter
+		want   []int
+	}{
+		{name: "statuses", filter: PipelineFilter{Statuses: []string{"canceled", "success"}}, want: []int{mainPipeline, tagPipeline, canceledMR}},
+		{name: "source", filter: PipelineFilter{Sources: []string{"merge_request_event"}, Statuses: []string{"failed"}}, want: []int{mergedMR, openMR}},
+		{name: "ref glob", filter: PipelineFilter{Refs: []string{"feature/*", "v?.0"}}, want: []int{gonePipeline, livePipeline, tagPipeline}},
+		{name: "literal ref", filter: PipelineFilter{Refs: []string{"main"}}, want: []int{mainPipeline}},
+		{name: "username", filter: PipelineFilter{Username: "alice"}, want: []int{livePipeline}},
+		{name: "ref deleted", filter: PipelineFilter{RefDeleted: true}, want: []int{gonePipeline, mergedMR, canceledMR}},
 		{
-			ID:        321,
-			IID:       3,
-			ProjectID: 42,
-			Status:    "success",
-			Source:    "push",
-			Ref:       "main",
-			SHA:       "deadbeef",
-			WebURL:    "https://example.com/old",
-			CreatedAt: &created,
-			UpdatedAt: &created,
+			name:   "failed merge request pipelines on deleted branches",
+			filter: PipelineFilter{Statuses: []string{"failed"}, Sources: []string{"merge_request_event"}, RefDeleted: true},
+			want:   []int{mergedMR},
 		},
 	}
 
-	service, fake := setupPipelineService(t, project, pipelines, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.CreatedBefore = cutoff
+
+			pipelines, _, err := service.ListOldPipelines(context.Background(), "acme/api", tt.filter, 0)
+			if err != nil {
+				t.Fatalf("ListOldPipelines returned error: %v", err)
+			}
+
+			var got []int
+			for _, pipeline := range pipelines {
+				got = append(got, pipeline.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("expected pipelines %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPipelineFilterValidate(t *testing.T) {
+	if err := (PipelineFilter{Statuses: []string{"failed"}, Sources: []string{"schedule"}, Refs: []string{"main"}}).Validate(); err != nil {
+		t.Fatalf("expected a valid filter, got %v", err)
+	}
+
+	for _, filter := range []PipelineFilter{
+		{Statuses: []string{"broken"}},
+		{Sources: []string{"cron"}},
+		{Refs: []string{" "}},
+	} {
+		if err := filter.Validate(); err == nil {
+			t.Errorf("expected %#v to be rejected", filter)
+		}
+	}
+}
+
+func TestDeleteOldPipelines(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("group", "project")
+	created := time.Now().AddDate(-5, 0, 0).UTC()
+
+	fake.AddPipeline(project.ID, gitlabclient.PipelineInfo{
+		ID:        321,
+		Status:    "success",
+		Source:    "push",
+		Ref:       "main",
+		SHA:       "deadbeef",
+		CreatedAt: &created,
+	})
+
+	service := newGitLabTestService(t, fake)
 
 	cutoff := time.Now().UTC().AddDate(-2, 0, 0)
-	summary, err := service.DeleteOldPipelines(context.Background(), project, cutoff)
+	summary, err := service.DeleteOldPipelines(context.Background(), "group/project", PipelineFilter{CreatedBefore: cutoff}, RetentionPolicy{}, nil)
 	if err != nil {
-		fake.mu.Lock()
-		path := fake.lastPath
-		fake.mu.Unlock()
-		t.Fatalf("DeleteOldPipelines returned error: %v (path: %s)", err, path)
+		t.Fatalf("DeleteOldPipelines returned error: %v", err)
 	}
 
 	if summary.TotalCandidates != 1 {
@@ -234,13 +244,146 @@ func TestDeleteOldPipelines(t *testing.T) {
 		t.Fatalf("expected no failed deletions, got %#v", summary.Failed)
 	}
 
-	fake.mu.Lock()
-	deleteCalls := append([]int(nil), fake.deleteCalls...)
-	fake.mu.Unlock()
-
-	if len(deleteCalls) != 1 || deleteCalls[0] != 321 {
+	if deleteCalls := pipelineDeletes(fake); len(deleteCalls) != 1 || deleteCalls[0] != 321 {
 		t.Fatalf("expected delete call for pipeline 321, got %v", deleteCalls)
 	}
+	if remaining := fake.Pipelines(project.ID); len(remaining) != 0 {
+		t.Fatalf("expected pipeline 321 to be gone, got %#v", remaining)
+	}
+}
+
+func TestDeleteOldPipelinesRetriesServerErrors(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("group", "project")
+	created := time.Now().AddDate(-5, 0, 0).UTC()
+
+	fake.AddPipeline(project.ID, gitlabclient.PipelineInfo{ID: 1001, Status: "success", CreatedAt: &created})
+	fake.AddPipeline(project.ID, gitlabclient.PipelineInfo{ID: 1002, Status: "failed", CreatedAt: &created})
+	fake.InjectFault(gitlabtest.Fault{Method: http.MethodDelete, Path: "/projects/group/project/pipelines/1002", Status: http.StatusInternalServerError})
+
+	service := newGitLabTestService(t, fake, WithDeletionRetries(2, time.Millisecond))
+
+	summary, err := service.DeleteOldPipelines(context.Background(), "group/project", PipelineFilter{CreatedBefore: time.Now().UTC().AddDate(-2, 0, 0)}, RetentionPolicy{}, nil)
+	if err != nil {
+		t.Fatalf("DeleteOldPipelines returned error: %v", err)
+	}
+
+	if !slices.Equal(summary.DeletedIDs, []int{1001}) {
+		t.Fatalf("expected pipeline 1001 to be deleted, got %v", summary.DeletedIDs)
+	}
+	if len(summary.Failed) != 1 || summary.Failed[0].PipelineID != 1002 || summary.Failed[0].Attempts != 3 {
+		t.Fatalf("expected pipeline 1002 to fail after 3 attempts, got %#v", summary.Failed)
+	}
+
+	calls := pipelineDeletes(fake)
+	slices.Sort(calls)
+	if want := []int{1001, 1002, 1002, 1002}; !slices.Equal(calls, want) {
+		t.Fatalf("expected delete calls %v, got %v", want, calls)
+	}
+}
+
+func TestDeletePipelinesSkipsPipelinesThatNoLongerMatch(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	ids := addOldPipelines(fake, project.ID, 3)
+	recent := time.Now().Add(-time.Hour)
+	newer := fake.AddPipeline(project.ID, gitlabclient.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &recent}).ID
+
+	service := newGitLabTestService(t, fake)
+	client, err := fake.NewClient(gitlabclient.WithoutRetries())
+	if err != nil {
+		t.Fatalf("create gitlabtest client: %v", err)
+	}
+	// Someone else deletes a planned pipeline before the plan is applied.
+	if _, err := client.Pipelines.DeletePipeline(project.ID, ids[1]); err != nil {
+		t.Fatalf("DeletePipeline: %v", err)
+	}
+
+	planned := []int{ids[0], ids[1], newer, ids[2]}
+	summary, err := service.DeletePipelines(context.Background(), "acme/api", oldPipelines, RetentionPolicy{}, planned, nil, nil)
+	if err != nil {
+		t.Fatalf("DeletePipelines returned error: %v", err)
+	}
+
+	if !slices.Equal(summary.DeletedIDs, []int{ids[0], ids[2]}) {
+		t.Fatalf("expected only the pipelines still matching to be deleted, got %v", summary.DeletedIDs)
+	}
+	if !slices.Equal(summary.SkippedIDs, []int{ids[1], newer}) || len(summary.Failed) != 0 || summary.TotalCandidates != 4 {
+		t.Fatalf("expected the gone and the recent pipeline to be skipped, got %#v", summary)
+	}
+	if remaining := fake.Pipelines(project.ID); len(remaining) != 1 || remaining[0].ID != newer {
+		t.Fatalf("expected the recent pipeline to survive, got %#v", remaining)
+	}
+}
+
+func TestDeletePipelinesSkipsPipelinesRetentionNowKeeps(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	ids := addOldPipelines(fake, project.ID, 3)
+	recent := time.Now().Add(-time.Hour)
+	latest := fake.AddPipeline(project.ID, gitlabclient.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &recent}).ID
+
+	service := newGitLabTestService(t, fake)
+	policy := RetentionPolicy{KeepLatestPerRef: 1}
+
+	cleanup, err := service.PlanPipelineCleanup(context.Background(), "acme/api", oldPipelines, policy, 0)
+	if err != nil {
+		t.Fatalf("PlanPipelineCleanup returned error: %v", err)
+	}
+	if len(cleanup.Delete) != len(ids) {
+		t.Fatalf("expected every old pipeline to be planned while a newer one exists, got %#v", cleanup.Delete)
+	}
+
+	// The newest pipeline goes away, so the last old one becomes the latest of main.
+	client, err := fake.NewClient(gitlabclient.WithoutRetries())
+	if err != nil {
+		t.Fatalf("create gitlabtest client: %v", err)
+	}
+	if _, err := client.Pipelines.DeletePipeline(project.ID, latest); err != nil {
+		t.Fatalf("DeletePipeline: %v", err)
+	}
+
+	summary, err := service.DeletePipelines(context.Background(), "acme/api", oldPipelines, policy, ids, nil, nil)
+	if err != nil {
+		t.Fatalf("DeletePipelines returned error: %v", err)
+	}
+
+	if !slices.Equal(summary.DeletedIDs, ids[:2]) || !slices.Equal(summary.SkippedIDs, ids[2:]) {
+		t.Fatalf("expected the pipeline retention now keeps to be skipped, got %#v", summary)
+	}
+	if remaining := fake.Pipelines(project.ID); len(remaining) != 1 || remaining[0].ID != ids[2] {
+		t.Fatalf("expected the new latest pipeline of main to survive, got %#v", remaining)
+	}
+}
+
+func TestDeleteOldPipelinesReportsProgress(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	ids := addOldPipelines(fake, project.ID, 3)
+	fake.InjectFault(gitlabtest.Fault{Method: http.MethodDelete, Path: fmt.Sprintf("/projects/acme/api/pipelines/%d", ids[1]), Status: http.StatusForbidden})
+
+	service := newGitLabTestService(t, fake)
+
+	var updates []Progress
+	_, err := service.DeleteOldPipelines(context.Background(), "acme/api", PipelineFilter{CreatedBefore: time.Now().AddDate(-1, 0, 0)}, RetentionPolicy{}, func(progress Progress) {
+		updates = append(updates, progress)
+	})
+	if err != nil {
+		t.Fatalf("DeleteOldPipelines returned error: %v", err)
+	}
+
+	// Deletions run in parallel, so only the count of finished pipelines is predictable.
+	if len(updates) != 4 {
+		t.Fatalf("expected 4 updates, got %#v", updates)
+	}
+	for i, update := range updates {
+		if update.Completed != i || update.Total != 3 || update.Failed > update.Completed {
+			t.Fatalf("update %d: expected %d of 3 pipelines done, got %#v", i, i, update)
+		}
+	}
+	if last := updates[len(updates)-1]; last.Failed != 1 {
+		t.Fatalf("expected the final update to count 1 failure, got %#v", last)
+	}
 }
 
 func TestPipelineAge(t *testing.T) {
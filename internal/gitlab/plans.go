@@ -0,0 +1,313 @@
+package gitlab
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPlanTTL is how long a pipeline deletion plan can be applied after it was created.
+const DefaultPlanTTL = 15 * time.Minute
+
+var (
+	// ErrPlanNotFound is returned for plan IDs that were never issued, were already applied or
+	// belong to another owner.
+	ErrPlanNotFound = errors.New("deletion plan not found")
+	// ErrPlanExpired is returned for plans applied after their expiry.
+	ErrPlanExpired = errors.New("deletion plan expired")
+	// ErrPlanChecksumMismatch is returned when the checksum supplied with a plan ID does not match the plan.
+	ErrPlanChecksumMismatch = errors.New("deletion plan checksum mismatch")
+)
+
+// PipelinePlan is a reviewed set of pipelines that a later deletion applies exactly.
+type PipelinePlan struct {
+	ID string `json:"plan_id"`
+	// Owner identifies the caller that created the plan; only the same caller can apply it.
+	Owner       string          `json:"-"`
+	Project     string          `json:"project"`
+	Filter      PipelineFilter  `json:"filter"`
+	Retention   RetentionPolicy `json:"retention,omitempty"`
+	PipelineIDs []int           `json:"pipeline_ids"`
+	Checksum    string          `json:"checksum"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+}
+
+// ProjectPipelineIDs lists the pipelines of one project in a group deletion plan.
+type ProjectPipelineIDs struct {
+	Project     string `json:"project"`
+	PipelineIDs []int  `json:"pipeline_ids"`
+}
+
+// GroupPipelinePlan is a reviewed set of pipelines across the projects of a group that a later
+// deletion applies exactly.
+type GroupPipelinePlan struct {
+	ID string `json:"plan_id"`
+	// Owner identifies the caller that created the plan; only the same caller can apply it.
+	Owner     string               `json:"-"`
+	Group     string               `json:"group"`
+	Filter    PipelineFilter       `json:"filter"`
+	Retention RetentionPolicy      `json:"retention,omitempty"`
+	Projects  []ProjectPipelineIDs `json:"projects"`
+	Checksum  string               `json:"checksum"`
+	CreatedAt time.Time            `json:"created_at"`
+	ExpiresAt time.Time            `json:"expires_at"`
+}
+
+// PipelineCount returns the number of pipelines the plan deletes across all of its projects.
+func (p GroupPipelinePlan) PipelineCount() int {
+	count := 0
+	for _, project := range p.Projects {
+		count += len(project.PipelineIDs)
+	}
+	return count
+}
+
+// storedPlan is implemented by the plan types a PlanStore keeps.
+type storedPlan interface {
+	owner() string
+	expiry() time.Time
+	digest() string
+}
+
+func (p PipelinePlan) owner() string          { return p.Owner }
+func (p PipelinePlan) expiry() time.Time      { return p.ExpiresAt }
+func (p PipelinePlan) digest() string         { return p.Checksum }
+func (p GroupPipelinePlan) owner() string     { return p.Owner }
+func (p GroupPipelinePlan) expiry() time.Time { return p.ExpiresAt }
+func (p GroupPipelinePlan) digest() string    { return p.Checksum }
+
+// PlanStore keeps pipeline deletion plans in memory until they are applied or expire. Each plan
+// belongs to the owner that created it, such as a caller's token or MCP session, and is invisible
+// to every other owner. It is safe for concurrent use.
+type PlanStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu     sync.Mutex
+	plans  map[string]PipelinePlan
+	groups map[string]GroupPipelinePlan
+}
+
+// NewPlanStore returns a PlanStore whose plans expire ttl after creation. Non-positive values
+// fall back to DefaultPlanTTL.
+func NewPlanStore(ttl time.Duration) *PlanStore {
+	if ttl <= 0 {
+		ttl = DefaultPlanTTL
+	}
+
+	return &PlanStore{
+		ttl:    ttl,
+		now:    time.Now,
+		plans:  map[string]PipelinePlan{},
+		groups: map[string]GroupPipelinePlan{},
+	}
+}
+
+// Create records a plan for owner to delete pipelineIDs, selected from project with filter and
+// policy, and returns it.
+func (p *PlanStore) Create(owner, project string, filter PipelineFilter, policy RetentionPolicy, pipelineIDs []int) (PipelinePlan, error) {
+	id, err := newPlanID("plan_")
+	if err != nil {
+		return PipelinePlan{}, err
+	}
+
+	now := p.now().UTC()
+	plan := PipelinePlan{
+		ID:          id,
+		Owner:       owner,
+		Project:     project,
+		Filter:      filter,
+		Retention:   policy,
+		PipelineIDs: slices.Clone(pipelineIDs),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(p.ttl),
+	}
+	plan.Checksum = PlanChecksum(plan.Project, plan.PipelineIDs)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pruneExpired(p.plans, now)
+	p.plans[plan.ID] = plan
+
+	return plan, nil
+}
+
+// CreateGroup records a plan for owner to delete the pipelines listed per project, selected from
+// the projects of group with filter and policy, and returns it. Projects without pipelines are
+// left out.
+func (p *PlanStore) CreateGroup(owner, group string, filter PipelineFilter, policy RetentionPolicy, projects []ProjectPipelineIDs) (GroupPipelinePlan, error) {
+	id, err := newPlanID("group_plan_")
+	if err != nil {
+		return GroupPipelinePlan{}, err
+	}
+
+	now := p.now().UTC()
+	plan := GroupPipelinePlan{
+		ID:        id,
+		Owner:     owner,
+		Group:     group,
+		Filter:    filter,
+		Retention: policy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(p.ttl),
+	}
+	for _, project := range projects {
+		if len(project.PipelineIDs) > 0 {
+			plan.Projects = append(plan.Projects, ProjectPipelineIDs{
+				Project:     project.Project,
+				PipelineIDs: slices.Clone(project.PipelineIDs),
+			})
+		}
+	}
+	plan.Checksum = GroupPlanChecksum(plan.Group, plan.Projects)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pruneExpired(p.groups, now)
+	p.groups[plan.ID] = plan
+
+	return plan, nil
+}
+
+// Get returns owner's plan with the given ID without consuming it. When checksum is non-empty it
+// must match the plan's checksum.
+func (p *PlanStore) Get(owner, id, checksum string) (PipelinePlan, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return lookupPlan(p.plans, owner, id, checksum, p.now())
+}
+
+// Take returns owner's plan with the given ID and removes it so it cannot be applied twice. When
+// checksum is non-empty it must match the plan's checksum.
+func (p *PlanStore) Take(owner, id, checksum string) (PipelinePlan, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return takePlan(p.plans, owner, id, checksum, p.now())
+}
+
+// GetGroup returns owner's group plan with the given ID without consuming it. When checksum is
+// non-empty it must match the plan's checksum.
+func (p *PlanStore) GetGroup(owner, id, checksum string) (GroupPipelinePlan, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return lookupPlan(p.groups, owner, id, checksum, p.now())
+}
+
+// TakeGroup returns owner's group plan with the given ID and removes it so it cannot be applied
+// twice. When checksum is non-empty it must match the plan's checksum.
+func (p *PlanStore) TakeGroup(owner, id, checksum string) (GroupPipelinePlan, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return takePlan(p.groups, owner, id, checksum, p.now())
+}
+
+// Target returns the project or group and the pipeline IDs of owner's plan with the given ID,
+// including a plan that has expired but was not yet discarded. It reports false when owner has
+// no such plan.
+func (p *PlanStore) Target(owner, id string) (string, []int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if plan, ok := p.plans[id]; ok && plan.Owner == owner {
+		return plan.Project, slices.Clone(plan.PipelineIDs), true
+	}
+	if plan, ok := p.groups[id]; ok && plan.Owner == owner {
+		var ids []int
+		for _, project := range plan.Projects {
+			ids = append(ids, project.PipelineIDs...)
+		}
+		return plan.Group, ids, true
+	}
+
+	return "", nil, false
+}
+
+func takePlan[P storedPlan](plans map[string]P, owner, id, checksum string, now time.Time) (P, error) {
+	plan, err := lookupPlan(plans, owner, id, checksum, now)
+	if err != nil {
+		return plan, err
+	}
+	delete(plans, id)
+
+	return plan, nil
+}
+
+func lookupPlan[P storedPlan](plans map[string]P, owner, id, checksum string, now time.Time) (P, error) {
+	var zero P
+
+	// Plans of other owners are reported as missing so their IDs reveal nothing.
+	plan, ok := plans[id]
+	if !ok || plan.owner() != owner {
+		return zero, fmt.Errorf("%w: %s", ErrPlanNotFound, id)
+	}
+
+	if !now.Before(plan.expiry()) {
+		delete(plans, id)
+		return zero, fmt.Errorf("%w: %s expired at %s", ErrPlanExpired, id, plan.expiry().Format(time.RFC3339))
+	}
+
+	if checksum != "" && checksum != plan.digest() {
+		return zero, fmt.Errorf("%w: %s", ErrPlanChecksumMismatch, id)
+	}
+
+	return plan, nil
+}
+
+func pruneExpired[P storedPlan](plans map[string]P, now time.Time) {
+	for id, plan := range plans {
+		if !now.Before(plan.expiry()) {
+			delete(plans, id)
+		}
+	}
+}
+
+// PlanChecksum returns a digest identifying the set of pipelines planned for deletion in project.
+// The order of pipelineIDs does not affect the result.
+func PlanChecksum(project string, pipelineIDs []int) string {
+	sorted := slices.Clone(pipelineIDs)
+	slices.Sort(sorted)
+
+	ids := make([]string, len(sorted))
+	for i, id := range sorted {
+		ids[i] = strconv.Itoa(id)
+	}
+
+	sum := sha256.Sum256([]byte(project + "\n" + strings.Join(ids, ",")))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// GroupPlanChecksum returns a digest identifying the pipelines planned for deletion across the
+// projects of group. The order of projects and of their pipeline IDs does not affect the result.
+func GroupPlanChecksum(group string, projects []ProjectPipelineIDs) string {
+	sums := make([]string, 0, len(projects))
+	for _, project := range projects {
+		sums = append(sums, PlanChecksum(project.Project, project.PipelineIDs))
+	}
+	slices.Sort(sums)
+
+	sum := sha256.Sum256([]byte(group + "\n" + strings.Join(sums, "\n")))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func newPlanID(prefix string) (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("generate plan id: %w", err)
+	}
+
+	return prefix + hex.EncodeToString(buf[:]), nil
+}
@@ -0,0 +1,138 @@
+package gitlab
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPlanStoreTakeAppliesPlanOnce(t *testing.T) {
+	store := NewPlanStore(time.Hour)
+
+	plan, err := store.Create("session-1", "acme/api", PipelineFilter{CreatedBefore: time.Now()}, RetentionPolicy{}, []int{3, 1, 2})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	if plan.Checksum != PlanChecksum("acme/api", []int{1, 2, 3}) {
+		t.Errorf("expected checksum to ignore pipeline order, got %s", plan.Checksum)
+	}
+	if plan.Checksum == PlanChecksum("acme/web", []int{1, 2, 3}) {
+		t.Error("expected checksum to depend on the project")
+	}
+
+	if _, err := store.Get("session-1", plan.ID, plan.Checksum); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+
+	taken, err := store.Take("session-1", plan.ID, "")
+	if err != nil {
+		t.Fatalf("Take returned error: %v", err)
+	}
+	if len(taken.PipelineIDs) != 3 || taken.PipelineIDs[0] != 3 {
+		t.Fatalf("expected planned pipelines in listing order, got %v", taken.PipelineIDs)
+	}
+
+	if _, err := store.Take("session-1", plan.ID, ""); !errors.Is(err, ErrPlanNotFound) {
+		t.Fatalf("expected second Take to fail with ErrPlanNotFound, got %v", err)
+	}
+}
+
+func TestPlanStoreRejectsStalePlans(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewPlanStore(10 * time.Minute)
+	store.now = func() time.Time { return now }
+
+	plan, err := store.Create("session-1", "acme/api", PipelineFilter{CreatedBefore: now}, RetentionPolicy{}, []int{1})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	if _, err := store.Get("session-1", plan.ID, "sha256:other"); !errors.Is(err, ErrPlanChecksumMismatch) {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if _, err := store.Take("session-1", plan.ID, ""); !errors.Is(err, ErrPlanExpired) {
+		t.Fatalf("expected expired plan, got %v", err)
+	}
+	if _, err := store.Take("session-1", plan.ID, ""); !errors.Is(err, ErrPlanNotFound) {
+		t.Fatalf("expected expired plan to be discarded, got %v", err)
+	}
+}
+
+func TestPlanStoreKeepsPlansToTheirOwner(t *testing.T) {
+	store := NewPlanStore(time.Hour)
+
+	plan, err := store.Create("session-1", "acme/api", PipelineFilter{CreatedBefore: time.Now()}, RetentionPolicy{}, []int{1})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	group, err := store.CreateGroup("session-1", "acme", PipelineFilter{CreatedBefore: time.Now()}, RetentionPolicy{}, []ProjectPipelineIDs{
+		{Project: "acme/api", PipelineIDs: []int{1}},
+	})
+	if err != nil {
+		t.Fatalf("CreateGroup returned error: %v", err)
+	}
+
+	if _, err := store.Get("session-2", plan.ID, plan.Checksum); !errors.Is(err, ErrPlanNotFound) {
+		t.Fatalf("expected another owner not to see the plan, got %v", err)
+	}
+	if _, err := store.Take("session-2", plan.ID, ""); !errors.Is(err, ErrPlanNotFound) {
+		t.Fatalf("expected another owner not to take the plan, got %v", err)
+	}
+	if _, err := store.TakeGroup("session-2", group.ID, ""); !errors.Is(err, ErrPlanNotFound) {
+		t.Fatalf("expected another owner not to take the group plan, got %v", err)
+	}
+
+	if _, _, ok := store.Target("session-2", plan.ID); ok {
+		t.Fatal("expected another owner not to see the plan's target")
+	}
+	if target, ids, ok := store.Target("session-1", group.ID); !ok || target != "acme" || len(ids) != 1 {
+		t.Fatalf("expected the owner to see the group plan's target, got %q %v %v", target, ids, ok)
+	}
+
+	if _, err := store.Take("session-1", plan.ID, ""); err != nil {
+		t.Fatalf("expected the owner to take the plan, got %v", err)
+	}
+	if _, err := store.TakeGroup("session-1", group.ID, ""); err != nil {
+		t.Fatalf("expected the owner to take the group plan, got %v", err)
+	}
+}
+
+func TestPlanStoreGroupPlans(t *testing.T) {
+	store := NewPlanStore(time.Hour)
+
+	plan, err := store.CreateGroup("session-1", "acme", PipelineFilter{CreatedBefore: time.Now()}, RetentionPolicy{}, []ProjectPipelineIDs{
+		{Project: "acme/api", PipelineIDs: []int{2, 1}},
+		{Project: "acme/empty"},
+		{Project: "acme/web", PipelineIDs: []int{7}},
+	})
+	if err != nil {
+		t.Fatalf("CreateGroup returned error: %v", err)
+	}
+
+	if len(plan.Projects) != 2 || plan.PipelineCount() != 3 {
+		t.Fatalf("expected projects without pipelines to be dropped, got %#v", plan.Projects)
+	}
+	reordered := GroupPlanChecksum("acme", []ProjectPipelineIDs{
+		{Project: "acme/web", PipelineIDs: []int{7}},
+		{Project: "acme/api", PipelineIDs: []int{1, 2}},
+	})
+	if plan.Checksum != reordered {
+		t.Errorf("expected checksum to ignore project and pipeline order, got %s", plan.Checksum)
+	}
+
+	if _, err := store.Get("session-1", plan.ID, ""); !errors.Is(err, ErrPlanNotFound) {
+		t.Fatalf("expected a group plan not to be applied as a project plan, got %v", err)
+	}
+	if _, err := store.GetGroup("session-1", plan.ID, "sha256:other"); !errors.Is(err, ErrPlanChecksumMismatch) {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	if _, err := store.TakeGroup("session-1", plan.ID, plan.Checksum); err != nil {
+		t.Fatalf("TakeGroup returned error: %v", err)
+	}
+	if _, err := store.TakeGroup("session-1", plan.ID, ""); !errors.Is(err, ErrPlanNotFound) {
+		t.Fatalf("expected second TakeGroup to fail with ErrPlanNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// RetentionPolicy protects pipelines from a cleanup whatever their age. The zero value keeps
+// nothing.
+type RetentionPolicy struct {
+	// KeepLatestPerRef keeps the N most recent pipelines of every ref. Pipelines of any age
+	// count, so a dormant branch keeps its last pipelines. Zero disables the rule.
+	KeepLatestPerRef int `json:"keep_latest_per_ref,omitempty"`
+	// KeepLatestSuccessful keeps the most recent successful pipeline on the default branch and on
+	// every tag.
+	KeepLatestSuccessful bool `json:"keep_latest_successful,omitempty"`
+	// KeepDeployments keeps pipelines that deployed to an environment.
+	KeepDeployments bool `json:"keep_deployments,omitempty"`
+}
+
+// IsZero reports whether the policy keeps nothing.
+func (p RetentionPolicy) IsZero() bool {
+	return p == RetentionPolicy{}
+}
+
+// RetentionDecision is a retention policy's verdict on one pipeline.
+type RetentionDecision struct {
+	PipelineSummary
+	Keep bool `json:"keep"`
+	// Reasons names every rule that keeps the pipeline, or says why it can be deleted.
+	Reasons []string `json:"reasons"`
+}
+
+// PipelineCleanup splits the pipelines matching a filter into those to delete and those a
+// retention policy keeps.
+type PipelineCleanup struct {
+	Delete []PipelineSummary
+	Kept   []RetentionDecision
+	// Truncated reports that the listing stopped at maxResults candidates.
+	Truncated bool
+}
+
+// PlanPipelineCleanup lists the pipelines of the project that match filter, at most maxResults
+// when positive, and applies policy to them.
+func (s *Service) PlanPipelineCleanup(ctx context.Context, projectIDOrPath string, filter PipelineFilter, policy RetentionPolicy, maxResults int) (*PipelineCleanup, error) {
+	candidates, truncated, err := s.ListOldPipelines(ctx, projectIDOrPath, filter, maxResults)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions, err := s.EvaluateRetention(ctx, projectIDOrPath, policy, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	cleanup := &PipelineCleanup{Truncated: truncated}
+	for _, decision := range decisions {
+		if decision.Keep {
+			cleanup.Kept = append(cleanup.Kept, decision)
+		} else {
+			cleanup.Delete = append(cleanup.Delete, decision.PipelineSummary)
+		}
+	}
+
+	return cleanup, nil
+}
+
+// EvaluateRetention decides for each candidate pipeline of the project whether policy keeps it,
+// returning the decisions in the order of candidates. Rules look beyond the candidates: the most
+// recent pipelines of a ref are found among all of its pipelines, not just the old ones.
+func (s *Service) EvaluateRetention(ctx context.Context, projectIDOrPath string, policy RetentionPolicy, candidates []PipelineSummary) ([]RetentionDecision, error) {
+	reasons := map[int][]string{}
+
+	var refs []string
+	for _, pipeline := range candidates {
+		if !slices.Contains(refs, pipeline.Ref) {
+			refs = append(refs, pipeline.Ref)
+		}
+	}
+
+	if n := policy.KeepLatestPerRef; n > 0 {
+		for _, ref := range refs {
+			latest, err := s.latestPipelineIDs(ctx, projectIDOrPath, ref, "", n)
+			if err != nil {
+				return nil, err
+			}
+
+			reason := fmt.Sprintf("one of the %d most recent pipelines on %s", n, ref)
+			if n == 1 {
+				reason = "the most recent pipeline on " + ref
+			}
+			for _, id := range latest {
+				reasons[id] = append(reasons[id], reason)
+			}
+		}
+	}
+
+	if policy.KeepLatestSuccessful && len(refs) > 0 {
+		project, err := s.GetProject(ctx, projectIDOrPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range refs {
+			// Only a successful candidate can be the latest successful pipeline.
+			if !slices.ContainsFunc(candidates, func(p PipelineSummary) bool { return p.Ref == ref && p.Status == "success" }) {
+				continue
+			}
+
+			where := "the default branch " + ref
+			if ref != project.DefaultBranch {
+				isTag, err := s.tagExists(ctx, projectIDOrPath, ref)
+				if err != nil {
+					return nil, err
+				}
+				if !isTag {
+					continue
+				}
+				where = "tag " + ref
+			}
+
+			latest, err := s.latestPipelineIDs(ctx, projectIDOrPath, ref, "success", 1)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range latest {
+				reasons[id] = append(reasons[id], "the latest successful pipeline on "+where)
+			}
+		}
+	}
+
+	if policy.KeepDeployments && len(candidates) > 0 {
+		environments, err := s.deployedPipelines(ctx, projectIDOrPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for id, names := range environments {
+			reasons[id] = append(reasons[id], "deployed to "+strings.Join(names, ", "))
+		}
+	}
+
+	decisions := make([]RetentionDecision, 0, len(candidates))
+	for _, pipeline := range candidates {
+		decision := RetentionDecision{PipelineSummary: pipeline, Reasons: reasons[pipeline.ID]}
+		if decision.Keep = len(decision.Reasons) > 0; !decision.Keep {
+			decision.Reasons = []string{"no retention rule keeps it"}
+		}
+		decisions = append(decisions, decision)
+	}
+
+	return decisions, nil
+}
+
+// latestPipelineIDs returns the IDs of the n most recent pipelines on ref, optionally only those
+// with the given status.
+func (s *Service) latestPipelineIDs(ctx context.Context, projectIDOrPath string, ref string, status string, n int) ([]int, error) {
+	opts := &gitlab.ListProjectPipelinesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: min(n, listPageSize)},
+		Ref:         gitlab.Ptr(ref),
+		OrderBy:     gitlab.Ptr("id"),
+		Sort:        gitlab.Ptr("desc"),
+	}
+	if status != "" {
+		opts.Status = gitlab.Ptr(gitlab.BuildStateValue(status))
+	}
+
+	ids, _, err := collectPages(ctx, n, func(page int) ([]int, *gitlab.Response, error) {
+		opts.Page = page
+
+		pipelines, resp, err := s.api.Pipelines.ListProjectPipelines(projectIDOrPath, opts, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ids := make([]int, 0, len(pipelines))
+		for _, pipeline := range pipelines {
+			ids = append(ids, pipeline.ID)
+		}
+		return ids, resp, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list latest pipelines on %s: %w", ref, err)
+	}
+
+	return ids, nil
+}
+
+// deployedPipelines maps the ID of every pipeline that deployed in the project to the names of
+// the environments it deployed to.
+func (s *Service) deployedPipelines(ctx context.Context, projectIDOrPath string) (map[int][]string, error) {
+	opts := &gitlab.ListProjectDeploymentsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: listPageSize},
+	}
+
+	deployments, _, err := collectPages(ctx, 0, func(page int) ([]*gitlab.Deployment, *gitlab.Response, error) {
+		opts.Page = page
+		return s.api.Deployments.ListProjectDeployments(projectIDOrPath, opts, gitlab.WithContext(ctx))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list deployments: %w", err)
+	}
+
+	environments := map[int][]string{}
+	for _, deployment := range deployments {
+		if deployment == nil || deployment.Deployable.Pipeline.ID == 0 {
+			continue
+		}
+
+		id := deployment.Deployable.Pipeline.ID
+		name := "an environment"
+		if deployment.Environment != nil && deployment.Environment.Name != "" {
+			name = deployment.Environment.Name
+		}
+		if !slices.Contains(environments[id], name) {
+			environments[id] = append(environments[id], name)
+		}
+	}
+
+	return environments, nil
+}
@@ -0,0 +1,117 @@
+package gitlab
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	gitlabclient "gitlab.com/gitlab-org/api/client-go"
+
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab/gitlabtest"
+)
+
+func TestPlanPipelineCleanupRetention(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	fake.AddBranch(project.ID, "feature/dormant")
+	fake.AddTag(project.ID, "v1.0")
+
+	old := time.Now().AddDate(-2, 0, 0)
+	recent := time.Now().Add(-time.Hour)
+	add := func(status, ref string, created time.Time) int {
+		return fake.AddPipeline(project.ID, gitlabclient.PipelineInfo{Status: status, Ref: ref, CreatedAt: &created}).ID
+	}
+	deployedMain := add("success", "main", old)
+	failedMain := add("failed", "main", old)
+	latestSuccessMain := add("success", "main", old)
+	add("failed", "main", recent)
+	olderDormant := add("failed", "feature/dormant", old)
+	latestDormant := add("success", "feature/dormant", old)
+	olderTag := add("success", "v1.0", old)
+	latestTag := add("success", "v1.0", old)
+	fake.AddDeployment(project.ID, deployedMain, "production")
+
+	service := newGitLabTestService(t, fake)
+	filter := PipelineFilter{CreatedBefore: time.Now().AddDate(-1, 0, 0)}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		kept   []int
+	}{
+		{name: "no policy", policy: RetentionPolicy{}},
+		{name: "latest per ref", policy: RetentionPolicy{KeepLatestPerRef: 1}, kept: []int{latestDormant, latestTag}},
+		{name: "latest two per ref", policy: RetentionPolicy{KeepLatestPerRef: 2}, kept: []int{latestSuccessMain, olderDormant, latestDormant, olderTag, latestTag}},
+		{name: "latest successful", policy: RetentionPolicy{KeepLatestSuccessful: true}, kept: []int{latestSuccessMain, latestTag}},
+		{name: "deployments", policy: RetentionPolicy{KeepDeployments: true}, kept: []int{deployedMain}},
+		{
+			name:   "all rules",
+			policy: RetentionPolicy{KeepLatestPerRef: 1, KeepLatestSuccessful: true, KeepDeployments: true},
+			kept:   []int{deployedMain, latestSuccessMain, latestDormant, latestTag},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup, err := service.PlanPipelineCleanup(context.Background(), "acme/api", filter, tt.policy, 0)
+			if err != nil {
+				t.Fatalf("PlanPipelineCleanup returned error: %v", err)
+			}
+
+			var kept []int
+			for _, decision := range cleanup.Kept {
+				if !decision.Keep || len(decision.Reasons) == 0 {
+					t.Errorf("expected pipeline %d to be kept with a reason, got %#v", decision.ID, decision)
+				}
+				kept = append(kept, decision.ID)
+			}
+			slices.Sort(kept)
+			if !slices.Equal(kept, tt.kept) {
+				t.Fatalf("expected pipelines %v to be kept, got %v", tt.kept, kept)
+			}
+
+			if got := len(cleanup.Delete) + len(cleanup.Kept); got != 7 {
+				t.Fatalf("expected 7 old pipelines split between delete and kept, got %d", got)
+			}
+			for _, pipeline := range cleanup.Delete {
+				if slices.Contains(tt.kept, pipeline.ID) {
+					t.Fatalf("expected kept pipeline %d not to be deleted", pipeline.ID)
+				}
+			}
+			if tt.policy.IsZero() && !slices.ContainsFunc(cleanup.Delete, func(p PipelineSummary) bool { return p.ID == failedMain }) {
+				t.Fatalf("expected pipeline %d to be deleted without a policy", failedMain)
+			}
+		})
+	}
+}
+
+func TestEvaluateRetentionReasons(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+
+	created := time.Now().AddDate(-2, 0, 0)
+	pipeline := fake.AddPipeline(project.ID, gitlabclient.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &created})
+	fake.AddDeployment(project.ID, pipeline.ID, "staging")
+	fake.AddDeployment(project.ID, pipeline.ID, "production")
+	other := fake.AddPipeline(project.ID, gitlabclient.PipelineInfo{Status: "failed", Ref: "main", CreatedAt: &created})
+
+	service := newGitLabTestService(t, fake)
+	candidates := []PipelineSummary{{ID: pipeline.ID, Ref: "main", Status: "success"}, {ID: other.ID, Ref: "main", Status: "failed"}}
+
+	decisions, err := service.EvaluateRetention(context.Background(), "acme/api",
+		RetentionPolicy{KeepLatestPerRef: 1, KeepLatestSuccessful: true, KeepDeployments: true}, candidates)
+	if err != nil {
+		t.Fatalf("EvaluateRetention returned error: %v", err)
+	}
+
+	want := []string{"the latest successful pipeline on the default branch main", "deployed to staging, production"}
+	if !decisions[0].Keep || !slices.Equal(decisions[0].Reasons, want) {
+		t.Fatalf("expected pipeline %d to be kept because %q, got %#v", pipeline.ID, want, decisions[0])
+	}
+
+	want = []string{"the most recent pipeline on main"}
+	if !decisions[1].Keep || !slices.Equal(decisions[1].Reasons, want) {
+		t.Fatalf("expected pipeline %d to be kept because %q, got %#v", other.ID, want, decisions[1])
+	}
+}
@@ -2,158 +2,323 @@ package gitlab
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync"
+	"time"
 
 	gitlab "gitlab.com/gitlab-org/api/client-go"
 )
 
-// Service wraps a GitLab API client and exposes higher-level operations for MCP tools.
+// DefaultSubgroupConcurrency is the number of subgroups whose projects are fetched in parallel
+// when no explicit concurrency is configured.
+const DefaultSubgroupConcurrency = 8
+
+// DefaultProjectConcurrency is the number of projects a group-wide pipeline cleanup works on in
+// parallel when no explicit concurrency is configured.
+const DefaultProjectConcurrency = 4
+
+// Defaults for pipeline deletion, tuned with WithDeletionConcurrency, WithDeletionRateLimit and
+// WithDeletionRetries.
+const (
+	DefaultDeletionConcurrency = 4
+	DefaultDeletionRate        = 10
+	DefaultDeletionRetries     = 3
+	DefaultDeletionBackoff     = time.Second
+)
+
+// Service wraps the GitLab API backend and exposes higher-level operations for MCP tools.
 type Service struct {
-	client *gitlab.Client
-	log    *log.Logger
+	api                 Backend
+	log                 *slog.Logger
+	subgroupConcurrency int
+	projectConcurrency  int
+
+	deletionConcurrency int
+	deletionRate        float64
+	deletionRetries     int
+	deletionBackoff     time.Duration
+	deletions           *DeletionLimiter
+
+	// identityLookup lets one CachedIdentity caller at a time look the identity up.
+	identityLookup sync.Mutex
+	identityMu     sync.Mutex
+	identity       *Identity
+	identityAt     time.Time
+}
+
+// ServiceOption customises a Service created by NewService.
+type ServiceOption func(*Service)
+
+// WithSubgroupConcurrency bounds how many subgroups ListGroupProjectsAll queries in parallel.
+// Values below one fall back to DefaultSubgroupConcurrency.
+func WithSubgroupConcurrency(n int) ServiceOption {
+	return func(s *Service) {
+		if n > 0 {
+			s.subgroupConcurrency = n
+		}
+	}
+}
+
+// WithProjectConcurrency bounds how many projects a group-wide pipeline cleanup plans or deletes
+// in parallel. Values below one fall back to DefaultProjectConcurrency.
+func WithProjectConcurrency(n int) ServiceOption {
+	return func(s *Service) {
+		if n > 0 {
+			s.projectConcurrency = n
+		}
+	}
 }
 
-// NewService creates a new Service instance using the provided client and logger.
-func NewService(client *gitlab.Client, logger *log.Logger) *Service {
+// WithDeletionConcurrency bounds how many pipelines DeletePipelines deletes in parallel. Values
+// below one fall back to DefaultDeletionConcurrency.
+func WithDeletionConcurrency(n int) ServiceOption {
+	return func(s *Service) {
+		if n > 0 {
+			s.deletionConcurrency = n
+		}
+	}
+}
+
+// WithDeletionRateLimit caps pipeline deletions at perSecond requests per second across every
+// deletion the Service runs, allowing bursts of one request per concurrent deletion. Zero or less
+// removes the cap; GitLab's RateLimit-Remaining and Retry-After headers are respected either way.
+func WithDeletionRateLimit(perSecond float64) ServiceOption {
+	return func(s *Service) {
+		s.deletionRate = perSecond
+	}
+}
+
+// WithDeletionLimiter paces the Service's pipeline deletions with limiter, which may be shared
+// with other Services so that their deletions together stay within its rate. It takes precedence
+// over WithDeletionRateLimit.
+func WithDeletionLimiter(limiter *DeletionLimiter) ServiceOption {
+	return func(s *Service) {
+		s.deletions = limiter
+	}
+}
+
+// WithDeletionRetries sets how many times a pipeline deletion rejected with 429 or a 5xx status is
+// retried. Retries wait for GitLab's Retry-After or, without one, for backoff doubled on every
+// attempt. Negative values are ignored, as is a non-positive backoff.
+func WithDeletionRetries(maxRetries int, backoff time.Duration) ServiceOption {
+	return func(s *Service) {
+		if maxRetries >= 0 {
+			s.deletionRetries = maxRetries
+		}
+		if backoff > 0 {
+			s.deletionBackoff = backoff
+		}
+	}
+}
+
+// NewService creates a new Service instance that talks to GitLab through the provided backend.
+// Use BackendFromClient to wrap a *gitlab.Client.
+func NewService(api Backend, logger *slog.Logger, opts ...ServiceOption) *Service {
 	if logger == nil {
-		logger = log.Default()
+		logger = slog.Default()
 	}
 
-	return &Service{
-		client: client,
-		log:    logger,
+	s := &Service{
+		api:                 api,
+		log:                 logger,
+		subgroupConcurrency: DefaultSubgroupConcurrency,
+		projectConcurrency:  DefaultProjectConcurrency,
+		deletionConcurrency: DefaultDeletionConcurrency,
+		deletionRate:        DefaultDeletionRate,
+		deletionRetries:     DefaultDeletionRetries,
+		deletionBackoff:     DefaultDeletionBackoff,
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.deletions == nil {
+		s.deletions = NewDeletionLimiter(s.deletionRate, s.deletionConcurrency)
+	}
+
+	return s
 }
 
 // ListGroupProjectsAll returns all projects within the specified group and any descendant subgroups.
-func (s *Service) ListGroupProjectsAll(ctx context.Context, groupIDOrPath string, archived bool) ([]Project, error) {
-	group, _, err := s.client.Groups.GetGroup(groupIDOrPath, nil, gitlab.WithContext(ctx))
+// Subgroup projects are fetched in parallel, bounded by the configured subgroup concurrency, and
+// returned in the order GitLab lists the subgroups. Subgroups whose projects cannot be listed are
+// reported in the result rather than failing the whole call unless opts.FailFast is set.
+func (s *Service) ListGroupProjectsAll(ctx context.Context, groupIDOrPath string, opts GroupProjectsOptions) (*GroupProjectsResult, error) {
+	group, _, err := s.api.Groups.GetGroup(groupIDOrPath, nil, gitlab.WithContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("get group: %w", err)
 	}
 
-	opts := &gitlab.ListGroupProjectsOptions{
-		ListOptions: gitlab.ListOptions{PerPage: 100},
-	}
-	if archived {
-		opts.Archived = gitlab.Ptr(true)
+	listOpts := &gitlab.ListGroupProjectsOptions{}
+	if opts.Archived {
+		listOpts.Archived = gitlab.Ptr(true)
+	} else if opts.ExcludeArchived {
+		listOpts.Archived = gitlab.Ptr(false)
 	}
 
-	directProjects, _, err := s.client.Groups.ListGroupProjects(group.ID, opts, gitlab.WithContext(ctx))
+	maxResults := opts.MaxResults
+
+	directProjects, truncated, err := s.listProjects(ctx, group.ID, listOpts, maxResults, func(project *gitlab.Project) Project {
+		return newProject(project, group.Path, false, "")
+	})
 	if err != nil {
 		return nil, fmt.Errorf("list group projects: %w", err)
 	}
 
-	var allProjects []Project
-	for _, project := range directProjects {
-		allProjects = append(allProjects, Project{
-			ID:                project.ID,
-			Name:              project.Name,
-			Path:              project.Path,
-			PathWithNamespace: project.PathWithNamespace,
-			WebURL:            project.WebURL,
-			CloneURL:          project.HTTPURLToRepo,
-			GroupPath:         group.Path,
-			IsSubgroupProject: false,
-		})
+	result := &GroupProjectsResult{Projects: directProjects}
+	if truncated {
+		result.Truncated = true
+		return result, nil
 	}
 
-	descendantGroups, _, err := s.client.Groups.ListDescendantGroups(group.ID, &gitlab.ListDescendantGroupsOptions{
-		ListOptions: gitlab.ListOptions{PerPage: 100},
-	}, gitlab.WithContext(ctx))
+	descendantGroups, _, err := collectPages(ctx, 0, func(page int) ([]*gitlab.Group, *gitlab.Response, error) {
+		return s.api.Groups.ListDescendantGroups(group.ID, &gitlab.ListDescendantGroupsOptions{
+			ListOptions: gitlab.ListOptions{PerPage: listPageSize, Page: page},
+		}, gitlab.WithContext(ctx))
+	})
 	if err != nil {
 		return nil, fmt.Errorf("list descendant groups: %w", err)
 	}
 
-	for _, subgroup := range descendantGroups {
-		subgroupProjects, _, err := s.client.Groups.ListGroupProjects(subgroup.ID, opts, gitlab.WithContext(ctx))
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		progressMu sync.Mutex
+		progress   = Progress{Total: len(descendantGroups)}
+	)
+	onDone := func(err error) {
+		if err != nil && opts.FailFast {
+			cancel()
+		}
+		if opts.Progress == nil {
+			return
+		}
+
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		progress.Completed++
 		if err != nil {
-			s.log.Printf("error listing projects for subgroup %s: %v", subgroup.FullPath, err)
-			continue
+			progress.Failed++
+		}
+		opts.Progress(progress)
+	}
+
+	subgroupResults := s.fetchSubgroupProjects(fetchCtx, descendantGroups, listOpts, remainingResults(maxResults, len(directProjects)), onDone)
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("list subgroup projects: %w", err)
+	}
+
+	if opts.FailFast {
+		for i, subgroup := range descendantGroups {
+			// Subgroups interrupted by the fail-fast cancellation are not the root cause.
+			if err := subgroupResults[i].err; err != nil && !errors.Is(err, context.Canceled) {
+				return nil, fmt.Errorf("list projects for subgroup %s: %w", subgroup.FullPath, err)
+			}
 		}
+	}
 
-		for _, project := range subgroupProjects {
-			allProjects = append(allProjects, Project{
-				ID:                project.ID,
-				Name:              project.Name,
-				Path:              project.Path,
-				PathWithNamespace: project.PathWithNamespace,
-				WebURL:            project.WebURL,
-				CloneURL:          project.HTTPURLToRepo,
-				GroupPath:         subgroup.Path,
-				IsSubgroupProject: true,
-				SubgroupFullPath:  subgroup.FullPath,
+	for i, subgroup := range descendantGroups {
+		fetched := subgroupResults[i]
+		if fetched.err != nil {
+			s.log.WarnContext(ctx, "failed to list subgroup projects", "subgroup", subgroup.FullPath, "error", fetched.err)
+			result.FailedSubgroups = append(result.FailedSubgroups, SubgroupFailure{
+				SubgroupID:       subgroup.ID,
+				SubgroupFullPath: subgroup.FullPath,
+				Error:            fetched.err.Error(),
 			})
+			continue
+		}
+
+		// Once the limit is reached the remaining subgroups are only checked for failures.
+		if result.Truncated {
+			continue
+		}
+
+		for _, project := range fetched.projects {
+			if limitReached(maxResults, len(result.Projects)) {
+				result.Truncated = true
+				break
+			}
+			result.Projects = append(result.Projects, project)
+		}
+
+		if fetched.truncated {
+			result.Truncated = true
 		}
 	}
 
-	return allProjects, nil
+	return result, nil
 }
 
 // ListGroupProjects returns projects that belong directly to the specified group.
-func (s *Service) ListGroupProjects(ctx context.Context, groupIDOrPath string) ([]Project, error) {
-	group, _, err := s.client.Groups.GetGroup(groupIDOrPath, nil, gitlab.WithContext(ctx))
+// At most maxResults projects are returned when maxResults is positive; the boolean result reports
+// whether the listing stopped early because of that limit.
+func (s *Service) ListGroupProjects(ctx context.Context, groupIDOrPath string, maxResults int) ([]Project, bool, error) {
+	group, _, err := s.api.Groups.GetGroup(groupIDOrPath, nil, gitlab.WithContext(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("get group: %w", err)
+		return nil, false, fmt.Errorf("get group: %w", err)
 	}
 
-	directProjects, _, err := s.client.Groups.ListGroupProjects(group.ID, &gitlab.ListGroupProjectsOptions{
-		ListOptions: gitlab.ListOptions{PerPage: 100},
-	}, gitlab.WithContext(ctx))
+	projects, truncated, err := s.listProjects(ctx, group.ID, &gitlab.ListGroupProjectsOptions{}, maxResults, func(project *gitlab.Project) Project {
+		return newProject(project, group.Path, false, "")
+	})
 	if err != nil {
-		return nil, fmt.Errorf("list group projects: %w", err)
-	}
-
-	var projects []Project
-	for _, project := range directProjects {
-		projects = append(projects, Project{
-			ID:                project.ID,
-			Name:              project.Name,
-			Path:              project.Path,
-			PathWithNamespace: project.PathWithNamespace,
-			WebURL:            project.WebURL,
-			CloneURL:          project.HTTPURLToRepo,
-			GroupPath:         group.Path,
-			IsSubgroupProject: false,
-		})
+		return nil, false, fmt.Errorf("list group projects: %w", err)
 	}
 
-	return projects, nil
+	return projects, truncated, nil
 }
 
 // ListGroupSubgroups returns the subgroups directly under the specified group.
-func (s *Service) ListGroupSubgroups(ctx context.Context, groupIDOrPath string) ([]Subgroup, error) {
-	group, _, err := s.client.Groups.GetGroup(groupIDOrPath, nil, gitlab.WithContext(ctx))
+// At most maxResults subgroups are returned when maxResults is positive; the boolean result reports
+// whether the listing stopped early because of that limit.
+func (s *Service) ListGroupSubgroups(ctx context.Context, groupIDOrPath string, maxResults int) ([]Subgroup, bool, error) {
+	group, _, err := s.api.Groups.GetGroup(groupIDOrPath, nil, gitlab.WithContext(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("get group: %w", err)
+		return nil, false, fmt.Errorf("get group: %w", err)
 	}
 
-	subgroups, _, err := s.client.Groups.ListSubGroups(group.ID, &gitlab.ListSubGroupsOptions{
-		ListOptions: gitlab.ListOptions{PerPage: 100},
-	}, gitlab.WithContext(ctx))
-	if err != nil {
-		return nil, fmt.Errorf("list subgroups: %w", err)
-	}
+	result, truncated, err := collectPages(ctx, maxResults, func(page int) ([]Subgroup, *gitlab.Response, error) {
+		subgroups, resp, err := s.api.Groups.ListSubGroups(group.ID, &gitlab.ListSubGroupsOptions{
+			ListOptions: gitlab.ListOptions{PerPage: listPageSize, Page: page},
+		}, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		converted := make([]Subgroup, 0, len(subgroups))
+		for _, subgroup := range subgroups {
+			converted = append(converted, Subgroup{
+				ID:       subgroup.ID,
+				Name:     subgroup.Name,
+				Path:     subgroup.Path,
+				FullPath: subgroup.FullPath,
+				WebURL:   subgroup.WebURL,
+				ParentID: group.ID,
+			})
+		}
 
-	var result []Subgroup
-	for _, subgroup := range subgroups {
-		result = append(result, Subgroup{
-			ID:       subgroup.ID,
-			Name:     subgroup.Name,
-			Path:     subgroup.Path,
-			FullPath: subgroup.FullPath,
-			WebURL:   subgroup.WebURL,
-			ParentID: group.ID,
-		})
+		return converted, resp, nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("list subgroups: %w", err)
 	}
 
-	return result, nil
+	return result, truncated, nil
 }
 
-// ArchiveProject archives the specified project.
-func (s *Service) ArchiveProject(ctx context.Context, projectIDOrPath string) (*gitlab.Project, error) {
-	project, _, err := s.client.Projects.ArchiveProject(projectIDOrPath, gitlab.WithContext(ctx))
+// ArchiveProject archives the specified project once permit, or a Preflight run when permit is
+// nil, confirms the token may do so.
+func (s *Service) ArchiveProject(ctx context.Context, projectIDOrPath string, permit *Permit) (*gitlab.Project, error) {
+	if err := s.authorize(ctx, permit, projectIDOrPath, ActionArchiveProject); err != nil {
+		return nil, err
+	}
+
+	project, _, err := s.api.Projects.ArchiveProject(projectIDOrPath, gitlab.WithContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("archive project: %w", err)
 	}
@@ -163,10 +328,102 @@ func (s *Service) ArchiveProject(ctx context.Context, projectIDOrPath string) (*
 
 // GetProject retrieves a project by ID or path.
 func (s *Service) GetProject(ctx context.Context, projectIDOrPath string) (*gitlab.Project, error) {
-	project, _, err := s.client.Projects.GetProject(projectIDOrPath, nil, gitlab.WithContext(ctx))
+	project, _, err := s.api.Projects.GetProject(projectIDOrPath, nil, gitlab.WithContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("get project: %w", err)
 	}
 
 	return project, nil
 }
+
+// CurrentUser returns the user that owns the configured access token.
+func (s *Service) CurrentUser(ctx context.Context) (*gitlab.User, error) {
+	user, _, err := s.api.Users.CurrentUser(gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("get current user: %w", err)
+	}
+
+	return user, nil
+}
+
+type subgroupProjects struct {
+	projects  []Project
+	truncated bool
+	err       error
+}
+
+// fetchSubgroupProjects lists the projects of each subgroup using a bounded pool of workers. The
+// returned slice is index-aligned with subgroups. Subgroups that were not started before ctx was
+// cancelled are left empty; callers must check ctx.Err before using the results. onDone is invoked
+// from the worker goroutines after each subgroup finishes, with the error it failed with, if any.
+func (s *Service) fetchSubgroupProjects(ctx context.Context, subgroups []*gitlab.Group, opts *gitlab.ListGroupProjectsOptions, maxResults int, onDone func(error)) []subgroupProjects {
+	results := make([]subgroupProjects, len(subgroups))
+	if len(subgroups) == 0 {
+		return results
+	}
+
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(s.subgroupConcurrency, len(subgroups)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				subgroup := subgroups[i]
+				projects, truncated, err := s.listProjects(ctx, subgroup.ID, opts, maxResults, func(project *gitlab.Project) Project {
+					return newProject(project, subgroup.Path, true, subgroup.FullPath)
+				})
+				results[i] = subgroupProjects{projects: projects, truncated: truncated, err: err}
+				onDone(err)
+			}
+		}()
+	}
+
+dispatch:
+	for i := range subgroups {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// listProjects pages through the projects of a single group, converting each one with convert.
+func (s *Service) listProjects(ctx context.Context, groupID int, opts *gitlab.ListGroupProjectsOptions, maxResults int, convert func(*gitlab.Project) Project) ([]Project, bool, error) {
+	return collectPages(ctx, maxResults, func(page int) ([]Project, *gitlab.Response, error) {
+		pageOpts := *opts
+		pageOpts.ListOptions = gitlab.ListOptions{PerPage: listPageSize, Page: page}
+
+		projects, resp, err := s.api.Groups.ListGroupProjects(groupID, &pageOpts, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		converted := make([]Project, 0, len(projects))
+		for _, project := range projects {
+			converted = append(converted, convert(project))
+		}
+
+		return converted, resp, nil
+	})
+}
+
+func newProject(project *gitlab.Project, groupPath string, isSubgroupProject bool, subgroupFullPath string) Project {
+	return Project{
+		ID:                project.ID,
+		Name:              project.Name,
+		Path:              project.Path,
+		PathWithNamespace: project.PathWithNamespace,
+		WebURL:            project.WebURL,
+		CloneURL:          project.HTTPURLToRepo,
+		GroupPath:         groupPath,
+		IsSubgroupProject: isSubgroupProject,
+		SubgroupFullPath:  subgroupFullPath,
+	}
+}
@@ -0,0 +1,289 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gitlabclient "gitlab.com/gitlab-org/api/client-go"
+)
+
+type groupResponse struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	FullPath string `json:"full_path"`
+}
+
+type projectResponse struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	Path              string `json:"path"`
+	PathWithNamespace string `json:"path_with_namespace"`
+}
+
+type fakeGroupServer struct {
+	t           *testing.T
+	root        groupResponse
+	descendants []groupResponse
+	projects    map[int][]projectResponse
+	forbidden   map[int]bool
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (f *fakeGroupServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v4/groups/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var body any
+	switch {
+	case len(parts) == 1 && id == f.root.ID:
+		body = f.root
+	case len(parts) == 2 && parts[1] == "descendant_groups":
+		body = f.descendants
+	case len(parts) == 2 && parts[1] == "projects":
+		f.mu.Lock()
+		f.inFlight++
+		f.maxInFlight = max(f.maxInFlight, f.inFlight)
+		f.mu.Unlock()
+
+		// Hold the request briefly so concurrent workers overlap.
+		time.Sleep(5 * time.Millisecond)
+
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+
+		if f.forbidden[id] {
+			http.Error(w, `{"message":"403 Forbidden"}`, http.StatusForbidden)
+			return
+		}
+		body = f.projects[id]
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		f.t.Fatalf("encode response: %v", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func setupGroupService(t *testing.T, fake *fakeGroupServer, opts ...ServiceOption) *Service {
+	t.Helper()
+
+	httpClient := &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			recorder := httptest.NewRecorder()
+			fake.ServeHTTP(recorder, r)
+			resp := recorder.Result()
+			resp.Request = r
+			return resp, nil
+		}),
+	}
+
+	client, err := gitlabclient.NewClient(
+		"test-token",
+		gitlabclient.WithBaseURL("http://example.com/api/v4"),
+		gitlabclient.WithHTTPClient(httpClient),
+	)
+	if err != nil {
+		t.Fatalf("create gitlab client: %v", err)
+	}
+
+	return NewService(BackendFromClient(client), slog.New(slog.DiscardHandler), opts...)
+}
+
+func newFakeGroupTree(t *testing.T, subgroupCount int) *fakeGroupServer {
+	fake := &fakeGroupServer{
+		t:         t,
+		root:      groupResponse{ID: 1, Name: "root", Path: "root", FullPath: "root"},
+		projects:  map[int][]projectResponse{1: {{ID: 100, Name: "direct", Path: "direct", PathWithNamespace: "root/direct"}}},
+		forbidden: map[int]bool{},
+	}
+
+	for i := 0; i < subgroupCount; i++ {
+		id := 10 + i
+		path := fmt.Sprintf("sub%d", i)
+		fake.descendants = append(fake.descendants, groupResponse{ID: id, Name: path, Path: path, FullPath: "root/" + path})
+		fake.projects[id] = []projectResponse{{ID: 1000 + i, Name: "app", Path: "app", PathWithNamespace: "root/" + path + "/app"}}
+	}
+
+	return fake
+}
+
+func TestListGroupProjectsAllKeepsSubgroupOrder(t *testing.T) {
+	fake := newFakeGroupTree(t, 6)
+	fake.forbidden[12] = true
+
+	service := setupGroupService(t, fake, WithSubgroupConcurrency(3))
+
+	result, err := service.ListGroupProjectsAll(context.Background(), "1", GroupProjectsOptions{})
+	if err != nil {
+		t.Fatalf("ListGroupProjectsAll returned error: %v", err)
+	}
+
+	wantIDs := []int{100, 1000, 1001, 1003, 1004, 1005}
+	if len(result.Projects) != len(wantIDs) {
+		t.Fatalf("expected %d projects, got %d: %#v", len(wantIDs), len(result.Projects), result.Projects)
+	}
+	for i, project := range result.Projects {
+		if project.ID != wantIDs[i] {
+			t.Fatalf("expected project %d at position %d, got %d", wantIDs[i], i, project.ID)
+		}
+	}
+
+	if result.Projects[1].SubgroupFullPath != "root/sub0" || !result.Projects[1].IsSubgroupProject {
+		t.Errorf("unexpected subgroup metadata: %#v", result.Projects[1])
+	}
+
+	if len(result.FailedSubgroups) != 1 || result.FailedSubgroups[0].SubgroupFullPath != "root/sub2" {
+		t.Fatalf("expected root/sub2 to be reported as failed, got %#v", result.FailedSubgroups)
+	}
+
+	fake.mu.Lock()
+	maxInFlight := fake.maxInFlight
+	fake.mu.Unlock()
+	if maxInFlight > 3 {
+		t.Errorf("expected at most 3 concurrent project requests, got %d", maxInFlight)
+	}
+}
+
+func TestListGroupProjectsAllFailFast(t *testing.T) {
+	fake := newFakeGroupTree(t, 6)
+	fake.forbidden[13] = true
+
+	service := setupGroupService(t, fake, WithSubgroupConcurrency(2))
+
+	result, err := service.ListGroupProjectsAll(context.Background(), "1", GroupProjectsOptions{FailFast: true})
+	if err == nil {
+		t.Fatalf("expected fail-fast error, got result %#v", result)
+	}
+
+	if !strings.Contains(err.Error(), "root/sub3") {
+		t.Fatalf("expected error to name the failing subgroup, got %v", err)
+	}
+}
+
+func TestListGroupProjectsAllRespectsMaxResults(t *testing.T) {
+	fake := newFakeGroupTree(t, 4)
+
+	service := setupGroupService(t, fake)
+
+	result, err := service.ListGroupProjectsAll(context.Background(), "1", GroupProjectsOptions{MaxResults: 3})
+	if err != nil {
+		t.Fatalf("ListGroupProjectsAll returned error: %v", err)
+	}
+
+	if !result.Truncated {
+		t.Error("expected result to be truncated")
+	}
+
+	if len(result.Projects) != 3 || result.Projects[2].ID != 1001 {
+		t.Fatalf("unexpected projects: %#v", result.Projects)
+	}
+}
+
+func TestListGroupProjectsAllReportsFailuresAfterTruncation(t *testing.T) {
+	fake := newFakeGroupTree(t, 4)
+	fake.forbidden[13] = true
+
+	service := setupGroupService(t, fake)
+
+	result, err := service.ListGroupProjectsAll(context.Background(), "1", GroupProjectsOptions{MaxResults: 2})
+	if err != nil {
+		t.Fatalf("ListGroupProjectsAll returned error: %v", err)
+	}
+
+	if !result.Truncated || len(result.Projects) != 2 {
+		t.Fatalf("expected two projects and a truncated result, got %#v", result)
+	}
+	if len(result.FailedSubgroups) != 1 || result.FailedSubgroups[0].SubgroupFullPath != "root/sub3" {
+		t.Fatalf("expected root/sub3 to be reported as failed, got %#v", result.FailedSubgroups)
+	}
+}
+
+func TestListGroupProjectsAllFilledByDirectProjects(t *testing.T) {
+	fake := newFakeGroupTree(t, 2)
+	fake.projects[10] = nil
+
+	service := setupGroupService(t, fake)
+
+	result, err := service.ListGroupProjectsAll(context.Background(), "1", GroupProjectsOptions{MaxResults: 1})
+	if err != nil {
+		t.Fatalf("ListGroupProjectsAll returned error: %v", err)
+	}
+	if !result.Truncated || len(result.Projects) != 1 || result.Projects[0].ID != 100 {
+		t.Fatalf("expected only the direct project and a truncated result, got %#v", result)
+	}
+
+	fake.projects[11] = nil
+	result, err = service.ListGroupProjectsAll(context.Background(), "1", GroupProjectsOptions{MaxResults: 1})
+	if err != nil {
+		t.Fatalf("ListGroupProjectsAll returned error: %v", err)
+	}
+	if result.Truncated {
+		t.Fatalf("expected no truncation when the subgroups are empty, got %#v", result)
+	}
+}
+
+func TestListGroupProjectsAllHonoursCancellation(t *testing.T) {
+	fake := newFakeGroupTree(t, 2)
+	service := setupGroupService(t, fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := service.ListGroupProjectsAll(ctx, "1", GroupProjectsOptions{}); err == nil {
+		t.Fatal("expected cancelled context to produce an error")
+	}
+}
+
+func TestListGroupProjectsAllReportsProgress(t *testing.T) {
+	fake := newFakeGroupTree(t, 5)
+	fake.forbidden[11] = true
+
+	service := setupGroupService(t, fake, WithSubgroupConcurrency(3))
+
+	var updates []Progress
+	_, err := service.ListGroupProjectsAll(context.Background(), "1", GroupProjectsOptions{
+		Progress: func(progress Progress) { updates = append(updates, progress) },
+	})
+	if err != nil {
+		t.Fatalf("ListGroupProjectsAll returned error: %v", err)
+	}
+
+	if len(updates) != 5 {
+		t.Fatalf("expected one update per subgroup, got %#v", updates)
+	}
+	for i, update := range updates {
+		if update.Completed != i+1 || update.Total != 5 {
+			t.Fatalf("unexpected update %d: %#v", i, update)
+		}
+	}
+	if last := updates[len(updates)-1]; last.Failed != 1 {
+		t.Fatalf("expected one failed subgroup in final update, got %#v", last)
+	}
+}
@@ -0,0 +1,171 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+	"golang.org/x/time/rate"
+)
+
+// maxDeletionBackoff caps the exponential backoff between retries of a pipeline deletion.
+const maxDeletionBackoff = time.Minute
+
+// DeletionLimiter paces pipeline deletions with a token bucket shared by every deletion of a
+// Service, and holds all of them back while GitLab asks clients to slow down. Services given the
+// same limiter with WithDeletionLimiter share its pace.
+type DeletionLimiter struct {
+	// bucket is nil when deletions are not rate limited.
+	bucket *rate.Limiter
+
+	mu       sync.Mutex
+	resumeAt time.Time
+}
+
+// NewDeletionLimiter returns a DeletionLimiter allowing perSecond deletions per second in bursts
+// of up to burst, or DefaultDeletionConcurrency when burst is below one. Zero or less for
+// perSecond removes the cap, leaving only GitLab's own signals.
+func NewDeletionLimiter(perSecond float64, burst int) *DeletionLimiter {
+	if perSecond <= 0 {
+		return &DeletionLimiter{}
+	}
+	if burst < 1 {
+		burst = DefaultDeletionConcurrency
+	}
+
+	return &DeletionLimiter{bucket: rate.NewLimiter(rate.Limit(perSecond), burst)}
+}
+
+// Wait blocks until a deletion may be sent or ctx is done.
+func (l *DeletionLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		wait := time.Until(l.resumeAt)
+		l.mu.Unlock()
+
+		if wait <= 0 {
+			break
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+
+	if l.bucket == nil {
+		return ctx.Err()
+	}
+	return l.bucket.Wait(ctx)
+}
+
+// pauseUntil holds every deletion back until t.
+func (l *DeletionLimiter) pauseUntil(t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if t.After(l.resumeAt) {
+		l.resumeAt = t
+	}
+}
+
+// observe pauses deletions until the reset announced by GitLab once its RateLimit-Remaining
+// header reports the budget spent.
+func (l *DeletionLimiter) observe(resp *gitlab.Response) {
+	if status := parseRateLimit(resp); status != nil && status.Remaining <= 0 && status.ResetAt != nil {
+		l.pauseUntil(*status.ResetAt)
+	}
+}
+
+// deletePipeline deletes one pipeline, retrying 429 and 5xx responses up to the configured
+// number of times. A retry answered with 404 counts as deleted, since the failed attempt before it
+// may have gone through. It returns the number of attempts made alongside the final error, which
+// is ctx's error when ctx is done during a backoff.
+func (s *Service) deletePipeline(ctx context.Context, projectIDOrPath string, pipelineID int) (int, error) {
+	// Retries are handled here so they are paced by the deletion limiter; the client's own
+	// retries would bypass it.
+	noRetry := gitlab.WithRequestRetry(func(context.Context, *http.Response, error) (bool, error) {
+		return false, nil
+	})
+
+	for attempt := 1; ; attempt++ {
+		if err := s.deletions.Wait(ctx); err != nil {
+			return attempt - 1, err
+		}
+
+		resp, err := s.api.Pipelines.DeletePipeline(projectIDOrPath, pipelineID, gitlab.WithContext(ctx), noRetry)
+		s.deletions.observe(resp)
+		if attempt > 1 && errors.Is(err, gitlab.ErrNotFound) {
+			// An earlier attempt deleted the pipeline even though GitLab answered with an error.
+			return attempt, nil
+		}
+		if err == nil || attempt > s.deletionRetries || !retryableStatus(resp) {
+			return attempt, err
+		}
+
+		wait := deletionBackoff(s.deletionBackoff, attempt)
+		if after, ok := retryAfter(resp); ok {
+			wait = after
+			s.deletions.pauseUntil(time.Now().Add(after))
+		}
+
+		s.log.DebugContext(ctx, "retrying pipeline deletion", "project", projectIDOrPath, "pipeline_id", pipelineID,
+			"attempt", attempt, "status", resp.StatusCode, "wait", wait)
+		if err := sleepContext(ctx, wait); err != nil {
+			return attempt, err
+		}
+	}
+}
+
+// retryableStatus reports whether resp is a 429 or 5xx response worth retrying.
+func retryableStatus(resp *gitlab.Response) bool {
+	if resp == nil || resp.Response == nil {
+		return false
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// retryAfter reads the Retry-After header of resp, given in seconds or as an HTTP date.
+func retryAfter(resp *gitlab.Response) (time.Duration, bool) {
+	if resp == nil || resp.Response == nil {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+
+	return 0, false
+}
+
+// deletionBackoff returns the wait before retry number attempt: base doubled for each earlier
+// attempt, capped at maxDeletionBackoff.
+func deletionBackoff(base time.Duration, attempt int) time.Duration {
+	backoff := float64(base) * math.Pow(2, float64(attempt-1))
+	return time.Duration(min(backoff, float64(maxDeletionBackoff)))
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
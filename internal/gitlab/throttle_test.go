@@ -0,0 +1,306 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	gitlabclient "gitlab.com/gitlab-org/api/client-go"
+
+	"github.com/ylchen07/gitlab-mcp-server/internal/gitlab/gitlabtest"
+)
+
+// oldPipelines matches the pipelines added by addOldPipelines.
+var oldPipelines = PipelineFilter{CreatedBefore: time.Now().AddDate(-1, 0, 0)}
+
+// addOldPipelines adds n old pipelines to the project and returns their IDs.
+func addOldPipelines(fake *gitlabtest.Server, projectID, n int) []int {
+	created := time.Now().AddDate(-2, 0, 0)
+
+	var ids []int
+	for range n {
+		ids = append(ids, fake.AddPipeline(projectID, gitlabclient.PipelineInfo{Status: "success", Ref: "main", CreatedAt: &created}).ID)
+	}
+	return ids
+}
+
+func TestDeletePipelinesRetriesRateLimitedAndFailedRequests(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	ids := addOldPipelines(fake, project.ID, 3)
+
+	fake.InjectFault(gitlabtest.Fault{Method: http.MethodDelete, Path: fmt.Sprintf("/projects/acme/api/pipelines/%d", ids[0]), Status: http.StatusTooManyRequests, Times: 2})
+	fake.InjectFault(gitlabtest.Fault{Method: http.MethodDelete, Path: fmt.Sprintf("/projects/acme/api/pipelines/%d", ids[1]), Status: http.StatusBadGateway, Times: 1})
+	fake.InjectFault(gitlabtest.Fault{Method: http.MethodDelete, Path: fmt.Sprintf("/projects/acme/api/pipelines/%d", ids[2]), Status: http.StatusServiceUnavailable})
+
+	service := newGitLabTestService(t, fake, WithDeletionRetries(2, time.Millisecond), WithDeletionRateLimit(0))
+
+	summary, err := service.DeletePipelines(context.Background(), "acme/api", oldPipelines, RetentionPolicy{}, ids, nil, nil)
+	if err != nil {
+		t.Fatalf("DeletePipelines returned error: %v", err)
+	}
+
+	if !slices.Equal(summary.DeletedIDs, ids[:2]) {
+		t.Fatalf("expected the retried deletions to succeed, got %v", summary.DeletedIDs)
+	}
+	if len(summary.Failed) != 1 || summary.Failed[0].PipelineID != ids[2] || summary.Failed[0].Attempts != 3 {
+		t.Fatalf("expected the last deletion to fail after 3 attempts, got %#v", summary.Failed)
+	}
+	if summary.TotalCandidates != len(summary.DeletedIDs)+len(summary.Failed) {
+		t.Fatalf("expected every candidate to be accounted for, got %#v", summary)
+	}
+
+	deletes := map[string]int{}
+	for _, request := range fake.Requests() {
+		if request.Method == http.MethodDelete {
+			deletes[request.Path]++
+		}
+	}
+	for i, want := range []int{3, 2, 3} {
+		path := fmt.Sprintf("/projects/acme/api/pipelines/%d", ids[i])
+		if deletes[path] != want {
+			t.Errorf("expected %d requests for pipeline %d, got %d", want, ids[i], deletes[path])
+		}
+	}
+}
+
+func TestDeletePipelinesDoesNotRetryClientErrors(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	ids := addOldPipelines(fake, project.ID, 1)
+	fake.InjectFault(gitlabtest.Fault{Method: http.MethodDelete, Path: "/projects/acme/api/pipelines", Status: http.StatusNotFound})
+
+	service := newGitLabTestService(t, fake, WithDeletionRetries(3, time.Millisecond))
+
+	summary, err := service.DeletePipelines(context.Background(), "acme/api", oldPipelines, RetentionPolicy{}, ids, nil, nil)
+	if err != nil {
+		t.Fatalf("DeletePipelines returned error: %v", err)
+	}
+	if len(summary.Failed) != 1 || summary.Failed[0].Attempts != 1 {
+		t.Fatalf("expected a single attempt for a 404, got %#v", summary.Failed)
+	}
+}
+
+func TestDeletePipelinesCountsRetriedDeletionsThatWentThrough(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	ids := addOldPipelines(fake, project.ID, 1)
+	fake.InjectFault(gitlabtest.Fault{Method: http.MethodDelete, Path: "/projects/acme/api/pipelines", Status: http.StatusInternalServerError, Times: 1, Applied: true})
+
+	service := newGitLabTestService(t, fake, WithDeletionRetries(2, time.Millisecond), WithDeletionRateLimit(0))
+
+	summary, err := service.DeletePipelines(context.Background(), "acme/api", oldPipelines, RetentionPolicy{}, ids, nil, nil)
+	if err != nil {
+		t.Fatalf("DeletePipelines returned error: %v", err)
+	}
+	if !slices.Equal(summary.DeletedIDs, ids) || len(summary.Failed) != 0 {
+		t.Fatalf("expected the 404 on retry to count as deleted, got %#v", summary)
+	}
+}
+
+func TestDeletePipelinesReportsCancellationDuringBackoff(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	ids := addOldPipelines(fake, project.ID, 1)
+	fake.InjectFault(gitlabtest.Fault{Method: http.MethodDelete, Path: "/projects/acme/api/pipelines", Status: http.StatusServiceUnavailable})
+
+	service := newGitLabTestService(t, fake, WithDeletionRetries(3, time.Hour), WithDeletionRateLimit(0))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	summary := service.deletePipelines(ctx, "acme/api", ids, nil)
+	if len(summary.Failed) != 1 || summary.Failed[0].Attempts != 1 || summary.Failed[0].Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("expected the deletion to be reported as cancelled after one attempt, got %#v", summary.Failed)
+	}
+}
+
+func TestDeletePipelinesHonoursRetryAfter(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	ids := addOldPipelines(fake, project.ID, 2)
+	fake.InjectFault(gitlabtest.Fault{Method: http.MethodDelete, Path: "/projects/acme/api/pipelines", Status: http.StatusTooManyRequests, Times: 1, RetryAfter: time.Second})
+
+	service := newGitLabTestService(t, fake, WithDeletionConcurrency(1), WithDeletionRetries(1, time.Millisecond), WithDeletionRateLimit(0))
+
+	start := time.Now()
+	summary, err := service.DeletePipelines(context.Background(), "acme/api", oldPipelines, RetentionPolicy{}, ids, nil, nil)
+	if err != nil {
+		t.Fatalf("DeletePipelines returned error: %v", err)
+	}
+
+	if len(summary.DeletedIDs) != 2 {
+		t.Fatalf("expected both pipelines to be deleted, got %#v", summary)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected the deletions to wait for Retry-After, took %s", elapsed)
+	}
+}
+
+// countingPipelines records how many deletions are in flight at once.
+type countingPipelines struct {
+	PipelinesAPI
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (c *countingPipelines) DeletePipeline(pid any, pipeline int, options ...gitlabclient.RequestOptionFunc) (*gitlabclient.Response, error) {
+	c.mu.Lock()
+	c.inFlight++
+	c.peak = max(c.peak, c.inFlight)
+	c.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+	resp, err := c.PipelinesAPI.DeletePipeline(pid, pipeline, options...)
+
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+
+	return resp, err
+}
+
+func TestDeletePipelinesRunsInParallel(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	ids := addOldPipelines(fake, project.ID, 12)
+
+	client, err := fake.NewClient(gitlabclient.WithoutRetries(), gitlabclient.WithCustomLimiter(unlimited{}))
+	if err != nil {
+		t.Fatalf("create gitlabtest client: %v", err)
+	}
+	backend := BackendFromClient(client)
+	pipelines := &countingPipelines{PipelinesAPI: backend.Pipelines}
+	backend.Pipelines = pipelines
+
+	service := NewService(backend, slog.New(slog.DiscardHandler), WithDeletionConcurrency(3), WithDeletionRateLimit(0))
+
+	summary, err := service.DeletePipelines(context.Background(), "acme/api", oldPipelines, RetentionPolicy{}, ids, nil, nil)
+	if err != nil {
+		t.Fatalf("DeletePipelines returned error: %v", err)
+	}
+
+	if !slices.Equal(summary.DeletedIDs, ids) {
+		t.Fatalf("expected every pipeline to be deleted in plan order, got %v", summary.DeletedIDs)
+	}
+	if pipelines.peak < 2 || pipelines.peak > 3 {
+		t.Fatalf("expected up to 3 deletions in flight, saw %d", pipelines.peak)
+	}
+}
+
+func TestDeletePipelinesRespectsRateLimit(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	ids := addOldPipelines(fake, project.ID, 6)
+
+	service := newGitLabTestService(t, fake, WithDeletionConcurrency(1), WithDeletionRateLimit(50))
+
+	start := time.Now()
+	summary, err := service.DeletePipelines(context.Background(), "acme/api", oldPipelines, RetentionPolicy{}, ids, nil, nil)
+	if err != nil {
+		t.Fatalf("DeletePipelines returned error: %v", err)
+	}
+
+	if len(summary.DeletedIDs) != len(ids) {
+		t.Fatalf("expected every pipeline to be deleted, got %#v", summary)
+	}
+	// A bucket of one token refilled 50 times a second lets 6 requests through in no less than 100ms.
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("expected the deletions to be paced, took %s", elapsed)
+	}
+}
+
+func TestDeletionLimiterIsSharedBetweenServices(t *testing.T) {
+	fake := gitlabtest.New()
+	api := fake.AddProject("acme", "api")
+	web := fake.AddProject("acme", "web")
+	apiIDs := addOldPipelines(fake, api.ID, 3)
+	webIDs := addOldPipelines(fake, web.ID, 3)
+
+	limiter := NewDeletionLimiter(50, 1)
+	first := newGitLabTestService(t, fake, WithDeletionConcurrency(1), WithDeletionLimiter(limiter))
+	second := newGitLabTestService(t, fake, WithDeletionConcurrency(1), WithDeletionLimiter(limiter))
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, run := range []struct {
+		service *Service
+		project string
+		ids     []int
+	}{{first, "acme/api", apiIDs}, {second, "acme/web", webIDs}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := run.service.DeletePipelines(context.Background(), run.project, oldPipelines, RetentionPolicy{}, run.ids, nil, nil); err != nil {
+				t.Errorf("DeletePipelines returned error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(fake.Pipelines(api.ID))+len(fake.Pipelines(web.ID)) != 0 {
+		t.Fatal("expected every pipeline to be deleted")
+	}
+	// Six deletions through one bucket refilled 50 times a second take no less than 100ms.
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("expected both services to share the pace, took %s", elapsed)
+	}
+}
+
+func TestDeletePipelinesAccountsForCancelledDeletions(t *testing.T) {
+	fake := gitlabtest.New()
+	project := fake.AddProject("acme", "api")
+	ids := addOldPipelines(fake, project.ID, 3)
+
+	service := newGitLabTestService(t, fake)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Preflight and the recheck run before any deletion; cancel as soon as they are done.
+	var once sync.Once
+	summary, err := service.DeletePipelines(ctx, "acme/api", oldPipelines, RetentionPolicy{}, ids, nil, func(Progress) { once.Do(cancel) })
+	if err != nil {
+		t.Fatalf("DeletePipelines returned error: %v", err)
+	}
+
+	if len(summary.DeletedIDs) != 0 || len(summary.Failed) != len(ids) {
+		t.Fatalf("expected every pipeline to be reported as failed, got %#v", summary)
+	}
+	for _, failure := range summary.Failed {
+		if failure.Attempts != 0 {
+			t.Fatalf("expected no deletion to be attempted, got %#v", failure)
+		}
+	}
+}
+
+func TestDeletionLimiterPausesUntilReset(t *testing.T) {
+	limiter := NewDeletionLimiter(0, 1)
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	header := http.Header{}
+	header.Set("RateLimit-Limit", "600")
+	header.Set("RateLimit-Remaining", "1")
+	header.Set("RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	limiter.observe(&gitlabclient.Response{Response: &http.Response{Header: header}})
+	if !limiter.resumeAt.IsZero() {
+		t.Fatalf("expected no pause while budget remains, got %s", limiter.resumeAt)
+	}
+
+	header.Set("RateLimit-Remaining", "0")
+	limiter.observe(&gitlabclient.Response{Response: &http.Response{Header: header}})
+	if !limiter.resumeAt.Equal(reset) {
+		t.Fatalf("expected a pause until %s, got %s", reset, limiter.resumeAt)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx); err == nil {
+		t.Fatal("expected Wait to block until the reset")
+	}
+}
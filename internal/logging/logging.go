@@ -0,0 +1,119 @@
+// Package logging builds the structured logger shared by the server and GitLab service.
+//
+// Logs never go to stdout: the stdio MCP transport owns that stream, and any stray
+// line would corrupt the protocol. Output goes to stderr unless a log file is configured.
+// Records logged with an MCP request context are additionally forwarded to the calling
+// client as log notifications; see NewSessionHandler.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/util"
+)
+
+const (
+	// FormatText renders records as key=value pairs.
+	FormatText = "text"
+	// FormatJSON renders records as one JSON object per line.
+	FormatJSON = "json"
+)
+
+// Config controls where and how the logger writes records.
+type Config struct {
+	// Level is the minimum level to emit: debug, info, warn or error. Empty means info.
+	Level string
+	// Format is FormatText or FormatJSON. Empty means FormatText.
+	Format string
+	// File, when set, receives log output (appended) instead of stderr.
+	File string
+}
+
+// New returns a logger configured by cfg writing to stderr or cfg.File and forwarding
+// request-scoped records to MCP clients. The returned closer releases the log file, if any,
+// and is always non-nil.
+func New(cfg Config, stderr io.Writer) (*slog.Logger, io.Closer, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out io.Writer = stderr
+	var closer io.Closer = nopCloser{}
+
+	if path := strings.TrimSpace(cfg.File); path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open log file: %w", err)
+		}
+		out = file
+		closer = file
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(strings.TrimSpace(cfg.Format)) {
+	case "", FormatText:
+		handler = slog.NewTextHandler(out, opts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		_ = closer.Close()
+		return nil, nil, fmt.Errorf("unknown log format %q (want %s or %s)", cfg.Format, FormatText, FormatJSON)
+	}
+
+	return slog.New(NewSessionHandler(handler)), closer, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// ParseLevel converts a level name (debug, info, warn, error) into a slog.Level.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", name)
+	}
+}
+
+// Discard returns a logger that drops every record.
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// StdLogger adapts logger for APIs that require a *log.Logger; lines are logged at level.
+func StdLogger(logger *slog.Logger, level slog.Level) *log.Logger {
+	return slog.NewLogLogger(logger.Handler(), level)
+}
+
+// MCPLogger adapts logger to the logging interface used by the mcp-go transports.
+func MCPLogger(logger *slog.Logger) util.Logger {
+	return mcpLogger{logger: logger}
+}
+
+type mcpLogger struct {
+	logger *slog.Logger
+}
+
+func (l mcpLogger) Infof(format string, v ...any) {
+	l.logger.Info(fmt.Sprintf(format, v...))
+}
+
+func (l mcpLogger) Errorf(format string, v ...any) {
+	l.logger.Error(fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewWritesJSONAtConfiguredLevel(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, closer, err := New(Config{Level: "warn", Format: "json"}, &buf)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	defer closer.Close()
+
+	logger.Info("dropped")
+	logger.Warn("kept", "subgroup", "acme/tools")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected exactly one record, got %q", buf.String())
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("expected JSON record, got %q: %v", lines[0], err)
+	}
+	if record["msg"] != "kept" || record["subgroup"] != "acme/tools" {
+		t.Fatalf("unexpected record: %v", record)
+	}
+}
+
+func TestNewWritesToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+
+	logger, closer, err := New(Config{File: path}, io.Discard)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	logger.Info("hello file")
+	if err := closer.Close(); err != nil {
+		t.Fatalf("close log file: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+	if !strings.Contains(string(data), "hello file") {
+		t.Fatalf("expected log file to contain record, got %q", data)
+	}
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	if _, _, err := New(Config{Level: "loud"}, io.Discard); err == nil {
+		t.Error("expected unknown level to be rejected")
+	}
+	if _, _, err := New(Config{Format: "xml"}, io.Discard); err == nil {
+		t.Error("expected unknown format to be rejected")
+	}
+}
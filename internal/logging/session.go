@@ -0,0 +1,171 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	serverpkg "github.com/mark3labs/mcp-go/server"
+)
+
+// SessionLoggerName is the logger name attached to log notifications sent to MCP clients.
+const SessionLoggerName = "gitlab-mcp-server"
+
+// NewSessionHandler wraps next so that records logged with a request context are also sent
+// to the calling MCP client as notifications/message. The client controls which levels it
+// receives through logging/setLevel; next keeps its own level for local output.
+func NewSessionHandler(next slog.Handler) slog.Handler {
+	return &sessionHandler{next: next}
+}
+
+type sessionHandler struct {
+	next   slog.Handler
+	attrs  []slog.Attr
+	groups []string
+}
+
+func (h *sessionHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.next.Enabled(ctx, level) {
+		return true
+	}
+
+	_, session := sessionFromContext(ctx)
+	return session != nil && mcpLevel(level).ShouldSendTo(session.GetLogLevel())
+}
+
+func (h *sessionHandler) Handle(ctx context.Context, record slog.Record) error {
+	var err error
+	if h.next.Enabled(ctx, record.Level) {
+		err = h.next.Handle(ctx, record)
+	}
+
+	server, session := sessionFromContext(ctx)
+	if session == nil {
+		return err
+	}
+
+	level := mcpLevel(record.Level)
+	if !level.ShouldSendTo(session.GetLogLevel()) {
+		return err
+	}
+
+	// Delivery is best effort: a slow or disconnected client must not fail the operation.
+	_ = server.SendLogMessageToClient(ctx, mcp.NewLoggingMessageNotification(level, SessionLoggerName, h.data(record)))
+
+	return err
+}
+
+func (h *sessionHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithAttrs(attrs)
+	clone.attrs = append(slices.Clip(h.attrs), nestAttrs(h.groups, attrs)...)
+	return &clone
+}
+
+func (h *sessionHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	clone := *h
+	clone.next = h.next.WithGroup(name)
+	clone.groups = append(slices.Clip(h.groups), name)
+	return &clone
+}
+
+// data renders record as the notification payload: the message plus every attribute, with
+// groups as nested objects.
+func (h *sessionHandler) data(record slog.Record) map[string]any {
+	data := map[string]any{"message": record.Message}
+	for _, attr := range h.attrs {
+		addAttr(data, attr)
+	}
+
+	var recordAttrs []slog.Attr
+	record.Attrs(func(attr slog.Attr) bool {
+		recordAttrs = append(recordAttrs, attr)
+		return true
+	})
+	for _, attr := range nestAttrs(h.groups, recordAttrs) {
+		addAttr(data, attr)
+	}
+
+	return data
+}
+
+// nestAttrs places attrs inside the open groups, innermost last.
+func nestAttrs(groups []string, attrs []slog.Attr) []slog.Attr {
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	for i := len(groups) - 1; i >= 0; i-- {
+		attrs = []slog.Attr{{Key: groups[i], Value: slog.GroupValue(attrs...)}}
+	}
+	return attrs
+}
+
+func addAttr(data map[string]any, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() != slog.KindGroup {
+		data[attr.Key] = attrValue(attr.Value)
+		return
+	}
+
+	group := data
+	if attr.Key != "" {
+		nested, ok := data[attr.Key].(map[string]any)
+		if !ok {
+			nested = map[string]any{}
+			data[attr.Key] = nested
+		}
+		group = nested
+	}
+	for _, member := range attr.Value.Group() {
+		addAttr(group, member)
+	}
+}
+
+func attrValue(value slog.Value) any {
+	if value.Kind() == slog.KindDuration {
+		return value.Duration().String()
+	}
+	if err, ok := value.Any().(error); ok {
+		return err.Error()
+	}
+	return value.Any()
+}
+
+func sessionFromContext(ctx context.Context) (*serverpkg.MCPServer, serverpkg.SessionWithLogging) {
+	server := serverpkg.ServerFromContext(ctx)
+	if server == nil {
+		return nil, nil
+	}
+
+	session, ok := serverpkg.ClientSessionFromContext(ctx).(serverpkg.SessionWithLogging)
+	if !ok || !session.Initialized() {
+		return nil, nil
+	}
+
+	return server, session
+}
+
+func mcpLevel(level slog.Level) mcp.LoggingLevel {
+	switch {
+	case level < slog.LevelInfo:
+		return mcp.LoggingLevelDebug
+	case level < slog.LevelWarn:
+		return mcp.LoggingLevelInfo
+	case level < slog.LevelError:
+		return mcp.LoggingLevelWarning
+	case level == slog.LevelError:
+		return mcp.LoggingLevelError
+	default:
+		return mcp.LoggingLevelCritical
+	}
+}
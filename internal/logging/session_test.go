@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	serverpkg "github.com/mark3labs/mcp-go/server"
+)
+
+type fakeSession struct {
+	notifications chan mcp.JSONRPCNotification
+	level         mcp.LoggingLevel
+}
+
+func newFakeSession(level mcp.LoggingLevel) *fakeSession {
+	return &fakeSession{notifications: make(chan mcp.JSONRPCNotification, 10), level: level}
+}
+
+func (s *fakeSession) Initialize()                                         {}
+func (s *fakeSession) Initialized() bool                                   { return true }
+func (s *fakeSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return s.notifications }
+func (s *fakeSession) SessionID() string                                   { return "test-session" }
+func (s *fakeSession) SetLogLevel(level mcp.LoggingLevel)                  { s.level = level }
+func (s *fakeSession) GetLogLevel() mcp.LoggingLevel                       { return s.level }
+
+// callLoggingTool invokes a tool that logs through logger inside a real MCP request, so the
+// handler sees the same context as production tool handlers.
+func callLoggingTool(t *testing.T, session *fakeSession, log func(ctx context.Context)) {
+	t.Helper()
+
+	srv := serverpkg.NewMCPServer("test", "1.0.0", serverpkg.WithLogging())
+	srv.AddTool(mcp.NewTool("log"), func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		log(ctx)
+		return mcp.NewToolResultText("ok"), nil
+	})
+
+	ctx := srv.WithContext(context.Background(), session)
+	srv.HandleMessage(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"log"}}`))
+}
+
+func TestSessionHandlerForwardsRecordsToClient(t *testing.T) {
+	var local bytes.Buffer
+	logger := slog.New(NewSessionHandler(slog.NewTextHandler(&local, nil))).With("project", "acme/api")
+	session := newFakeSession(mcp.LoggingLevelWarning)
+
+	callLoggingTool(t, session, func(ctx context.Context) {
+		logger.InfoContext(ctx, "below client level")
+		logger.ErrorContext(ctx, "failed to delete pipeline", "pipeline_id", 42, "error", errors.New("boom"))
+	})
+
+	if !strings.Contains(local.String(), "below client level") || !strings.Contains(local.String(), "failed to delete pipeline") {
+		t.Fatalf("expected both records in local output, got %q", local.String())
+	}
+
+	if len(session.notifications) != 1 {
+		t.Fatalf("expected one notification, got %d", len(session.notifications))
+	}
+
+	notification := <-session.notifications
+	if notification.Method != "notifications/message" {
+		t.Fatalf("unexpected method %q", notification.Method)
+	}
+
+	params := notification.Params.AdditionalFields
+	if params["level"] != mcp.LoggingLevelError || params["logger"] != SessionLoggerName {
+		t.Fatalf("unexpected params: %v", params)
+	}
+
+	data, ok := params["data"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected map data, got %T", params["data"])
+	}
+	if data["message"] != "failed to delete pipeline" || data["project"] != "acme/api" ||
+		data["pipeline_id"] != int64(42) || data["error"] != "boom" {
+		t.Fatalf("unexpected data: %v", data)
+	}
+}
+
+func TestSessionHandlerHonorsClientLevelBelowLocalLevel(t *testing.T) {
+	var local bytes.Buffer
+	logger := slog.New(NewSessionHandler(slog.NewTextHandler(&local, &slog.HandlerOptions{Level: slog.LevelError})))
+	session := newFakeSession(mcp.LoggingLevelDebug)
+
+	callLoggingTool(t, session, func(ctx context.Context) {
+		logger.WithGroup("sync").DebugContext(ctx, "visiting subgroup", "path", "acme/tools")
+	})
+
+	if local.Len() != 0 {
+		t.Fatalf("expected no local output, got %q", local.String())
+	}
+	if len(session.notifications) != 1 {
+		t.Fatalf("expected one notification, got %d", len(session.notifications))
+	}
+
+	data := (<-session.notifications).Params.AdditionalFields["data"].(map[string]any)
+	group, ok := data["sync"].(map[string]any)
+	if !ok || group["path"] != "acme/tools" {
+		t.Fatalf("expected grouped attribute, got %v", data)
+	}
+}
+
+func TestSessionHandlerWithoutSessionOnlyLogsLocally(t *testing.T) {
+	var local bytes.Buffer
+	logger := slog.New(NewSessionHandler(slog.NewTextHandler(&local, nil)))
+
+	logger.WarnContext(context.Background(), "no client")
+
+	if !strings.Contains(local.String(), "no client") {
+		t.Fatalf("expected local output, got %q", local.String())
+	}
+}